@@ -0,0 +1,35 @@
+package main
+
+import "log/slog"
+
+// Audit events logged by the server
+const (
+	auditDelegationRegistered = "delegation.registered"
+	auditDelegationRevoked    = "delegation.revoked"
+	auditDelegationExpired    = "delegation.expired"
+	auditReEncryptionRefused  = "reencryption.refused"
+
+	auditRecoveryKitRegistered  = "recovery.kit_registered"
+	auditRecoveryApproved       = "recovery.approved"
+	auditRecoverySharesReleased = "recovery.shares_released"
+)
+
+// audit logs an event about a delegation to the audit log
+func (s *Server) audit(event string, delegation Delegation, attrs ...any) {
+	attrs = append([]any{
+		slog.String("event", event),
+		slog.String("delegation", delegation.ID),
+		slog.String("owner", delegation.Owner),
+		slog.String("delegatee", delegation.Delegatee),
+	}, attrs...)
+	s.auditLog.Info("audit", attrs...)
+}
+
+// auditRecovery logs an event about the recovery kit of owner to the audit log
+func (s *Server) auditRecovery(event, owner string, attrs ...any) {
+	attrs = append([]any{
+		slog.String("event", event),
+		slog.String("owner", owner),
+	}, attrs...)
+	s.auditLog.Info("audit", attrs...)
+}
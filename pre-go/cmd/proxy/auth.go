@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre/auth"
+)
+
+// nonceTTL is how long an issued nonce can be used to sign a request
+const nonceTTL = 5 * time.Minute
+
+// signerKey is the gin context key of the hex fingerprint of the authenticated signer
+const signerKey = "signer"
+
+// errTooManyNonces is returned by nonces.issue when a limit on outstanding nonces is reached
+var errTooManyNonces = errors.New("too many outstanding nonces")
+
+// nonces remembers the nonces issued to clients until they are used or expire. Issuing is
+// unauthenticated, so the number of outstanding nonces is bounded, in total and per client.
+type nonces struct {
+	mu        sync.Mutex
+	issued    map[string]issuedNonce
+	perClient map[string]int
+
+	max          int
+	maxPerClient int
+}
+
+// issuedNonce is the expiry of a nonce and the client it was issued to
+type issuedNonce struct {
+	expiresAt time.Time
+	client    string
+}
+
+func newNonces(max, maxPerClient int) *nonces {
+	return &nonces{
+		issued:       make(map[string]issuedNonce),
+		perClient:    make(map[string]int),
+		max:          max,
+		maxPerClient: maxPerClient,
+	}
+}
+
+// issue returns a fresh nonce for the client valid until the returned time, or an error
+// wrapping errTooManyNonces if the server or the client holds too many outstanding nonces
+func (n *nonces) issue(client string, now time.Time) (string, time.Time, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if len(n.issued) >= n.max {
+		return "", time.Time{}, fmt.Errorf("%w: %d in total", errTooManyNonces, n.max)
+	}
+	if n.perClient[client] >= n.maxPerClient {
+		return "", time.Time{}, fmt.Errorf("%w: %d for %s", errTooManyNonces, n.maxPerClient, client)
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", time.Time{}, err
+	}
+	nonce := base64.RawURLEncoding.EncodeToString(b)
+	expiresAt := now.Add(nonceTTL)
+
+	n.issued[nonce] = issuedNonce{expiresAt: expiresAt, client: client}
+	n.perClient[client]++
+	return nonce, expiresAt, nil
+}
+
+// consume reports whether the nonce was issued and has not expired, and forgets it so
+// that it cannot be used again
+func (n *nonces) consume(nonce string, now time.Time) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	issued, ok := n.issued[nonce]
+	if ok {
+		n.forget(nonce, issued)
+	}
+	return ok && now.Before(issued.expiresAt)
+}
+
+// deleteExpired forgets the nonces that expired by now
+func (n *nonces) deleteExpired(now time.Time) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for nonce, issued := range n.issued {
+		if !now.Before(issued.expiresAt) {
+			n.forget(nonce, issued)
+		}
+	}
+}
+
+// forget removes an issued nonce; n.mu must be held
+func (n *nonces) forget(nonce string, issued issuedNonce) {
+	delete(n.issued, nonce)
+	if n.perClient[issued.client]--; n.perClient[issued.client] <= 0 {
+		delete(n.perClient, issued.client)
+	}
+}
+
+// issueNonce hands out a nonce for the client to sign its next request with
+func (s *Server) issueNonce(c *gin.Context) {
+	nonce, expiresAt, err := s.nonces.issue(c.ClientIP(), s.now())
+	if errors.Is(err, errTooManyNonces) {
+		// nonces are released when used or when they expire
+		c.Header("Retry-After", strconv.Itoa(int(nonceTTL/time.Second)))
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "too many outstanding nonces"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate nonce"})
+		return
+	}
+
+	c.JSON(http.StatusOK, auth.Nonce{Nonce: nonce, ExpiresAt: expiresAt.UTC()})
+}
+
+// authenticate is the middleware requiring requests to be signed as described in package
+// auth, over a nonce issued by this server. The signature proves that the caller holds the
+// secret key of the public key in the X-Public-Key header, whose hex fingerprint is then
+// available to the handlers with signer.
+func (s *Server) authenticate(c *gin.Context) {
+	// the body is signed, so it is read whole before anything is checked
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, s.maxBodySize))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("body larger than %d bytes", tooLarge.Limit)})
+		return
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "failed to read body"})
+		return
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	publicKey, err := auth.VerifyRequest(c.Request.Header, c.Request.Method, c.Request.URL.RequestURI(), body)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid signature"})
+		return
+	}
+	// checked after the signature, so that forged requests cannot burn the nonces of others
+	if !s.nonces.consume(c.GetHeader(auth.HeaderNonce), s.now()) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unknown, used or expired nonce"})
+		return
+	}
+
+	c.Set(signerKey, hex.EncodeToString(publicKey.Fingerprint()))
+	c.Next()
+}
+
+// signer returns the hex fingerprint of the public key that signed the request
+func signer(c *gin.Context) string {
+	return c.GetString(signerKey)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// FileBlobStore is a BlobStore keeping one file per blob in a directory.
+// File names are the hex SHA-256 of the ID, so any ID maps to a safe file name.
+type FileBlobStore struct {
+	dir string
+}
+
+var _ BlobStore = (*FileBlobStore)(nil)
+
+// NewFileBlobStore creates a blob store in dir, creating the directory if needed
+func NewFileBlobStore(dir string) (*FileBlobStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create blob directory: %w", err)
+	}
+
+	return &FileBlobStore{dir: dir}, nil
+}
+
+// PutBlob writes the blob to a temporary file and renames it into place,
+// so readers never see a partially written blob
+func (s *FileBlobStore) PutBlob(id string, data []byte) error {
+	tmp, err := os.CreateTemp(s.dir, ".blob-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // #nosec G104 -- fails harmlessly once renamed
+
+	if _, err = tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.path(id))
+}
+
+// GetBlob reads the blob stored under id
+func (s *FileBlobStore) GetBlob(id string) ([]byte, error) {
+	data, err := os.ReadFile(s.path(id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("blob %q: %w", id, ErrNotFound)
+	}
+
+	return data, err
+}
+
+// DeleteBlob removes the blob stored under id
+func (s *FileBlobStore) DeleteBlob(id string) error {
+	err := os.Remove(s.path(id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
+
+// path returns the file holding the blob of id
+func (s *FileBlobStore) path(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:]))
+}
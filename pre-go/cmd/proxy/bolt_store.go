@@ -0,0 +1,386 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre/recovery"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre/types"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Buckets of the BoltDB file. Record buckets are keyed by record ID; the delegations
+// bucket holds one nested bucket per owner, keyed by delegatee.
+var (
+	boltBucketOwners        = []byte("owners")         // owner fingerprint of each record
+	boltBucketCapsules      = []byte("capsules")       // capsules as envelopes without payload
+	boltBucketPayloads      = []byte("payloads")       // encrypted payloads
+	boltBucketDelegations   = []byte("delegations")    // boltDelegation values
+	boltBucketDelegationIDs = []byte("delegation_ids") // owner || 0 || delegatee of each delegation ID
+	boltBucketTombstones    = []byte("tombstones")     // JSON tombstones, keyed by delegation ID
+	boltBucketRecoveryKits  = []byte("recovery_kits")  // serialized recovery kits, keyed by owner
+
+	boltRecordBuckets = [][]byte{boltBucketOwners, boltBucketCapsules, boltBucketPayloads}
+)
+
+// boltDelegation is the JSON value of a delegation, under its owner and delegatee
+type boltDelegation struct {
+	ID              string    `json:"id"`
+	ReencryptionKey []byte    `json:"reencryption_key"` // canonical binary re-encryption key
+	ExpiresAt       time.Time `json:"expires_at"`
+}
+
+// BoltStore is a durable Store in a single BoltDB file
+type BoltStore struct {
+	db *bolt.DB
+}
+
+var _ Store = (*BoltStore)(nil)
+
+// OpenBoltStore opens the BoltDB file at path, creating it if needed
+func OpenBoltStore(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{
+			boltBucketOwners, boltBucketCapsules, boltBucketPayloads,
+			boltBucketDelegations, boltBucketDelegationIDs, boltBucketTombstones,
+			boltBucketRecoveryKits,
+		} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to create buckets: %w", err)
+	}
+
+	return &BoltStore{db: db}, nil
+}
+
+// PutRecord checks the owner of the record under id and saves the owner, capsule and
+// payload of the new record in one transaction
+func (s *BoltStore) PutRecord(id string, record Record) error {
+	capsule, err := marshalCapsule(record)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		key := []byte(id)
+		owners := tx.Bucket(boltBucketOwners)
+		if owner := owners.Get(key); owner != nil && string(owner) != record.Owner {
+			return fmt.Errorf("record %q: %w", id, ErrRecordOwner)
+		}
+		if err := owners.Put(key, []byte(record.Owner)); err != nil {
+			return err
+		}
+		if err := tx.Bucket(boltBucketCapsules).Put(key, capsule); err != nil {
+			return err
+		}
+		return tx.Bucket(boltBucketPayloads).Put(key, record.EncryptedData)
+	})
+}
+
+// GetRecord returns the record stored under id
+func (s *BoltStore) GetRecord(id string) (Record, error) {
+	var record Record
+	err := s.db.View(func(tx *bolt.Tx) error {
+		key := []byte(id)
+		owner := tx.Bucket(boltBucketOwners).Get(key)
+		capsule := tx.Bucket(boltBucketCapsules).Get(key)
+		if owner == nil || capsule == nil {
+			return fmt.Errorf("record %q: %w", id, ErrNotFound)
+		}
+
+		record.Owner = string(owner)
+		if err := unmarshalCapsule(&record, capsule); err != nil {
+			return fmt.Errorf("record %q: %w", id, err)
+		}
+		// values are only valid for the life of the transaction
+		if payload := tx.Bucket(boltBucketPayloads).Get(key); payload != nil {
+			record.EncryptedData = append([]byte{}, payload...)
+		}
+		return nil
+	})
+	if err != nil {
+		return Record{}, err
+	}
+
+	return record, nil
+}
+
+// DeleteRecord removes the record stored under id in one transaction
+func (s *BoltStore) DeleteRecord(id string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		key := []byte(id)
+		for _, bucket := range boltRecordBuckets {
+			if err := tx.Bucket(bucket).Delete(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// PutDelegation saves the delegation in the bucket of the owner unless it was revoked or its
+// ID belongs to other parties
+func (s *BoltStore) PutDelegation(delegation Delegation) error {
+	reKey, err := types.MarshalReEncryptionKey(delegation.ReencryptionKey)
+	if err != nil {
+		return err
+	}
+	value, err := json.Marshal(boltDelegation{ID: delegation.ID, ReencryptionKey: reKey, ExpiresAt: delegation.ExpiresAt})
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket(boltBucketTombstones).Get([]byte(delegation.ID)) != nil {
+			return fmt.Errorf("delegation %s: %w", delegation.ID, ErrRevoked)
+		}
+		key := boltDelegationKey(delegation.Owner, delegation.Delegatee)
+		if bound := tx.Bucket(boltBucketDelegationIDs).Get([]byte(delegation.ID)); bound != nil && !bytes.Equal(bound, key) {
+			return fmt.Errorf("delegation %s: %w", delegation.ID, ErrDelegationConflict)
+		}
+		if err := deleteBoltDelegation(tx, delegation.Owner, delegation.Delegatee); err != nil {
+			return err
+		}
+
+		owner, err := tx.Bucket(boltBucketDelegations).CreateBucketIfNotExists([]byte(delegation.Owner))
+		if err != nil {
+			return err
+		}
+		if err := owner.Put([]byte(delegation.Delegatee), value); err != nil {
+			return err
+		}
+		return tx.Bucket(boltBucketDelegationIDs).Put([]byte(delegation.ID), key)
+	})
+}
+
+// GetDelegation returns the delegation from owner to delegatee
+func (s *BoltStore) GetDelegation(owner, delegatee string) (Delegation, error) {
+	var delegation Delegation
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		delegation, err = getBoltDelegation(tx, owner, delegatee)
+		return err
+	})
+	if err != nil {
+		return Delegation{}, err
+	}
+
+	return delegation, nil
+}
+
+// GetDelegationByID returns the delegation with the given ID
+func (s *BoltStore) GetDelegationByID(id string) (Delegation, error) {
+	var delegation Delegation
+	err := s.db.View(func(tx *bolt.Tx) error {
+		owner, delegatee, ok := bytes.Cut(tx.Bucket(boltBucketDelegationIDs).Get([]byte(id)), []byte{0})
+		if !ok {
+			return fmt.Errorf("delegation %s: %w", id, ErrNotFound)
+		}
+
+		var err error
+		delegation, err = getBoltDelegation(tx, string(owner), string(delegatee))
+		return err
+	})
+	if err != nil {
+		return Delegation{}, err
+	}
+
+	return delegation, nil
+}
+
+// DeleteDelegation removes the delegation from owner to delegatee
+func (s *BoltStore) DeleteDelegation(owner, delegatee string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return deleteBoltDelegation(tx, owner, delegatee)
+	})
+}
+
+// RevokeDelegation removes the delegation and saves its tombstone in one transaction
+func (s *BoltStore) RevokeDelegation(tombstone Tombstone) error {
+	value, err := json.Marshal(tombstone)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		owner, delegatee, ok := bytes.Cut(tx.Bucket(boltBucketDelegationIDs).Get([]byte(tombstone.ID)), []byte{0})
+		if !ok {
+			return fmt.Errorf("delegation %s: %w", tombstone.ID, ErrNotFound)
+		}
+		if err := deleteBoltDelegation(tx, string(owner), string(delegatee)); err != nil {
+			return err
+		}
+		return tx.Bucket(boltBucketTombstones).Put([]byte(tombstone.ID), value)
+	})
+}
+
+// GetTombstone returns the tombstone of the delegation with the given ID
+func (s *BoltStore) GetTombstone(id string) (Tombstone, error) {
+	var tombstone Tombstone
+	err := s.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket(boltBucketTombstones).Get([]byte(id))
+		if value == nil {
+			return fmt.Errorf("tombstone %s: %w", id, ErrNotFound)
+		}
+		return json.Unmarshal(value, &tombstone)
+	})
+	if err != nil {
+		return Tombstone{}, err
+	}
+
+	return tombstone, nil
+}
+
+// DeleteExpiredDelegations removes the delegations expired at now in one transaction
+func (s *BoltStore) DeleteExpiredDelegations(now time.Time) ([]Delegation, error) {
+	var expired []Delegation
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		expired = nil
+		err := tx.Bucket(boltBucketDelegations).ForEachBucket(func(owner []byte) error {
+			return tx.Bucket(boltBucketDelegations).Bucket(owner).ForEach(func(delegatee, _ []byte) error {
+				delegation, err := getBoltDelegation(tx, string(owner), string(delegatee))
+				if err != nil {
+					return err
+				}
+				if delegation.Expired(now) {
+					expired = append(expired, delegation)
+				}
+				return nil
+			})
+		})
+		if err != nil {
+			return err
+		}
+
+		// buckets must not be modified while iterating over them
+		for _, delegation := range expired {
+			if err := deleteBoltDelegation(tx, delegation.Owner, delegation.Delegatee); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return expired, nil
+}
+
+// PutRecoveryKit saves the recovery kit of owner
+func (s *BoltStore) PutRecoveryKit(owner string, kit *recovery.Kit) error {
+	data, err := kit.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltBucketRecoveryKits).Put([]byte(owner), data)
+	})
+}
+
+// GetRecoveryKit returns the recovery kit of owner
+func (s *BoltStore) GetRecoveryKit(owner string) (*recovery.Kit, error) {
+	kit := new(recovery.Kit)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(boltBucketRecoveryKits).Get([]byte(owner))
+		if data == nil {
+			return fmt.Errorf("recovery kit of %s: %w", owner, ErrNotFound)
+		}
+		return kit.UnmarshalBinary(data)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return kit, nil
+}
+
+// ApproveRecovery adds the re-encrypted share of the guardian to the recovery kit of owner
+// in one transaction
+func (s *BoltStore) ApproveRecovery(owner, guardian, recoverer string, key *types.FirstLevelSymmetricKey) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltBucketRecoveryKits)
+		data := bucket.Get([]byte(owner))
+		if data == nil {
+			return fmt.Errorf("recovery kit of %s: %w", owner, ErrNotFound)
+		}
+
+		data, err := approveRecovery(data, guardian, recoverer, key)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(owner), data)
+	})
+}
+
+// boltDelegationKey is the value of a delegation ID in the index bucket.
+// Fingerprints are hex, so they never contain the separator.
+func boltDelegationKey(owner, delegatee string) []byte {
+	return []byte(owner + "\x00" + delegatee)
+}
+
+// getBoltDelegation reads the delegation from owner to delegatee within tx
+func getBoltDelegation(tx *bolt.Tx, owner, delegatee string) (Delegation, error) {
+	var value []byte
+	if bucket := tx.Bucket(boltBucketDelegations).Bucket([]byte(owner)); bucket != nil {
+		value = bucket.Get([]byte(delegatee))
+	}
+	if value == nil {
+		return Delegation{}, fmt.Errorf("delegation %s -> %s: %w", owner, delegatee, ErrNotFound)
+	}
+
+	var stored boltDelegation
+	if err := json.Unmarshal(value, &stored); err != nil {
+		return Delegation{}, fmt.Errorf("delegation %s -> %s: %w", owner, delegatee, err)
+	}
+	reKey, err := types.UnmarshalReEncryptionKey(stored.ReencryptionKey)
+	if err != nil {
+		return Delegation{}, fmt.Errorf("delegation %s -> %s: %w", owner, delegatee, err)
+	}
+
+	return Delegation{
+		ID:              stored.ID,
+		Owner:           owner,
+		Delegatee:       delegatee,
+		ReencryptionKey: reKey,
+		ExpiresAt:       stored.ExpiresAt,
+	}, nil
+}
+
+// deleteBoltDelegation removes the delegation from owner to delegatee and its ID within tx
+func deleteBoltDelegation(tx *bolt.Tx, owner, delegatee string) error {
+	bucket := tx.Bucket(boltBucketDelegations).Bucket([]byte(owner))
+	if bucket == nil {
+		return nil
+	}
+
+	if value := bucket.Get([]byte(delegatee)); value != nil {
+		var stored boltDelegation
+		if err := json.Unmarshal(value, &stored); err != nil {
+			return err
+		}
+		if err := tx.Bucket(boltBucketDelegationIDs).Delete([]byte(stored.ID)); err != nil {
+			return err
+		}
+	}
+	return bucket.Delete([]byte(delegatee))
+}
+
+// Close closes the BoltDB file
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Storage backends selectable with PROXY_STORE
+const (
+	storeMemory = "memory"
+	storeBolt   = "bolt"
+)
+
+// Defaults of the delegation settings
+const (
+	defaultDelegationTTL = 30 * 24 * time.Hour
+	defaultSweepInterval = time.Minute
+)
+
+// defaultRequestTimeout bounds the handling of a request, re-encryption included
+const defaultRequestTimeout = 30 * time.Second
+
+// Defaults of the bounds on the nonces handed out before authentication
+const (
+	defaultMaxNonces          = 100000
+	defaultMaxNoncesPerClient = 100
+)
+
+// defaultMaxBodySize bounds the body of signed requests, which is read before it is verified
+const defaultMaxBodySize = 32 << 20
+
+// Config selects the storage backends of the proxy and how long delegations last.
+// It is read from the environment:
+//
+//	PROXY_STORE           storage backend, "memory" (default) or "bolt"
+//	PROXY_BOLT_PATH       BoltDB file of the "bolt" backend (default "proxy.db")
+//	PROXY_BLOB_DIR        if set, encrypted payloads are kept as files in this directory
+//	                      instead of in the storage backend
+//	PROXY_DELEGATION_TTL  lifetime of delegations registered without expiry (default 720h)
+//	PROXY_SWEEP_INTERVAL  how often expired delegations are removed (default 1m)
+//	PROXY_REQUEST_TIMEOUT deadline of the handling of a request (default 30s)
+//	PROXY_REQUIRE_CAPSULE_PROOF if true, records are only stored along with a proof of
+//	                      knowledge of their capsule, see types.EncryptOptions.Prove
+//	PROXY_MAX_NONCES      nonces outstanding at once (default 100000); further nonce
+//	                      requests get 503 until nonces are used or expire
+//	PROXY_MAX_NONCES_PER_CLIENT nonces outstanding at once per client IP (default 100)
+//	PROXY_MAX_BODY_SIZE   size in bytes of the largest request body (default 32 MiB);
+//	                      larger requests get 413
+//
+// Zero limits in a Config built otherwise stand for the defaults.
+type Config struct {
+	Store    string
+	BoltPath string
+	BlobDir  string
+
+	DelegationTTL time.Duration
+	SweepInterval time.Duration
+
+	RequestTimeout time.Duration
+
+	RequireCapsuleProof bool
+
+	MaxNonces          int
+	MaxNoncesPerClient int
+	MaxBodySize        int
+}
+
+// LoadConfig reads the configuration from the environment
+func LoadConfig() (Config, error) {
+	cfg := Config{
+		Store:          os.Getenv("PROXY_STORE"),
+		BoltPath:       os.Getenv("PROXY_BOLT_PATH"),
+		BlobDir:        os.Getenv("PROXY_BLOB_DIR"),
+		DelegationTTL:  defaultDelegationTTL,
+		SweepInterval:  defaultSweepInterval,
+		RequestTimeout: defaultRequestTimeout,
+
+		MaxNonces:          defaultMaxNonces,
+		MaxNoncesPerClient: defaultMaxNoncesPerClient,
+		MaxBodySize:        defaultMaxBodySize,
+	}
+	if cfg.Store == "" {
+		cfg.Store = storeMemory
+	}
+	if cfg.BoltPath == "" {
+		cfg.BoltPath = "proxy.db"
+	}
+
+	for _, setting := range []struct {
+		env   string
+		value *time.Duration
+	}{
+		{"PROXY_DELEGATION_TTL", &cfg.DelegationTTL},
+		{"PROXY_SWEEP_INTERVAL", &cfg.SweepInterval},
+		{"PROXY_REQUEST_TIMEOUT", &cfg.RequestTimeout},
+	} {
+		if v := os.Getenv(setting.env); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d <= 0 {
+				return Config{}, fmt.Errorf("invalid %s %q", setting.env, v)
+			}
+			*setting.value = d
+		}
+	}
+
+	for _, setting := range []struct {
+		env   string
+		value *int
+	}{
+		{"PROXY_MAX_NONCES", &cfg.MaxNonces},
+		{"PROXY_MAX_NONCES_PER_CLIENT", &cfg.MaxNoncesPerClient},
+		{"PROXY_MAX_BODY_SIZE", &cfg.MaxBodySize},
+	} {
+		if v := os.Getenv(setting.env); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				return Config{}, fmt.Errorf("invalid %s %q", setting.env, v)
+			}
+			*setting.value = n
+		}
+	}
+
+	if v := os.Getenv("PROXY_REQUIRE_CAPSULE_PROOF"); v != "" {
+		required, err := strconv.ParseBool(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid PROXY_REQUIRE_CAPSULE_PROOF %q", v)
+		}
+		cfg.RequireCapsuleProof = required
+	}
+
+	return cfg, nil
+}
+
+// OpenStore opens the storage backends selected by the configuration
+func OpenStore(cfg Config) (Store, error) {
+	var store Store
+	switch cfg.Store {
+	case storeMemory:
+		store = NewInMemoryStore()
+	case storeBolt:
+		boltStore, err := OpenBoltStore(cfg.BoltPath)
+		if err != nil {
+			return nil, err
+		}
+		store = boltStore
+	default:
+		return nil, fmt.Errorf("unknown store %q", cfg.Store)
+	}
+
+	if cfg.BlobDir == "" {
+		return store, nil
+	}
+
+	blobs, err := NewFileBlobStore(cfg.BlobDir)
+	if err != nil {
+		_ = store.Close()
+		return nil, err
+	}
+	return WithBlobStore(store, blobs), nil
+}
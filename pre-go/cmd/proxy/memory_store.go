@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre/recovery"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre/types"
+)
+
+// delegationKey identifies a delegation in the in-memory store
+type delegationKey struct {
+	owner, delegatee string
+}
+
+// InMemoryStore is a simple thread-safe in-memory storage.
+// Everything it holds is lost when the proxy stops.
+type InMemoryStore struct {
+	sync.RWMutex
+	records       map[string]Record
+	delegations   map[delegationKey]Delegation
+	delegationIDs map[string]delegationKey
+	tombstones    map[string]Tombstone
+	recoveryKits  map[string][]byte // serialized, so approvals never alias the kits handed out
+}
+
+var _ Store = (*InMemoryStore)(nil)
+
+// NewInMemoryStore creates an empty in-memory store
+func NewInMemoryStore() *InMemoryStore {
+	return &InMemoryStore{
+		records:       make(map[string]Record),
+		delegations:   make(map[delegationKey]Delegation),
+		delegationIDs: make(map[string]delegationKey),
+		tombstones:    make(map[string]Tombstone),
+		recoveryKits:  make(map[string][]byte),
+	}
+}
+
+// PutRecord saves the record under id unless it holds a record of another owner
+func (s *InMemoryStore) PutRecord(id string, record Record) error {
+	record.EncryptedData = append([]byte(nil), record.EncryptedData...)
+
+	s.Lock()
+	defer s.Unlock()
+	if existing, exists := s.records[id]; exists && existing.Owner != record.Owner {
+		return fmt.Errorf("record %q: %w", id, ErrRecordOwner)
+	}
+	s.records[id] = record
+	return nil
+}
+
+// GetRecord returns the record stored under id
+func (s *InMemoryStore) GetRecord(id string) (Record, error) {
+	s.RLock()
+	record, exists := s.records[id]
+	s.RUnlock()
+
+	if !exists {
+		return Record{}, fmt.Errorf("record %q: %w", id, ErrNotFound)
+	}
+	record.EncryptedData = append([]byte(nil), record.EncryptedData...)
+	return record, nil
+}
+
+// DeleteRecord removes the record stored under id
+func (s *InMemoryStore) DeleteRecord(id string) error {
+	s.Lock()
+	delete(s.records, id)
+	s.Unlock()
+	return nil
+}
+
+// PutDelegation saves the delegation unless it was revoked or its ID belongs to other parties
+func (s *InMemoryStore) PutDelegation(delegation Delegation) error {
+	key := delegationKey{delegation.Owner, delegation.Delegatee}
+
+	s.Lock()
+	defer s.Unlock()
+
+	if _, revoked := s.tombstones[delegation.ID]; revoked {
+		return fmt.Errorf("delegation %s: %w", delegation.ID, ErrRevoked)
+	}
+	if bound, exists := s.delegationIDs[delegation.ID]; exists && bound != key {
+		return fmt.Errorf("delegation %s: %w", delegation.ID, ErrDelegationConflict)
+	}
+	s.deleteDelegation(key)
+	s.delegations[key] = delegation
+	s.delegationIDs[delegation.ID] = key
+	return nil
+}
+
+// GetDelegation returns the delegation from owner to delegatee
+func (s *InMemoryStore) GetDelegation(owner, delegatee string) (Delegation, error) {
+	s.RLock()
+	delegation, exists := s.delegations[delegationKey{owner, delegatee}]
+	s.RUnlock()
+
+	if !exists {
+		return Delegation{}, fmt.Errorf("delegation %s -> %s: %w", owner, delegatee, ErrNotFound)
+	}
+	return delegation, nil
+}
+
+// GetDelegationByID returns the delegation with the given ID
+func (s *InMemoryStore) GetDelegationByID(id string) (Delegation, error) {
+	s.RLock()
+	delegation, exists := s.delegations[s.delegationIDs[id]]
+	s.RUnlock()
+
+	if !exists {
+		return Delegation{}, fmt.Errorf("delegation %s: %w", id, ErrNotFound)
+	}
+	return delegation, nil
+}
+
+// DeleteDelegation removes the delegation from owner to delegatee
+func (s *InMemoryStore) DeleteDelegation(owner, delegatee string) error {
+	s.Lock()
+	s.deleteDelegation(delegationKey{owner, delegatee})
+	s.Unlock()
+	return nil
+}
+
+// RevokeDelegation removes the delegation and saves its tombstone
+func (s *InMemoryStore) RevokeDelegation(tombstone Tombstone) error {
+	s.Lock()
+	defer s.Unlock()
+
+	key, exists := s.delegationIDs[tombstone.ID]
+	if !exists {
+		return fmt.Errorf("delegation %s: %w", tombstone.ID, ErrNotFound)
+	}
+	s.deleteDelegation(key)
+	s.tombstones[tombstone.ID] = tombstone
+	return nil
+}
+
+// GetTombstone returns the tombstone of the delegation with the given ID
+func (s *InMemoryStore) GetTombstone(id string) (Tombstone, error) {
+	s.RLock()
+	tombstone, exists := s.tombstones[id]
+	s.RUnlock()
+
+	if !exists {
+		return Tombstone{}, fmt.Errorf("tombstone %s: %w", id, ErrNotFound)
+	}
+	return tombstone, nil
+}
+
+// DeleteExpiredDelegations removes the delegations expired at now
+func (s *InMemoryStore) DeleteExpiredDelegations(now time.Time) ([]Delegation, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	var expired []Delegation
+	for key, delegation := range s.delegations {
+		if delegation.Expired(now) {
+			expired = append(expired, delegation)
+			s.deleteDelegation(key)
+		}
+	}
+	return expired, nil
+}
+
+// PutRecoveryKit saves the recovery kit of owner
+func (s *InMemoryStore) PutRecoveryKit(owner string, kit *recovery.Kit) error {
+	data, err := kit.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	s.Lock()
+	s.recoveryKits[owner] = data
+	s.Unlock()
+	return nil
+}
+
+// GetRecoveryKit returns the recovery kit of owner
+func (s *InMemoryStore) GetRecoveryKit(owner string) (*recovery.Kit, error) {
+	s.RLock()
+	data, exists := s.recoveryKits[owner]
+	s.RUnlock()
+
+	if !exists {
+		return nil, fmt.Errorf("recovery kit of %s: %w", owner, ErrNotFound)
+	}
+	kit := new(recovery.Kit)
+	if err := kit.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+	return kit, nil
+}
+
+// ApproveRecovery adds the re-encrypted share of the guardian to the recovery kit of owner
+func (s *InMemoryStore) ApproveRecovery(owner, guardian, recoverer string, key *types.FirstLevelSymmetricKey) error {
+	s.Lock()
+	defer s.Unlock()
+
+	data, exists := s.recoveryKits[owner]
+	if !exists {
+		return fmt.Errorf("recovery kit of %s: %w", owner, ErrNotFound)
+	}
+	data, err := approveRecovery(data, guardian, recoverer, key)
+	if err != nil {
+		return err
+	}
+	s.recoveryKits[owner] = data
+	return nil
+}
+
+// deleteDelegation removes the delegation and its ID; the caller holds the lock
+func (s *InMemoryStore) deleteDelegation(key delegationKey) {
+	if delegation, exists := s.delegations[key]; exists {
+		delete(s.delegationIDs, delegation.ID)
+		delete(s.delegations, key)
+	}
+}
+
+// Close is a no-op
+func (s *InMemoryStore) Close() error {
+	return nil
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre/recovery"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre/types"
+)
+
+// RecoveryKitRequest registers the recovery kit of the owner, who signs the request.
+// It replaces the previous kit of the owner and the approvals it had.
+type RecoveryKitRequest struct {
+	Kit string `json:"kit"` // Base64 encoded recovery.Kit
+}
+
+// RecoveryApprovalRequest is sent by a guardian, who signs it, to approve the recovery of the
+// key of the owner by the key pair of the recoverer
+type RecoveryApprovalRequest struct {
+	Owner              string `json:"owner"`                // Hex fingerprint of the owner
+	RecovererPublicKey string `json:"recoverer_public_key"` // Base64 encoded
+	ReencryptionKey    string `json:"reencryption_key"`     // Base64 encoded, guardian -> recoverer
+}
+
+// RecoveryRequest is sent by the recoverer, who signs it, to fetch the kit of the owner
+// once enough guardians approved
+type RecoveryRequest struct {
+	Owner string `json:"owner"` // Hex fingerprint of the owner
+}
+
+// putRecoveryKit stores the recovery kit of the owner
+func (s *Server) putRecoveryKit(c *gin.Context) {
+	var req RecoveryKitRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	data, err := base64.StdEncoding.DecodeString(req.Kit)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid recovery kit encoding"})
+		return
+	}
+	kit := new(recovery.Kit)
+	if err := kit.UnmarshalBinary(data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid recovery kit format"})
+		return
+	}
+
+	owner := signer(c)
+	if hex.EncodeToString(kit.Owner.Fingerprint()) != owner {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "recovery kit belongs to another owner"})
+		return
+	}
+	// the capsules are re-encrypted on approval, so they are checked like those of records
+	for _, envelope := range kit.Guardians {
+		if err := pre.CheckCapsule(envelope.Capsule); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid capsule"})
+			return
+		}
+		if s.requireCapsuleProof && envelope.Capsule.Proof == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "missing capsule proof"})
+			return
+		}
+	}
+
+	if err := s.store.PutRecoveryKit(owner, kit); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to store recovery kit"})
+		return
+	}
+	s.auditRecovery(auditRecoveryKitRegistered, owner, slog.Int("guardians", len(kit.Guardians)), slog.Int("threshold", kit.Threshold))
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":    "success",
+		"owner":     owner,
+		"guardians": len(kit.Guardians),
+		"threshold": kit.Threshold,
+	})
+}
+
+// approveRecovery re-encrypts the share of the guardian for the recoverer
+func (s *Server) approveRecovery(c *gin.Context) {
+	var req RecoveryApprovalRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	guardian := signer(c)
+	recoverer, err := decodeFingerprint(req.RecovererPublicKey)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid recoverer public key"})
+		return
+	}
+	reKeyBytes, err := base64.StdEncoding.DecodeString(req.ReencryptionKey)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid reencryption key encoding"})
+		return
+	}
+	reKey, err := types.UnmarshalReEncryptionKey(reKeyBytes)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid reencryption key format"})
+		return
+	}
+
+	kit, err := s.store.GetRecoveryKit(req.Owner)
+	if errors.Is(err, ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "recovery kit not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load recovery kit"})
+		return
+	}
+	guardianBytes, _ := hex.DecodeString(guardian)
+	envelope := kit.Guardian(guardianBytes)
+	if envelope == nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "not a guardian of the owner"})
+		return
+	}
+
+	key, err := s.proxy.ReEncryptionContext(c.Request.Context(), envelope.Capsule, reKey)
+	if errors.Is(err, context.DeadlineExceeded) {
+		c.JSON(http.StatusGatewayTimeout, gin.H{"error": "re-encryption timed out"})
+		return
+	}
+	if errors.Is(err, context.Canceled) {
+		// the client is gone
+		c.Abort()
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to re-encrypt share"})
+		return
+	}
+
+	// the kit may have been replaced since it was loaded, along with its guardians
+	err = s.store.ApproveRecovery(req.Owner, guardian, recoverer, key)
+	if errors.Is(err, ErrNotFound) || errors.Is(err, types.ErrMalformedCapsule) {
+		c.JSON(http.StatusConflict, gin.H{"error": "recovery kit was replaced"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to store approval"})
+		return
+	}
+	s.auditRecovery(auditRecoveryApproved, req.Owner, slog.String("guardian", guardian), slog.String("recoverer", recoverer))
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":    "approved",
+		"owner":     req.Owner,
+		"guardian":  guardian,
+		"recoverer": recoverer,
+	})
+}
+
+// recoveryShares hands the recoverer the kit of the owner, with the shares re-encrypted for
+// them, once threshold guardians approved
+func (s *Server) recoveryShares(c *gin.Context) {
+	var req RecoveryRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	recoverer := signer(c)
+	kit, err := s.store.GetRecoveryKit(req.Owner)
+	if errors.Is(err, ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "recovery kit not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load recovery kit"})
+		return
+	}
+
+	recovererBytes, _ := hex.DecodeString(recoverer)
+	approvals := kit.Approvals(recovererBytes)
+	if approvals < kit.Threshold {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":     "not enough approvals",
+			"approvals": approvals,
+			"threshold": kit.Threshold,
+		})
+		return
+	}
+
+	// other recoverers are none of the business of this one
+	for _, envelope := range kit.Guardians {
+		key := envelope.RecipientKey(recovererBytes)
+		envelope.Recipients = nil
+		if key != nil {
+			if err := envelope.SetRecipient(recovererBytes, key); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to encode recovery kit"})
+				return
+			}
+		}
+	}
+	data, err := kit.MarshalBinary()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to encode recovery kit"})
+		return
+	}
+	s.auditRecovery(auditRecoverySharesReleased, req.Owner, slog.String("recoverer", recoverer), slog.Int("approvals", approvals))
+
+	c.JSON(http.StatusOK, gin.H{
+		"kit":       base64.StdEncoding.EncodeToString(data),
+		"approvals": approvals,
+		"threshold": kit.Threshold,
+	})
+}
@@ -0,0 +1,488 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre/auth"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre/types"
+)
+
+// DelegationRequest authorizes the proxy to re-encrypt every record of the owner, who signs
+// the request, for the delegatee until ExpiresAt, or for the configured delegation TTL if
+// it is not set
+type DelegationRequest struct {
+	DelegateePublicKey string    `json:"delegatee_public_key"` // Base64 encoded
+	ReencryptionKey    string    `json:"reencryption_key"`     // Base64 encoded
+	ExpiresAt          time.Time `json:"expires_at"`           // RFC 3339, optional
+}
+
+// RecordRequest represents the incoming request to store an encrypted record of the owner,
+// who signs the request. The capsule and payload are given either as encrypted_key and
+// encrypted_data, or as an envelope. The bare encrypted key does not carry the attributes of
+// the capsule, so the context and proof, if any, are given alongside it and the owner is the
+// signer; a bare key with neither is a key of pre-ts, which has no attributes. Capsules are
+// checked with pre.CheckCapsule before they are stored.
+type RecordRequest struct {
+	RecordID     string `json:"record_id"` // Generated if empty
+	EncryptedKey struct {
+		First   string `json:"first"`   // Base64 encoded
+		Second  string `json:"second"`  // Base64 encoded
+		Context string `json:"context"` // Base64 encoded context of the capsule, optional
+		Proof   string `json:"proof"`   // Base64 encoded capsule proof, optional
+	} `json:"encrypted_key"`
+	EncryptedData []byte `json:"encrypted_data"`
+	Envelope      string `json:"envelope"` // Base64 encoded
+}
+
+// StoreRequest is the request of the deprecated /store endpoint, which predates signed
+// requests and delegations. It stores a record of the signer under UserID like a
+// RecordRequest; the re-encryption key lacks the public key of its delegatee, so it is
+// ignored and the delegation is registered separately with a DelegationRequest.
+type StoreRequest struct {
+	ReencryptionKey string `json:"reencryption_key"` // Base64 encoded, ignored
+	EncryptedKey    struct {
+		First  string `json:"first"`  // Base64 encoded
+		Second string `json:"second"` // Base64 encoded
+	} `json:"encrypted_key"`
+	EncryptedData []byte `json:"encrypted_data"`
+	UserID        string `json:"user_id"`
+}
+
+// ProxyRequest represents the request structure for re-encryption, signed by the delegatee
+type ProxyRequest struct {
+	RequestID string `json:"request_id"` // ID of the record
+}
+
+// Server serves the proxy API on top of a Store. Owners register records and, separately,
+// delegations to the delegatees they authorize; any record of an owner can then be
+// re-encrypted for any of their delegatees without uploading it again.
+//
+// Delegations expire and can be revoked by their owner; revoked re-encryption keys are
+// remembered with a tombstone and cannot be registered again.
+//
+// Owners may also register a recovery kit, see package recovery. Their guardians approve a
+// recovery with a re-encryption key to the key pair of the recoverer, who gets the kit back
+// once enough guardians approved.
+//
+// Every request but the nonce endpoint is signed by the owner or the delegatee it is sent
+// on behalf of, see authenticate.
+type Server struct {
+	store               Store
+	proxy               types.ContextProxy
+	delegationTTL       time.Duration
+	requestTimeout      time.Duration
+	requireCapsuleProof bool
+	maxBodySize         int64
+	auditLog            *slog.Logger
+	nonces              *nonces
+	now                 func() time.Time
+}
+
+// NewServer creates a server backed by store, auditing to stderr
+func NewServer(store Store, cfg Config) *Server {
+	return &Server{
+		store:               store,
+		proxy:               pre.NewProxy().(types.ContextProxy),
+		delegationTTL:       cfg.DelegationTTL,
+		requestTimeout:      cfg.RequestTimeout,
+		requireCapsuleProof: cfg.RequireCapsuleProof,
+		maxBodySize:         int64(orDefault(cfg.MaxBodySize, defaultMaxBodySize)),
+		auditLog:            slog.New(slog.NewJSONHandler(os.Stderr, nil)),
+		nonces:              newNonces(orDefault(cfg.MaxNonces, defaultMaxNonces), orDefault(cfg.MaxNoncesPerClient, defaultMaxNoncesPerClient)),
+		now:                 time.Now,
+	}
+}
+
+// orDefault returns limit, or def if limit is not set
+func orDefault(limit, def int) int {
+	if limit <= 0 {
+		return def
+	}
+	return limit
+}
+
+// Register adds the endpoints of the server to r
+func (s *Server) Register(r gin.IRouter) {
+	r = r.Group("/", s.withTimeout)
+	r.POST(auth.NoncePath, s.issueNonce)
+
+	signed := r.Group("/", s.authenticate)
+	signed.POST("/delegations", s.putDelegation)
+	signed.DELETE("/delegations/:id", s.revokeDelegation)
+	signed.POST("/records", s.putRecord)
+	signed.POST("/store", s.legacyStore)
+	signed.POST("/request", s.request)
+	signed.POST("/recovery/kits", s.putRecoveryKit)
+	signed.POST("/recovery/approvals", s.approveRecovery)
+	signed.POST("/recovery/shares", s.recoveryShares)
+}
+
+// withTimeout bounds the context of the request by the request timeout, if any. The context
+// is also canceled when the client disconnects, which stops the re-encryption of the request.
+func (s *Server) withTimeout(c *gin.Context) {
+	if s.requestTimeout <= 0 {
+		c.Next()
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), s.requestTimeout)
+	defer cancel()
+	c.Request = c.Request.WithContext(ctx)
+	c.Next()
+}
+
+// putDelegation stores the re-encryption key from the owner to the delegatee
+func (s *Server) putDelegation(c *gin.Context) {
+	var req DelegationRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	owner := signer(c)
+	delegatee, err := decodeFingerprint(req.DelegateePublicKey)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid delegatee public key"})
+		return
+	}
+
+	reKeyBytes, err := base64.StdEncoding.DecodeString(req.ReencryptionKey)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid reencryption key encoding"})
+		return
+	}
+	reKey, err := types.UnmarshalReEncryptionKey(reKeyBytes)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid reencryption key format"})
+		return
+	}
+
+	id, err := DelegationID(reKey)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid reencryption key format"})
+		return
+	}
+	commitment, err := pre.ReKeyCommitment(reKey)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid reencryption key format"})
+		return
+	}
+	commitmentBytes := commitment.Bytes()
+
+	now := s.now()
+	expiresAt := req.ExpiresAt
+	if expiresAt.IsZero() {
+		expiresAt = now.Add(s.delegationTTL)
+	}
+	if !expiresAt.After(now) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expiry is in the past"})
+		return
+	}
+
+	delegation := Delegation{
+		ID:              id,
+		Owner:           owner,
+		Delegatee:       delegatee,
+		ReencryptionKey: reKey,
+		ExpiresAt:       expiresAt.UTC(),
+	}
+	err = s.store.PutDelegation(delegation)
+	if errors.Is(err, ErrRevoked) {
+		c.JSON(http.StatusConflict, gin.H{"error": "reencryption key was revoked"})
+		return
+	}
+	if errors.Is(err, ErrDelegationConflict) {
+		c.JSON(http.StatusConflict, gin.H{"error": "reencryption key is registered between other parties"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to store delegation"})
+		return
+	}
+	s.audit(auditDelegationRegistered, delegation, slog.Time("expires_at", delegation.ExpiresAt))
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":     "success",
+		"id":         id,
+		"owner":      owner,
+		"delegatee":  delegatee,
+		"expires_at": delegation.ExpiresAt,
+		// the commitment proofs of re-encryption are checked against, see pre.VerifyReEncryption
+		"reencryption_key_commitment": base64.StdEncoding.EncodeToString(commitmentBytes[:]),
+	})
+}
+
+// revokeDelegation deletes a delegation on behalf of its owner and leaves a tombstone
+func (s *Server) revokeDelegation(c *gin.Context) {
+	id := c.Param("id")
+
+	delegation, err := s.store.GetDelegationByID(id)
+	if errors.Is(err, ErrNotFound) {
+		if _, err := s.store.GetTombstone(id); err == nil {
+			c.JSON(http.StatusGone, gin.H{"error": "delegation was already revoked"})
+			return
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": "delegation not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load delegation"})
+		return
+	}
+	if delegation.Owner != signer(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only the owner can revoke a delegation"})
+		return
+	}
+
+	tombstone := Tombstone{
+		ID:        id,
+		Owner:     delegation.Owner,
+		Delegatee: delegation.Delegatee,
+		RevokedAt: s.now().UTC(),
+	}
+	if err := s.store.RevokeDelegation(tombstone); err != nil && !errors.Is(err, ErrNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke delegation"})
+		return
+	}
+	s.audit(auditDelegationRevoked, delegation, slog.Time("revoked_at", tombstone.RevokedAt))
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":     "revoked",
+		"id":         id,
+		"revoked_at": tombstone.RevokedAt,
+	})
+}
+
+// putRecord stores the capsule and payload of a record of the owner
+func (s *Server) putRecord(c *gin.Context) {
+	var req RecordRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	s.saveRecord(c, req)
+}
+
+// legacyStore serves the deprecated /store endpoint as /records, see StoreRequest
+func (s *Server) legacyStore(c *gin.Context) {
+	var legacy StoreRequest
+	if err := c.BindJSON(&legacy); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Deprecation", "true")
+	c.Header("Link", `</records>; rel="successor-version"`)
+	var req RecordRequest
+	req.RecordID = legacy.UserID
+	req.EncryptedKey.First = legacy.EncryptedKey.First
+	req.EncryptedKey.Second = legacy.EncryptedKey.Second
+	req.EncryptedData = legacy.EncryptedData
+	s.saveRecord(c, req)
+}
+
+// saveRecord checks and stores the record of a RecordRequest of the signer
+func (s *Server) saveRecord(c *gin.Context, req RecordRequest) {
+	owner := signer(c)
+	record := Record{Owner: owner}
+	if req.Envelope != "" {
+		envelope, err := decodeEnvelope(req.Envelope)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid envelope"})
+			return
+		}
+		if len(envelope.Capsule.Owner) > 0 && hex.EncodeToString(envelope.Capsule.Owner) != owner {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "envelope belongs to another owner"})
+			return
+		}
+		record.Scheme, record.EncryptedKey, record.EncryptedData = envelope.Scheme, envelope.Capsule, envelope.Payload
+	} else {
+		firstBytes, err := base64.StdEncoding.DecodeString(req.EncryptedKey.First)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid first key component encoding"})
+			return
+		}
+		secondBytes, err := base64.StdEncoding.DecodeString(req.EncryptedKey.Second)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid second key component encoding"})
+			return
+		}
+		record.Scheme = types.SchemeBN254
+		record.EncryptedKey = new(types.SecondLevelSymmetricKey)
+		if err := record.EncryptedKey.UnmarshalBinary(append(firstBytes, secondBytes...)); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid encrypted key format"})
+			return
+		}
+		// the attributes the encoding leaves out, which the message and the capsule proof
+		// are bound to. Capsules of pre-ts have neither context nor proof, and their messages
+		// are bound to no attribute.
+		if req.EncryptedKey.Context != "" || req.EncryptedKey.Proof != "" {
+			record.EncryptedKey.Owner, _ = hex.DecodeString(owner)
+		}
+		if req.EncryptedKey.Context != "" {
+			if record.EncryptedKey.Context, err = base64.StdEncoding.DecodeString(req.EncryptedKey.Context); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid context encoding"})
+				return
+			}
+		}
+		if req.EncryptedKey.Proof != "" {
+			proofBytes, err := base64.StdEncoding.DecodeString(req.EncryptedKey.Proof)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid capsule proof encoding"})
+				return
+			}
+			record.EncryptedKey.Proof = new(types.CapsuleProof)
+			if err := record.EncryptedKey.Proof.UnmarshalBinary(proofBytes); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid capsule proof format"})
+				return
+			}
+		}
+		record.EncryptedData = req.EncryptedData
+	}
+
+	// the proxy pairs the capsule with the re-encryption keys of the owner, so malformed or
+	// malleated capsules are rejected before they reach it
+	if err := pre.CheckCapsule(record.EncryptedKey); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid capsule"})
+		return
+	}
+	if s.requireCapsuleProof && record.EncryptedKey.Proof == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "missing capsule proof"})
+		return
+	}
+
+	id := req.RecordID
+	if id == "" {
+		var err error
+		if id, err = newRecordID(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate record id"})
+			return
+		}
+	}
+
+	if err := s.store.PutRecord(id, record); err != nil {
+		if errors.Is(err, ErrRecordOwner) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "record belongs to another owner"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to store record"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"id":     id,
+	})
+}
+
+// request re-encrypts a record for a delegatee its owner has authorized
+func (s *Server) request(c *gin.Context) {
+	var req ProxyRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	delegatee := signer(c)
+	record, err := s.store.GetRecord(req.RequestID)
+	if errors.Is(err, ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "data not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load data"})
+		return
+	}
+
+	delegation, err := s.store.GetDelegation(record.Owner, delegatee)
+	if errors.Is(err, ErrNotFound) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "delegatee is not authorized by the owner"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load delegation"})
+		return
+	}
+	// the sweeper removes expired delegations only periodically
+	if delegation.Expired(s.now()) {
+		s.audit(auditReEncryptionRefused, delegation, slog.String("record", req.RequestID), slog.String("reason", "expired"))
+		c.JSON(http.StatusForbidden, gin.H{"error": "delegation expired"})
+		return
+	}
+
+	// Perform re-encryption using the PRE proxy implementation
+	firstLevelKey, proof, err := s.proxy.ReEncryptionWithProofContext(c.Request.Context(), record.EncryptedKey, delegation.ReencryptionKey)
+	if errors.Is(err, context.DeadlineExceeded) {
+		c.JSON(http.StatusGatewayTimeout, gin.H{"error": "re-encryption timed out"})
+		return
+	}
+	if errors.Is(err, context.Canceled) {
+		// the client is gone
+		c.Abort()
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to re-encrypt data"})
+		return
+	}
+
+	proofBytes, err := proof.MarshalBinary()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to encode proof"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"first_level_key": firstLevelKey,
+		"encrypted_data":  record.EncryptedData,
+		"proof":           proofBytes,
+	})
+}
+
+// decodeFingerprint decodes a base64 public key and returns its hex fingerprint
+func decodeFingerprint(encoded string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", err
+	}
+
+	publicKey := new(types.PublicKey)
+	if err := publicKey.UnmarshalBinary(data); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(publicKey.Fingerprint()), nil
+}
+
+// decodeEnvelope decodes a base64 envelope
+func decodeEnvelope(encoded string) (*types.Envelope, error) {
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	envelope := new(types.Envelope)
+	if err := envelope.Unmarshal(data); err != nil {
+		return nil, err
+	}
+	return envelope, nil
+}
+
+// newRecordID returns a random record ID
+func newRecordID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
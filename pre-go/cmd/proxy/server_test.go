@@ -0,0 +1,643 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254"
+	"github.com/gin-gonic/gin"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre/auth"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre/mocks"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre/recovery"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre/types"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/testutils"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestServer returns a server backed by an in-memory store, whose clock reads testNow,
+// along with its routes
+func newTestServer(t *testing.T) (*Server, *gin.Engine) {
+	gin.SetMode(gin.TestMode)
+	cfg := Config{Store: storeMemory, DelegationTTL: time.Hour}
+	server := NewServer(openTestStore(t, cfg), cfg)
+	server.auditLog = slog.New(slog.NewTextHandler(io.Discard, nil))
+	server.now = func() time.Time { return testNow }
+
+	r := gin.New()
+	server.Register(r)
+	return server, r
+}
+
+// fetchNonce returns a nonce issued by the server
+func fetchNonce(t *testing.T, r http.Handler) string {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, auth.NoncePath, nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var nonce auth.Nonce
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &nonce))
+	return nonce.Nonce
+}
+
+// newSignedRequest returns a request with body as JSON, if not nil, signed by the key pair
+// over a fresh nonce
+func newSignedRequest(t *testing.T, r http.Handler, method, path string, signer *types.KeyPair, body any) *http.Request {
+	var data []byte
+	if body != nil {
+		var err error
+		data, err = json.Marshal(body)
+		require.NoError(t, err)
+	}
+
+	req := httptest.NewRequest(method, path, bytes.NewReader(data))
+	require.NoError(t, auth.SignRequest(req, signer, fetchNonce(t, r)))
+	return req
+}
+
+// serve sends the request to the route and decodes the JSON response into out, if not nil
+func serve(t *testing.T, r http.Handler, req *http.Request, out any) int {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if out != nil && w.Code == http.StatusOK {
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), out))
+	}
+	return w.Code
+}
+
+// postSigned sends body to the route signed by the key pair and decodes the JSON response
+// into out, if not nil
+func postSigned(t *testing.T, r http.Handler, path string, signer *types.KeyPair, body any, out any) int {
+	return serve(t, r, newSignedRequest(t, r, http.MethodPost, path, signer, body), out)
+}
+
+// deleteSigned sends a DELETE request to the route signed by the key pair
+func deleteSigned(t *testing.T, r http.Handler, path string, signer *types.KeyPair) int {
+	return serve(t, r, newSignedRequest(t, r, http.MethodDelete, path, signer, nil), nil)
+}
+
+func encodePublicKey(t *testing.T, pk *types.PublicKey) string {
+	data, err := pk.MarshalBinary()
+	require.NoError(t, err)
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+func encodeReKey(t *testing.T, reKey *types.ReEncryptionKey) string {
+	data, err := types.MarshalReEncryptionKey(reKey)
+	require.NoError(t, err)
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+func TestServerDelegations(t *testing.T) {
+	_, r := newTestServer(t)
+	scheme := pre.NewPreScheme()
+	alice := testutils.GenerateRandomKeyPair(scheme.Params.G2, scheme.Params.Z)
+	bob := testutils.GenerateRandomKeyPair(scheme.Params.G2, scheme.Params.Z)
+	carol := testutils.GenerateRandomKeyPair(scheme.Params.G2, scheme.Params.Z)
+
+	// alice stores two records once
+	records := map[string][]byte{}
+	for _, message := range []string{"blood test", "x-ray"} {
+		encryptedKey, encryptedMessage, err := scheme.Client.EncryptTo(alice.PublicKey, []byte(message), nil)
+		require.NoError(t, err)
+		envelope, err := types.NewEnvelope(encryptedKey, encryptedMessage).Marshal()
+		require.NoError(t, err)
+
+		var resp struct{ ID string }
+		require.Equal(t, http.StatusOK, postSigned(t, r, "/records", alice, RecordRequest{
+			Envelope: base64.StdEncoding.EncodeToString(envelope),
+		}, &resp))
+		require.NotEmpty(t, resp.ID)
+		records[resp.ID] = []byte(message)
+	}
+
+	// and authorizes bob and carol without uploading them again
+	for _, delegatee := range []*types.KeyPair{bob, carol} {
+		require.Equal(t, http.StatusOK, postSigned(t, r, "/delegations", alice, DelegationRequest{
+			DelegateePublicKey: encodePublicKey(t, delegatee.PublicKey),
+			ReencryptionKey:    encodeReKey(t, scheme.Client.GenerateReEncryptionKey(alice.SecretKey, delegatee.PublicKey)),
+		}, nil))
+	}
+
+	for id, message := range records {
+		for _, delegatee := range []*types.KeyPair{bob, carol} {
+			var resp struct {
+				FirstLevelKey *types.FirstLevelSymmetricKey `json:"first_level_key"`
+				EncryptedData []byte                        `json:"encrypted_data"`
+			}
+			require.Equal(t, http.StatusOK, postSigned(t, r, "/request", delegatee, ProxyRequest{RequestID: id}, &resp))
+
+			decrypted, err := scheme.Client.DecryptFirstLevelBytes(resp.FirstLevelKey, resp.EncryptedData, delegatee.SecretKey)
+			require.NoError(t, err)
+			require.Equal(t, message, decrypted)
+		}
+	}
+
+	t.Run("unauthorized delegatee", func(t *testing.T) {
+		mallory := testutils.GenerateRandomKeyPair(scheme.Params.G2, scheme.Params.Z)
+		for id := range records {
+			require.Equal(t, http.StatusForbidden, postSigned(t, r, "/request", mallory, ProxyRequest{RequestID: id}, nil))
+		}
+	})
+
+	t.Run("unknown record", func(t *testing.T) {
+		require.Equal(t, http.StatusNotFound, postSigned(t, r, "/request", bob, ProxyRequest{RequestID: "unknown"}, nil))
+	})
+
+	t.Run("envelope of another owner", func(t *testing.T) {
+		encryptedKey, encryptedMessage, err := scheme.Client.EncryptTo(bob.PublicKey, []byte("not alice's"), nil)
+		require.NoError(t, err)
+		envelope, err := types.NewEnvelope(encryptedKey, encryptedMessage).Marshal()
+		require.NoError(t, err)
+
+		require.Equal(t, http.StatusBadRequest, postSigned(t, r, "/records", alice, RecordRequest{
+			Envelope: base64.StdEncoding.EncodeToString(envelope),
+		}, nil))
+	})
+}
+
+func TestServerRecordComponents(t *testing.T) {
+	_, r := newTestServer(t)
+	scheme := pre.NewPreScheme()
+	alice := testutils.GenerateRandomKeyPair(scheme.Params.G2, scheme.Params.Z)
+	bob := testutils.GenerateRandomKeyPair(scheme.Params.G2, scheme.Params.Z)
+	reKey := scheme.Client.GenerateReEncryptionKey(alice.SecretKey, bob.PublicKey)
+
+	// the capsule as separate components, with the proof the bare encoding leaves out
+	encryptedKey, encryptedMessage, err := scheme.Client.EncryptTo(alice.PublicKey, []byte("record"), &types.EncryptOptions{Prove: true})
+	require.NoError(t, err)
+	first := encryptedKey.First.RawBytes()
+	second := encryptedKey.Second.Bytes()
+	proofBytes, err := encryptedKey.Proof.MarshalBinary()
+	require.NoError(t, err)
+
+	req := RecordRequest{
+		RecordID:      "record-1",
+		EncryptedData: encryptedMessage,
+	}
+	req.EncryptedKey.First = base64.StdEncoding.EncodeToString(first[:])
+	req.EncryptedKey.Second = base64.StdEncoding.EncodeToString(second[:])
+	req.EncryptedKey.Proof = base64.StdEncoding.EncodeToString(proofBytes)
+	require.Equal(t, http.StatusOK, postSigned(t, r, "/records", alice, req, nil))
+
+	var delegation struct {
+		Commitment []byte `json:"reencryption_key_commitment"`
+	}
+	require.Equal(t, http.StatusOK, postSigned(t, r, "/delegations", alice, DelegationRequest{
+		DelegateePublicKey: encodePublicKey(t, bob.PublicKey),
+		ReencryptionKey:    encodeReKey(t, reKey),
+	}, &delegation))
+
+	var resp struct {
+		FirstLevelKey *types.FirstLevelSymmetricKey `json:"first_level_key"`
+		EncryptedData []byte                        `json:"encrypted_data"`
+		Proof         []byte                        `json:"proof"`
+	}
+	require.Equal(t, http.StatusOK, postSigned(t, r, "/request", bob, ProxyRequest{RequestID: "record-1"}, &resp))
+
+	expected := scheme.Proxy.ReEncryption(encryptedKey, reKey)
+	require.True(t, expected.First.Equal(resp.FirstLevelKey.First))
+	require.True(t, expected.Second.Equal(resp.FirstLevelKey.Second))
+	require.Equal(t, encryptedMessage, resp.EncryptedData)
+	decrypted, err := scheme.Client.DecryptFirstLevelBytes(resp.FirstLevelKey, resp.EncryptedData, bob.SecretKey)
+	require.NoError(t, err)
+	require.Equal(t, []byte("record"), decrypted)
+
+	// bob checks the proof against the commitment published with the delegation
+	expectedCommitment, err := pre.ReKeyCommitment(reKey)
+	require.NoError(t, err)
+	commitment := new(bn254.GT)
+	require.NoError(t, commitment.SetBytes(delegation.Commitment))
+	require.True(t, expectedCommitment.Equal(commitment))
+
+	proof := new(types.ReEncryptionProof)
+	require.NoError(t, proof.UnmarshalBinary(resp.Proof))
+	require.NoError(t, pre.VerifyReEncryption(commitment, resp.FirstLevelKey, proof))
+	require.True(t, proof.Capsule.Equal(encryptedKey.First))
+
+	t.Run("invalid components", func(t *testing.T) {
+		invalid := req
+		invalid.EncryptedKey.First = base64.StdEncoding.EncodeToString(make([]byte, 64))
+		require.Equal(t, http.StatusBadRequest, postSigned(t, r, "/records", alice, invalid, nil))
+	})
+}
+
+func TestServerLegacyStore(t *testing.T) {
+	_, r := newTestServer(t)
+	scheme := pre.NewPreScheme()
+	legacy := mocks.NewMockPreScheme()
+	alice, bob := legacy.AliceKeyPair, legacy.BobKeyPair
+
+	require.Equal(t, http.StatusOK, postSigned(t, r, "/delegations", alice, DelegationRequest{
+		DelegateePublicKey: encodePublicKey(t, bob.PublicKey),
+		ReencryptionKey:    encodeReKey(t, legacy.ReKey),
+	}, nil))
+
+	// a request of the clients that predate /records, whose capsules have no attributes
+	encryptedKey, encryptedMessage, err := legacy.SecondLevelEncryption(alice.SecretKey, string(legacy.Message), legacy.Scalar)
+	require.NoError(t, err)
+	first := encryptedKey.First.RawBytes()
+	second := encryptedKey.Second.Bytes()
+	req := StoreRequest{
+		ReencryptionKey: encodeReKey(t, legacy.ReKey),
+		EncryptedData:   encryptedMessage,
+		UserID:          "record-1",
+	}
+	req.EncryptedKey.First = base64.StdEncoding.EncodeToString(first[:])
+	req.EncryptedKey.Second = base64.StdEncoding.EncodeToString(second[:])
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, newSignedRequest(t, r, http.MethodPost, "/store", alice, req))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "true", w.Header().Get("Deprecation"))
+
+	// stored as a record of the signer, re-encrypted with the delegation
+	var resp struct {
+		FirstLevelKey *types.FirstLevelSymmetricKey `json:"first_level_key"`
+		EncryptedData []byte                        `json:"encrypted_data"`
+	}
+	require.Equal(t, http.StatusOK, postSigned(t, r, "/request", bob, ProxyRequest{RequestID: "record-1"}, &resp))
+	decrypted, err := scheme.Client.DecryptFirstLevelBytes(resp.FirstLevelKey, resp.EncryptedData, bob.SecretKey)
+	require.NoError(t, err)
+	require.Equal(t, legacy.Message, decrypted)
+
+	// and owned by the signer like the records of /records
+	require.Equal(t, http.StatusForbidden, postSigned(t, r, "/store", bob, req, nil))
+}
+
+func TestServerRevocation(t *testing.T) {
+	server, r := newTestServer(t)
+	scheme := pre.NewPreScheme()
+	alice := testutils.GenerateRandomKeyPair(scheme.Params.G2, scheme.Params.Z)
+	bob := testutils.GenerateRandomKeyPair(scheme.Params.G2, scheme.Params.Z)
+
+	encryptedKey, encryptedMessage, err := scheme.Client.EncryptTo(alice.PublicKey, []byte("record"), nil)
+	require.NoError(t, err)
+	envelope, err := types.NewEnvelope(encryptedKey, encryptedMessage).Marshal()
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, postSigned(t, r, "/records", alice, RecordRequest{
+		RecordID: "record-1",
+		Envelope: base64.StdEncoding.EncodeToString(envelope),
+	}, nil))
+
+	delegationRequest := DelegationRequest{
+		DelegateePublicKey: encodePublicKey(t, bob.PublicKey),
+		ReencryptionKey:    encodeReKey(t, scheme.Client.GenerateReEncryptionKey(alice.SecretKey, bob.PublicKey)),
+	}
+	var delegation struct {
+		ID        string    `json:"id"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	require.Equal(t, http.StatusOK, postSigned(t, r, "/delegations", alice, delegationRequest, &delegation))
+	require.Equal(t, testNow.Add(time.Hour), delegation.ExpiresAt)
+
+	request := ProxyRequest{RequestID: "record-1"}
+	require.Equal(t, http.StatusOK, postSigned(t, r, "/request", bob, request, nil))
+
+	path := "/delegations/" + delegation.ID
+	t.Run("only the owner can revoke", func(t *testing.T) {
+		require.Equal(t, http.StatusForbidden, deleteSigned(t, r, path, bob))
+		require.Equal(t, http.StatusOK, postSigned(t, r, "/request", bob, request, nil))
+	})
+
+	t.Run("revoked delegations are refused", func(t *testing.T) {
+		require.Equal(t, http.StatusOK, deleteSigned(t, r, path, alice))
+		require.Equal(t, http.StatusForbidden, postSigned(t, r, "/request", bob, request, nil))
+		require.Equal(t, http.StatusGone, deleteSigned(t, r, path, alice))
+
+		// the revoked re-encryption key cannot be registered again
+		require.Equal(t, http.StatusConflict, postSigned(t, r, "/delegations", alice, delegationRequest, nil))
+	})
+
+	t.Run("expired delegations are refused", func(t *testing.T) {
+		carol := testutils.GenerateRandomKeyPair(scheme.Params.G2, scheme.Params.Z)
+		require.Equal(t, http.StatusOK, postSigned(t, r, "/delegations", alice, DelegationRequest{
+			DelegateePublicKey: encodePublicKey(t, carol.PublicKey),
+			ReencryptionKey:    encodeReKey(t, scheme.Client.GenerateReEncryptionKey(alice.SecretKey, carol.PublicKey)),
+			ExpiresAt:          testNow.Add(time.Minute),
+		}, nil))
+		request := ProxyRequest{RequestID: "record-1"}
+		require.Equal(t, http.StatusOK, postSigned(t, r, "/request", carol, request, nil))
+
+		server.now = func() time.Time { return testNow.Add(time.Minute) }
+		defer func() { server.now = func() time.Time { return testNow } }()
+		require.Equal(t, http.StatusForbidden, postSigned(t, r, "/request", carol, request, nil))
+
+		require.NoError(t, server.Sweep())
+		_, err := server.store.GetDelegation(hexFingerprint(alice.PublicKey), hexFingerprint(carol.PublicKey))
+		require.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("expiry in the past", func(t *testing.T) {
+		past := delegationRequest
+		past.ExpiresAt = testNow.Add(-time.Minute)
+		require.Equal(t, http.StatusBadRequest, postSigned(t, r, "/delegations", alice, past, nil))
+	})
+}
+
+func hexFingerprint(pk *types.PublicKey) string {
+	return hex.EncodeToString(pk.Fingerprint())
+}
+
+func TestServerAuthentication(t *testing.T) {
+	server, r := newTestServer(t)
+	scheme := pre.NewPreScheme()
+	alice := testutils.GenerateRandomKeyPair(scheme.Params.G2, scheme.Params.Z)
+	bob := testutils.GenerateRandomKeyPair(scheme.Params.G2, scheme.Params.Z)
+
+	encryptedKey, encryptedMessage, err := scheme.Client.EncryptTo(alice.PublicKey, []byte("record"), nil)
+	require.NoError(t, err)
+	envelope, err := types.NewEnvelope(encryptedKey, encryptedMessage).Marshal()
+	require.NoError(t, err)
+	record := RecordRequest{RecordID: "record-1", Envelope: base64.StdEncoding.EncodeToString(envelope)}
+
+	t.Run("unsigned", func(t *testing.T) {
+		data, err := json.Marshal(record)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusUnauthorized, serve(t, r, httptest.NewRequest(http.MethodPost, "/records", bytes.NewReader(data)), nil))
+	})
+
+	t.Run("unknown nonce", func(t *testing.T) {
+		data, err := json.Marshal(record)
+		require.NoError(t, err)
+		req := httptest.NewRequest(http.MethodPost, "/records", bytes.NewReader(data))
+		require.NoError(t, auth.SignRequest(req, alice, "chosen by the client"))
+		require.Equal(t, http.StatusUnauthorized, serve(t, r, req, nil))
+	})
+
+	t.Run("tampered body", func(t *testing.T) {
+		req := newSignedRequest(t, r, http.MethodPost, "/records", alice, record)
+		req.Body = io.NopCloser(bytes.NewReader([]byte(`{"record_id":"record-2"}`)))
+		require.Equal(t, http.StatusUnauthorized, serve(t, r, req, nil))
+	})
+
+	t.Run("replayed", func(t *testing.T) {
+		data, err := json.Marshal(record)
+		require.NoError(t, err)
+		req := httptest.NewRequest(http.MethodPost, "/records", bytes.NewReader(data))
+		require.NoError(t, auth.SignRequest(req, alice, fetchNonce(t, r)))
+		replay := req.Clone(req.Context())
+		replay.Body = io.NopCloser(bytes.NewReader(data))
+
+		require.Equal(t, http.StatusOK, serve(t, r, req, nil))
+		require.Equal(t, http.StatusUnauthorized, serve(t, r, replay, nil))
+	})
+
+	t.Run("expired nonce", func(t *testing.T) {
+		req := newSignedRequest(t, r, http.MethodPost, "/records", alice, record)
+		server.now = func() time.Time { return testNow.Add(nonceTTL) }
+		defer func() { server.now = func() time.Time { return testNow } }()
+		require.Equal(t, http.StatusUnauthorized, serve(t, r, req, nil))
+	})
+
+	t.Run("record of another owner", func(t *testing.T) {
+		encryptedKey, encryptedMessage, err := scheme.Client.EncryptTo(bob.PublicKey, []byte("overwritten"), nil)
+		require.NoError(t, err)
+		envelope, err := types.NewEnvelope(encryptedKey, encryptedMessage).Marshal()
+		require.NoError(t, err)
+
+		require.Equal(t, http.StatusForbidden, postSigned(t, r, "/records", bob, RecordRequest{
+			RecordID: "record-1",
+			Envelope: base64.StdEncoding.EncodeToString(envelope),
+		}, nil))
+	})
+
+	t.Run("body too large", func(t *testing.T) {
+		server.maxBodySize = 16
+		defer func() { server.maxBodySize = defaultMaxBodySize }()
+		require.Equal(t, http.StatusRequestEntityTooLarge, postSigned(t, r, "/records", alice, record, nil))
+	})
+
+	t.Run("client", func(t *testing.T) {
+		ts := httptest.NewServer(r)
+		defer ts.Close()
+
+		resp, err := auth.NewClient(ts.URL, alice).Do(http.MethodPost, "/delegations", DelegationRequest{
+			DelegateePublicKey: encodePublicKey(t, bob.PublicKey),
+			ReencryptionKey:    encodeReKey(t, scheme.Client.GenerateReEncryptionKey(alice.SecretKey, bob.PublicKey)),
+		})
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		resp, err = auth.NewClient(ts.URL, bob).Do(http.MethodPost, "/request", ProxyRequest{RequestID: "record-1"})
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		var reEncrypted struct {
+			FirstLevelKey *types.FirstLevelSymmetricKey `json:"first_level_key"`
+			EncryptedData []byte                        `json:"encrypted_data"`
+		}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&reEncrypted))
+		decrypted, err := scheme.Client.DecryptFirstLevelBytes(reEncrypted.FirstLevelKey, reEncrypted.EncryptedData, bob.SecretKey)
+		require.NoError(t, err)
+		require.Equal(t, []byte("record"), decrypted)
+	})
+}
+
+func TestServerNonceLimits(t *testing.T) {
+	server, r := newTestServer(t)
+	server.nonces = newNonces(3, 2)
+
+	issue := func(client string) int {
+		req := httptest.NewRequest(http.MethodPost, auth.NoncePath, nil)
+		req.RemoteAddr = client + ":1234"
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	require.Equal(t, http.StatusOK, issue("192.0.2.1"))
+	require.Equal(t, http.StatusOK, issue("192.0.2.1"))
+	require.Equal(t, http.StatusServiceUnavailable, issue("192.0.2.1"))
+	require.Equal(t, http.StatusOK, issue("192.0.2.2"))
+	require.Equal(t, http.StatusServiceUnavailable, issue("192.0.2.3"))
+
+	// expired nonces are released
+	require.NoError(t, server.Sweep())
+	require.Equal(t, http.StatusServiceUnavailable, issue("192.0.2.3"))
+	server.now = func() time.Time { return testNow.Add(nonceTTL) }
+	require.NoError(t, server.Sweep())
+	require.Equal(t, http.StatusOK, issue("192.0.2.3"))
+	require.Equal(t, http.StatusOK, issue("192.0.2.1"))
+}
+
+func TestServerRequestTimeout(t *testing.T) {
+	server, r := newTestServer(t)
+	scheme := pre.NewPreScheme()
+	alice := testutils.GenerateRandomKeyPair(scheme.Params.G2, scheme.Params.Z)
+	bob := testutils.GenerateRandomKeyPair(scheme.Params.G2, scheme.Params.Z)
+
+	encryptedKey, encryptedMessage, err := scheme.Client.EncryptTo(alice.PublicKey, []byte("record"), nil)
+	require.NoError(t, err)
+	envelope, err := types.NewEnvelope(encryptedKey, encryptedMessage).Marshal()
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, postSigned(t, r, "/records", alice, RecordRequest{
+		RecordID: "record-1",
+		Envelope: base64.StdEncoding.EncodeToString(envelope),
+	}, nil))
+	require.Equal(t, http.StatusOK, postSigned(t, r, "/delegations", alice, DelegationRequest{
+		DelegateePublicKey: encodePublicKey(t, bob.PublicKey),
+		ReencryptionKey:    encodeReKey(t, scheme.Client.GenerateReEncryptionKey(alice.SecretKey, bob.PublicKey)),
+	}, nil))
+	request := ProxyRequest{RequestID: "record-1"}
+
+	t.Run("deadline", func(t *testing.T) {
+		server.requestTimeout = time.Nanosecond
+		defer func() { server.requestTimeout = 0 }()
+		require.Equal(t, http.StatusGatewayTimeout, postSigned(t, r, "/request", bob, request, nil))
+	})
+
+	t.Run("client gone", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		req := newSignedRequest(t, r, http.MethodPost, "/request", bob, request)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req.WithContext(ctx))
+		require.Empty(t, w.Body.Bytes())
+	})
+
+	require.Equal(t, http.StatusOK, postSigned(t, r, "/request", bob, request, nil))
+}
+
+func TestServerCapsuleChecks(t *testing.T) {
+	server, r := newTestServer(t)
+	scheme := pre.NewPreScheme()
+	alice := testutils.GenerateRandomKeyPair(scheme.Params.G2, scheme.Params.Z)
+
+	putEnvelope := func(id string, encryptedKey *types.SecondLevelSymmetricKey, encryptedMessage []byte) int {
+		envelope, err := types.NewEnvelope(encryptedKey, encryptedMessage).Marshal()
+		require.NoError(t, err)
+		return postSigned(t, r, "/records", alice, RecordRequest{
+			RecordID: id,
+			Envelope: base64.StdEncoding.EncodeToString(envelope),
+		}, nil)
+	}
+
+	opts := &types.EncryptOptions{Context: []byte("record-1"), Prove: true}
+	encryptedKey, encryptedMessage, err := scheme.Client.EncryptTo(alice.PublicKey, []byte("record"), opts)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, putEnvelope("record-1", encryptedKey, encryptedMessage))
+
+	t.Run("malleated capsule", func(t *testing.T) {
+		// mauling the masked key is invisible to the proxy without the proof
+		malleated := *encryptedKey
+		malleated.Second = new(bn254.GT).Square(encryptedKey.Second)
+		require.Equal(t, http.StatusBadRequest, putEnvelope("record-2", &malleated, encryptedMessage))
+
+		malleated = *encryptedKey
+		malleated.Context = []byte("record-2")
+		require.Equal(t, http.StatusBadRequest, putEnvelope("record-2", &malleated, encryptedMessage))
+	})
+
+	t.Run("components with proof", func(t *testing.T) {
+		first := encryptedKey.First.Bytes()
+		second := encryptedKey.Second.Bytes()
+		proof, err := encryptedKey.Proof.MarshalBinary()
+		require.NoError(t, err)
+
+		// the components carry no context, which the proof covers
+		req := RecordRequest{RecordID: "record-3", EncryptedData: encryptedMessage}
+		req.EncryptedKey.First = base64.StdEncoding.EncodeToString(first[:])
+		req.EncryptedKey.Second = base64.StdEncoding.EncodeToString(second[:])
+		req.EncryptedKey.Proof = base64.StdEncoding.EncodeToString(proof)
+		require.Equal(t, http.StatusBadRequest, postSigned(t, r, "/records", alice, req, nil))
+
+		req.EncryptedKey.Context = base64.StdEncoding.EncodeToString(encryptedKey.Context)
+		require.Equal(t, http.StatusOK, postSigned(t, r, "/records", alice, req, nil))
+
+		req.EncryptedKey.Proof = base64.StdEncoding.EncodeToString(proof[:16])
+		require.Equal(t, http.StatusBadRequest, postSigned(t, r, "/records", alice, req, nil))
+	})
+
+	t.Run("required proof", func(t *testing.T) {
+		server.requireCapsuleProof = true
+		defer func() { server.requireCapsuleProof = false }()
+
+		unproven, encryptedMessage, err := scheme.Client.EncryptTo(alice.PublicKey, []byte("record"), nil)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusBadRequest, putEnvelope("record-4", unproven, encryptedMessage))
+		require.Equal(t, http.StatusOK, putEnvelope("record-1", encryptedKey, encryptedMessage))
+	})
+}
+
+func TestServerRecovery(t *testing.T) {
+	_, r := newTestServer(t)
+	scheme := pre.NewPreScheme()
+	alice := testutils.GenerateRandomKeyPair(scheme.Params.G2, scheme.Params.Z)
+	guardians := make([]*types.KeyPair, 3)
+	publicKeys := make([]*types.PublicKey, len(guardians))
+	for i := range guardians {
+		guardians[i] = testutils.GenerateRandomKeyPair(scheme.Params.G2, scheme.Params.Z)
+		publicKeys[i] = guardians[i].PublicKey
+	}
+
+	kit, err := recovery.NewKit(scheme.Params, alice.SecretKey, publicKeys, 2)
+	require.NoError(t, err)
+	kitBytes, err := kit.MarshalBinary()
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, postSigned(t, r, "/recovery/kits", alice, RecoveryKitRequest{
+		Kit: base64.StdEncoding.EncodeToString(kitBytes),
+	}, nil))
+
+	// alice loses the device and recovers from a new key pair
+	device := testutils.GenerateRandomKeyPair(scheme.Params.G2, scheme.Params.Z)
+	owner := hexFingerprint(alice.PublicKey)
+	approve := func(guardian *types.KeyPair) int {
+		return postSigned(t, r, "/recovery/approvals", guardian, RecoveryApprovalRequest{
+			Owner:              owner,
+			RecovererPublicKey: encodePublicKey(t, device.PublicKey),
+			ReencryptionKey:    encodeReKey(t, scheme.Client.GenerateReEncryptionKey(guardian.SecretKey, device.PublicKey)),
+		}, nil)
+	}
+
+	require.Equal(t, http.StatusOK, approve(guardians[2]))
+	require.Equal(t, http.StatusForbidden, postSigned(t, r, "/recovery/shares", device, RecoveryRequest{Owner: owner}, nil))
+
+	require.Equal(t, http.StatusOK, approve(guardians[0]))
+	var resp struct {
+		Kit       string `json:"kit"`
+		Approvals int    `json:"approvals"`
+	}
+	require.Equal(t, http.StatusOK, postSigned(t, r, "/recovery/shares", device, RecoveryRequest{Owner: owner}, &resp))
+	require.Equal(t, 2, resp.Approvals)
+
+	data, err := base64.StdEncoding.DecodeString(resp.Kit)
+	require.NoError(t, err)
+	recovered := new(recovery.Kit)
+	require.NoError(t, recovered.UnmarshalBinary(data))
+	keyPair, err := recovered.Recover(scheme.Params, device.SecretKey)
+	require.NoError(t, err)
+	require.Equal(t, alice.SecretKey, keyPair.SecretKey)
+
+	t.Run("not a guardian", func(t *testing.T) {
+		mallory := testutils.GenerateRandomKeyPair(scheme.Params.G2, scheme.Params.Z)
+		require.Equal(t, http.StatusForbidden, approve(mallory))
+
+		// the approvals for the device do not let anyone else in
+		require.Equal(t, http.StatusForbidden, postSigned(t, r, "/recovery/shares", mallory, RecoveryRequest{Owner: owner}, nil))
+	})
+
+	t.Run("unknown owner", func(t *testing.T) {
+		require.Equal(t, http.StatusNotFound, postSigned(t, r, "/recovery/shares", device, RecoveryRequest{Owner: "unknown"}, nil))
+	})
+
+	t.Run("kit of another owner", func(t *testing.T) {
+		require.Equal(t, http.StatusBadRequest, postSigned(t, r, "/recovery/kits", guardians[0], RecoveryKitRequest{
+			Kit: base64.StdEncoding.EncodeToString(kitBytes),
+		}, nil))
+		require.Equal(t, http.StatusBadRequest, postSigned(t, r, "/recovery/kits", alice, RecoveryKitRequest{
+			Kit: base64.StdEncoding.EncodeToString(kitBytes[:100]),
+		}, nil))
+	})
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre/recovery"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre/types"
+)
+
+var (
+	// ErrNotFound is returned by Store and BlobStore lookups for IDs with no data
+	ErrNotFound = errors.New("not found")
+
+	// ErrRevoked is returned by Store.PutDelegation for re-encryption keys that were revoked
+	ErrRevoked = errors.New("delegation was revoked")
+
+	// ErrDelegationConflict is returned by Store.PutDelegation for re-encryption keys already
+	// registered between other parties
+	ErrDelegationConflict = errors.New("delegation ID is registered between other parties")
+
+	// ErrRecordOwner is returned by Store.PutRecord for IDs holding a record of another owner
+	ErrRecordOwner = errors.New("record belongs to another owner")
+)
+
+// Record is an encrypted record of a data owner: the second-level encrypted key (capsule)
+// and the encrypted payload. It can be re-encrypted for any delegatee the owner authorized.
+type Record struct {
+	Owner         string                         `json:"owner"`  // hex PublicKey.Fingerprint of the data owner
+	Scheme        types.SchemeID                 `json:"scheme"` // Scheme of the capsule, see types.Envelope
+	EncryptedKey  *types.SecondLevelSymmetricKey `json:"encrypted_key"`
+	EncryptedData []byte                         `json:"encrypted_data"`
+}
+
+// Delegation authorizes the proxy to re-encrypt the records of Owner for Delegatee until ExpiresAt
+type Delegation struct {
+	ID              string                 `json:"id"`        // DelegationID of the re-encryption key
+	Owner           string                 `json:"owner"`     // hex PublicKey.Fingerprint of the data owner
+	Delegatee       string                 `json:"delegatee"` // hex PublicKey.Fingerprint of the delegatee
+	ReencryptionKey *types.ReEncryptionKey `json:"reencryption_key"`
+	ExpiresAt       time.Time              `json:"expires_at"`
+}
+
+// Expired reports whether the delegation is no longer valid at now
+func (d Delegation) Expired(now time.Time) bool {
+	return !now.Before(d.ExpiresAt)
+}
+
+// Tombstone records the revocation of a delegation. It outlives the delegation, so the
+// revoked re-encryption key cannot be registered again, and serves as its audit record.
+type Tombstone struct {
+	ID        string    `json:"id"`
+	Owner     string    `json:"owner"`
+	Delegatee string    `json:"delegatee"`
+	RevokedAt time.Time `json:"revoked_at"`
+}
+
+// DelegationID returns the ID of the delegation holding the re-encryption key: the hex
+// SHA-256 of its canonical encoding. The re-encryption key from one key pair to another
+// is deterministic, so the ID identifies the grant itself.
+func DelegationID(reKey *types.ReEncryptionKey) (string, error) {
+	data, err := types.MarshalReEncryptionKey(reKey)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Store persists the records and delegations served by the proxy.
+// Implementations must be safe for concurrent use.
+type Store interface {
+	// PutRecord saves the record under id, replacing the previous record of the same owner.
+	// It returns an error wrapping ErrRecordOwner if id holds a record of another owner; the
+	// check and the write are atomic.
+	PutRecord(id string, record Record) error
+
+	// GetRecord returns the record stored under id, or an error wrapping ErrNotFound
+	GetRecord(id string) (Record, error)
+
+	// DeleteRecord removes the record stored under id. Deleting a missing id is not an error.
+	DeleteRecord(id string) error
+
+	// PutDelegation saves the delegation, replacing the previous one between the same parties.
+	// It returns an error wrapping ErrRevoked if a tombstone exists for the ID of the delegation,
+	// and one wrapping ErrDelegationConflict if the ID belongs to a delegation between other
+	// parties, which revoking the ID would otherwise leave behind.
+	PutDelegation(delegation Delegation) error
+
+	// GetDelegation returns the delegation from owner to delegatee, or an error wrapping ErrNotFound
+	GetDelegation(owner, delegatee string) (Delegation, error)
+
+	// GetDelegationByID returns the delegation with the given ID, or an error wrapping ErrNotFound
+	GetDelegationByID(id string) (Delegation, error)
+
+	// DeleteDelegation removes the delegation from owner to delegatee.
+	// Deleting a missing delegation is not an error.
+	DeleteDelegation(owner, delegatee string) error
+
+	// RevokeDelegation removes the delegation with the ID of the tombstone and saves the
+	// tombstone, atomically. It returns an error wrapping ErrNotFound if there is no such delegation.
+	RevokeDelegation(tombstone Tombstone) error
+
+	// GetTombstone returns the tombstone of the delegation with the given ID, or an error
+	// wrapping ErrNotFound
+	GetTombstone(id string) (Tombstone, error)
+
+	// DeleteExpiredDelegations removes the delegations expired at now and returns them
+	DeleteExpiredDelegations(now time.Time) ([]Delegation, error)
+
+	// PutRecoveryKit saves the recovery kit of owner, replacing the previous one along with
+	// the approvals it had
+	PutRecoveryKit(owner string, kit *recovery.Kit) error
+
+	// GetRecoveryKit returns the recovery kit of owner, or an error wrapping ErrNotFound
+	GetRecoveryKit(owner string) (*recovery.Kit, error)
+
+	// ApproveRecovery adds key, the share of guardian re-encrypted for recoverer, to the
+	// recovery kit of owner, atomically. It returns an error wrapping ErrNotFound if owner
+	// has no kit or guardian is not one of its guardians.
+	ApproveRecovery(owner, guardian, recoverer string, key *types.FirstLevelSymmetricKey) error
+
+	// Close releases the resources held by the store
+	Close() error
+}
+
+// BlobStore persists encrypted payloads, which may be too large to keep in the Store itself.
+// Implementations must be safe for concurrent use.
+type BlobStore interface {
+	// PutBlob saves the blob under id, replacing anything stored there before
+	PutBlob(id string, data []byte) error
+
+	// GetBlob returns the blob stored under id, or an error wrapping ErrNotFound
+	GetBlob(id string) ([]byte, error)
+
+	// DeleteBlob removes the blob stored under id. Deleting a missing id is not an error.
+	DeleteBlob(id string) error
+}
+
+// blobBackedStore keeps the encrypted payloads of a Store in a BlobStore
+type blobBackedStore struct {
+	Store
+	blobs BlobStore
+}
+
+// WithBlobStore returns a Store that saves delegations and capsules in store and the
+// encrypted payloads in blobs
+func WithBlobStore(store Store, blobs BlobStore) Store {
+	return &blobBackedStore{Store: store, blobs: blobs}
+}
+
+// PutRecord saves the payload first, so the record never points at a missing blob. Payloads
+// are stored under the owner along with the ID, so the payload written for a record refused
+// by the underlying store never replaces the one of another owner.
+func (s *blobBackedStore) PutRecord(id string, record Record) error {
+	blobID := recordBlobID(record.Owner, id)
+	if err := s.blobs.PutBlob(blobID, record.EncryptedData); err != nil {
+		return err
+	}
+
+	record.EncryptedData = nil
+	if err := s.Store.PutRecord(id, record); err != nil {
+		if errors.Is(err, ErrRecordOwner) {
+			_ = s.blobs.DeleteBlob(blobID) // #nosec G104 -- the orphaned payload is never read
+		}
+		return err
+	}
+	return nil
+}
+
+// GetRecord returns the record of the underlying store along with its payload
+func (s *blobBackedStore) GetRecord(id string) (Record, error) {
+	record, err := s.Store.GetRecord(id)
+	if err != nil {
+		return Record{}, err
+	}
+
+	if record.EncryptedData, err = s.blobs.GetBlob(recordBlobID(record.Owner, id)); err != nil {
+		return Record{}, fmt.Errorf("payload of %q: %w", id, err)
+	}
+	return record, nil
+}
+
+// DeleteRecord removes the record before the payload, so the record never points at a missing blob
+func (s *blobBackedStore) DeleteRecord(id string) error {
+	record, err := s.Store.GetRecord(id)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := s.Store.DeleteRecord(id); err != nil {
+		return err
+	}
+
+	return s.blobs.DeleteBlob(recordBlobID(record.Owner, id))
+}
+
+// recordBlobID returns the ID of the payload of the record of owner stored under id.
+// Owners are hex fingerprints, so the separator cannot occur in them.
+func recordBlobID(owner, id string) string {
+	return owner + "/" + id
+}
+
+// marshalCapsule encodes the capsule of a record along with its scheme and attributes, as an
+// envelope without payload
+func marshalCapsule(record Record) ([]byte, error) {
+	return types.NewEnvelopeFor(record.Scheme, record.EncryptedKey, nil).Marshal()
+}
+
+// unmarshalCapsule decodes the capsule and scheme written by marshalCapsule into record
+func unmarshalCapsule(record *Record, data []byte) error {
+	envelope := new(types.Envelope)
+	if err := envelope.Unmarshal(data); err != nil {
+		return err
+	}
+
+	record.Scheme, record.EncryptedKey = envelope.Scheme, envelope.Capsule
+	return nil
+}
+
+// approveRecovery adds the re-encrypted share of the guardian to the serialized recovery kit
+// and returns the kit serialized again. Fingerprints are hex.
+func approveRecovery(data []byte, guardian, recoverer string, key *types.FirstLevelSymmetricKey) ([]byte, error) {
+	kit := new(recovery.Kit)
+	if err := kit.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+
+	guardianBytes, err := hex.DecodeString(guardian)
+	if err != nil {
+		return nil, err
+	}
+	recovererBytes, err := hex.DecodeString(recoverer)
+	if err != nil {
+		return nil, err
+	}
+
+	envelope := kit.Guardian(guardianBytes)
+	if envelope == nil {
+		return nil, fmt.Errorf("guardian %s: %w", guardian, ErrNotFound)
+	}
+	if err := envelope.SetRecipient(recovererBytes, key); err != nil {
+		return nil, err
+	}
+	return kit.MarshalBinary()
+}
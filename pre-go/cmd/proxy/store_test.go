@@ -0,0 +1,351 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre/recovery"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre/types"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/testutils"
+	"github.com/stretchr/testify/require"
+)
+
+// storeBackends opens every backend selectable with Config
+var storeBackends = map[string]func(t *testing.T) Store{
+	"memory": func(t *testing.T) Store {
+		return openTestStore(t, Config{Store: storeMemory})
+	},
+	"bolt": func(t *testing.T) Store {
+		return openTestStore(t, Config{Store: storeBolt, BoltPath: filepath.Join(t.TempDir(), "proxy.db")})
+	},
+	"memory with blob directory": func(t *testing.T) Store {
+		return openTestStore(t, Config{Store: storeMemory, BlobDir: t.TempDir()})
+	},
+	"bolt with blob directory": func(t *testing.T) Store {
+		return openTestStore(t, Config{Store: storeBolt, BoltPath: filepath.Join(t.TempDir(), "proxy.db"), BlobDir: t.TempDir()})
+	},
+}
+
+func openTestStore(t *testing.T, cfg Config) Store {
+	store, err := OpenStore(cfg)
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, store.Close()) })
+	return store
+}
+
+func newTestRecord(payload string) Record {
+	capsule := testutils.GenerateMockSecondLevelCipherText(0)
+	capsule.Owner = []byte("owner fingerprint")
+	capsule.Context = []byte("record context")
+
+	return Record{
+		Owner:         "alice",
+		Scheme:        types.SchemeBN254,
+		EncryptedKey:  capsule,
+		EncryptedData: []byte(payload),
+	}
+}
+
+// testNow is the time the delegations of the tests are checked against
+var testNow = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func newTestDelegation(t *testing.T, owner, delegatee string) Delegation {
+	reKey := testutils.GenerateRandomG2Elem()
+	id, err := DelegationID(reKey)
+	require.NoError(t, err)
+
+	return Delegation{
+		ID:              id,
+		Owner:           owner,
+		Delegatee:       delegatee,
+		ReencryptionKey: reKey,
+		ExpiresAt:       testNow.Add(time.Hour),
+	}
+}
+
+// newTestRecoveryKit returns a recovery kit of a random owner split between two guardians,
+// along with the hex fingerprints of the guardians
+func newTestRecoveryKit(t *testing.T) (*recovery.Kit, []string) {
+	scheme := pre.NewPreScheme()
+	owner := testutils.GenerateRandomKeyPair(scheme.Params.G2, scheme.Params.Z)
+	var guardians []*types.PublicKey
+	var fingerprints []string
+	for range 2 {
+		guardian := testutils.GenerateRandomKeyPair(scheme.Params.G2, scheme.Params.Z)
+		guardians = append(guardians, guardian.PublicKey)
+		fingerprints = append(fingerprints, hex.EncodeToString(guardian.PublicKey.Fingerprint()))
+	}
+
+	kit, err := recovery.NewKit(scheme.Params, owner.SecretKey, guardians, 2)
+	require.NoError(t, err)
+	return kit, fingerprints
+}
+
+func TestStoreConformance(t *testing.T) {
+	for name, open := range storeBackends {
+		t.Run(name, func(t *testing.T) {
+			store := open(t)
+
+			t.Run("put and get record", func(t *testing.T) {
+				record := newTestRecord("encrypted payload")
+				require.NoError(t, store.PutRecord("record-1", record))
+
+				stored, err := store.GetRecord("record-1")
+				require.NoError(t, err)
+				require.Equal(t, record, stored)
+			})
+
+			t.Run("missing record", func(t *testing.T) {
+				_, err := store.GetRecord("nothing")
+				require.ErrorIs(t, err, ErrNotFound)
+			})
+
+			t.Run("put record replaces", func(t *testing.T) {
+				require.NoError(t, store.PutRecord("record-2", newTestRecord("first")))
+				replacement := newTestRecord("second")
+				require.NoError(t, store.PutRecord("record-2", replacement))
+
+				stored, err := store.GetRecord("record-2")
+				require.NoError(t, err)
+				require.Equal(t, replacement, stored)
+			})
+
+			t.Run("record of another owner", func(t *testing.T) {
+				require.NoError(t, store.PutRecord("record-5", newTestRecord("alice's")))
+				mallory := newTestRecord("mallory's")
+				mallory.Owner = "mallory"
+				require.ErrorIs(t, store.PutRecord("record-5", mallory), ErrRecordOwner)
+
+				stored, err := store.GetRecord("record-5")
+				require.NoError(t, err)
+				require.Equal(t, "alice", stored.Owner)
+				require.Equal(t, []byte("alice's"), stored.EncryptedData)
+			})
+
+			t.Run("delete record", func(t *testing.T) {
+				require.NoError(t, store.PutRecord("record-3", newTestRecord("payload")))
+				require.NoError(t, store.DeleteRecord("record-3"))
+
+				_, err := store.GetRecord("record-3")
+				require.ErrorIs(t, err, ErrNotFound)
+				require.NoError(t, store.DeleteRecord("record-3"))
+			})
+
+			t.Run("stored record is not aliased", func(t *testing.T) {
+				record := newTestRecord("payload")
+				require.NoError(t, store.PutRecord("record-4", record))
+				record.EncryptedData[0] = 'X'
+
+				stored, err := store.GetRecord("record-4")
+				require.NoError(t, err)
+				require.Equal(t, []byte("payload"), stored.EncryptedData)
+			})
+
+			t.Run("delegations", func(t *testing.T) {
+				toBob := newTestDelegation(t, "alice", "bob")
+				toCarol := newTestDelegation(t, "alice", "carol")
+				require.NoError(t, store.PutDelegation(toBob))
+				require.NoError(t, store.PutDelegation(toCarol))
+
+				stored, err := store.GetDelegation("alice", "bob")
+				require.NoError(t, err)
+				require.Equal(t, toBob, stored)
+
+				_, err = store.GetDelegation("bob", "alice")
+				require.ErrorIs(t, err, ErrNotFound)
+
+				replacement := newTestDelegation(t, "alice", "bob")
+				require.NoError(t, store.PutDelegation(replacement))
+				stored, err = store.GetDelegation("alice", "bob")
+				require.NoError(t, err)
+				require.Equal(t, replacement, stored)
+
+				require.NoError(t, store.DeleteDelegation("alice", "bob"))
+				_, err = store.GetDelegation("alice", "bob")
+				require.ErrorIs(t, err, ErrNotFound)
+				require.NoError(t, store.DeleteDelegation("alice", "bob"))
+				require.NoError(t, store.DeleteDelegation("nobody", "bob"))
+
+				stored, err = store.GetDelegation("alice", "carol")
+				require.NoError(t, err)
+				require.Equal(t, toCarol, stored)
+			})
+
+			t.Run("delegations by ID", func(t *testing.T) {
+				first := newTestDelegation(t, "dave", "erin")
+				require.NoError(t, store.PutDelegation(first))
+
+				stored, err := store.GetDelegationByID(first.ID)
+				require.NoError(t, err)
+				require.Equal(t, first, stored)
+
+				// a new re-encryption key between the same parties replaces the old ID
+				second := newTestDelegation(t, "dave", "erin")
+				require.NoError(t, store.PutDelegation(second))
+				_, err = store.GetDelegationByID(first.ID)
+				require.ErrorIs(t, err, ErrNotFound)
+				stored, err = store.GetDelegationByID(second.ID)
+				require.NoError(t, err)
+				require.Equal(t, second, stored)
+
+				require.NoError(t, store.DeleteDelegation("dave", "erin"))
+				_, err = store.GetDelegationByID(second.ID)
+				require.ErrorIs(t, err, ErrNotFound)
+			})
+
+			t.Run("delegation ID of other parties", func(t *testing.T) {
+				delegation := newTestDelegation(t, "kate", "liam")
+				require.NoError(t, store.PutDelegation(delegation))
+
+				// the same re-encryption key cannot be bound to other parties, whose
+				// delegation would outlive the revocation of the ID
+				for _, parties := range [][2]string{{"mallory", "liam"}, {"kate", "mallory"}} {
+					rebound := delegation
+					rebound.Owner, rebound.Delegatee = parties[0], parties[1]
+					require.ErrorIs(t, store.PutDelegation(rebound), ErrDelegationConflict)
+					_, err := store.GetDelegation(parties[0], parties[1])
+					require.ErrorIs(t, err, ErrNotFound)
+				}
+
+				stored, err := store.GetDelegationByID(delegation.ID)
+				require.NoError(t, err)
+				require.Equal(t, delegation, stored)
+
+				// renewing the delegation between the same parties is fine
+				delegation.ExpiresAt = delegation.ExpiresAt.Add(time.Hour)
+				require.NoError(t, store.PutDelegation(delegation))
+
+				tombstone := Tombstone{ID: delegation.ID, Owner: "kate", Delegatee: "liam", RevokedAt: testNow}
+				require.NoError(t, store.RevokeDelegation(tombstone))
+				_, err = store.GetDelegation("kate", "liam")
+				require.ErrorIs(t, err, ErrNotFound)
+			})
+
+			t.Run("revoke delegation", func(t *testing.T) {
+				delegation := newTestDelegation(t, "frank", "grace")
+				require.NoError(t, store.PutDelegation(delegation))
+
+				tombstone := Tombstone{ID: delegation.ID, Owner: "frank", Delegatee: "grace", RevokedAt: testNow}
+				require.NoError(t, store.RevokeDelegation(tombstone))
+				require.ErrorIs(t, store.RevokeDelegation(tombstone), ErrNotFound)
+
+				_, err := store.GetDelegation("frank", "grace")
+				require.ErrorIs(t, err, ErrNotFound)
+				_, err = store.GetDelegationByID(delegation.ID)
+				require.ErrorIs(t, err, ErrNotFound)
+
+				stored, err := store.GetTombstone(delegation.ID)
+				require.NoError(t, err)
+				require.Equal(t, tombstone, stored)
+
+				// the revoked re-encryption key cannot be registered again
+				require.ErrorIs(t, store.PutDelegation(delegation), ErrRevoked)
+
+				_, err = store.GetTombstone("unknown")
+				require.ErrorIs(t, err, ErrNotFound)
+			})
+
+			t.Run("delete expired delegations", func(t *testing.T) {
+				expired := newTestDelegation(t, "heidi", "ivan")
+				expired.ExpiresAt = testNow.Add(-time.Second)
+				valid := newTestDelegation(t, "heidi", "judy")
+				require.NoError(t, store.PutDelegation(expired))
+				require.NoError(t, store.PutDelegation(valid))
+
+				deleted, err := store.DeleteExpiredDelegations(testNow)
+				require.NoError(t, err)
+				require.Equal(t, []Delegation{expired}, deleted)
+
+				_, err = store.GetDelegation("heidi", "ivan")
+				require.ErrorIs(t, err, ErrNotFound)
+				_, err = store.GetDelegationByID(expired.ID)
+				require.ErrorIs(t, err, ErrNotFound)
+				_, err = store.GetDelegation("heidi", "judy")
+				require.NoError(t, err)
+
+				// expiry leaves no tombstone, the owner may renew the delegation
+				require.NoError(t, store.PutDelegation(expired))
+			})
+
+			t.Run("recovery kits", func(t *testing.T) {
+				kit, guardians := newTestRecoveryKit(t)
+				require.NoError(t, store.PutRecoveryKit("owner", kit))
+
+				stored, err := store.GetRecoveryKit("owner")
+				require.NoError(t, err)
+				require.Equal(t, kit, stored)
+				_, err = store.GetRecoveryKit("nobody")
+				require.ErrorIs(t, err, ErrNotFound)
+
+				recoverer := hex.EncodeToString([]byte("recoverer"))
+				key := pre.NewProxy().ReEncryption(kit.Guardians[1].Capsule, testutils.GenerateRandomG2Elem())
+				require.NoError(t, store.ApproveRecovery("owner", guardians[1], recoverer, key))
+				stored, err = store.GetRecoveryKit("owner")
+				require.NoError(t, err)
+				require.Equal(t, 1, stored.Approvals([]byte("recoverer")))
+				require.NotNil(t, stored.Guardians[1].RecipientKey([]byte("recoverer")))
+
+				require.ErrorIs(t, store.ApproveRecovery("nobody", guardians[1], recoverer, key), ErrNotFound)
+				require.ErrorIs(t, store.ApproveRecovery("owner", recoverer, recoverer, key), ErrNotFound)
+				// the key of one guardian does not fit the envelope of another
+				require.ErrorIs(t, store.ApproveRecovery("owner", guardians[0], recoverer, key), types.ErrMalformedCapsule)
+
+				// a new kit drops the approvals
+				require.NoError(t, store.PutRecoveryKit("owner", kit))
+				stored, err = store.GetRecoveryKit("owner")
+				require.NoError(t, err)
+				require.Zero(t, stored.Approvals([]byte("recoverer")))
+			})
+
+			t.Run("concurrent use", func(t *testing.T) {
+				var wg sync.WaitGroup
+				for i := 0; i < 8; i++ {
+					wg.Add(1)
+					go func(id string) {
+						defer wg.Done()
+						record := newTestRecord(id)
+						require.NoError(t, store.PutRecord(id, record))
+						require.NoError(t, store.PutDelegation(newTestDelegation(t, "alice", id)))
+						stored, err := store.GetRecord(id)
+						require.NoError(t, err)
+						require.Equal(t, record.EncryptedData, stored.EncryptedData)
+						_, err = store.GetDelegation("alice", id)
+						require.NoError(t, err)
+					}(fmt.Sprintf("user-%d", i))
+				}
+				wg.Wait()
+			})
+		})
+	}
+}
+
+func TestBoltStorePersists(t *testing.T) {
+	cfg := Config{Store: storeBolt, BoltPath: filepath.Join(t.TempDir(), "proxy.db"), BlobDir: t.TempDir()}
+	record := newTestRecord("survives a restart")
+	delegation := newTestDelegation(t, "alice", "bob")
+
+	store, err := OpenStore(cfg)
+	require.NoError(t, err)
+	require.NoError(t, store.PutRecord("record-1", record))
+	require.NoError(t, store.PutDelegation(delegation))
+	require.NoError(t, store.Close())
+
+	store = openTestStore(t, cfg)
+	storedRecord, err := store.GetRecord("record-1")
+	require.NoError(t, err)
+	require.Equal(t, record, storedRecord)
+
+	storedDelegation, err := store.GetDelegation("alice", "bob")
+	require.NoError(t, err)
+	require.Equal(t, delegation, storedDelegation)
+}
+
+func TestOpenStoreUnknownBackend(t *testing.T) {
+	_, err := OpenStore(Config{Store: "postgres"})
+	require.Error(t, err)
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// Sweep removes the delegations and nonces that expired by now
+func (s *Server) Sweep() error {
+	s.nonces.deleteExpired(s.now())
+
+	expired, err := s.store.DeleteExpiredDelegations(s.now())
+	if err != nil {
+		return err
+	}
+
+	for _, delegation := range expired {
+		s.audit(auditDelegationExpired, delegation, slog.Time("expires_at", delegation.ExpiresAt))
+	}
+	return nil
+}
+
+// RunSweeper calls Sweep every interval until ctx is done
+func (s *Server) RunSweeper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Sweep(); err != nil {
+				s.auditLog.Error("failed to sweep expired delegations", slog.Any("error", err))
+			}
+		}
+	}
+}
@@ -7,6 +7,7 @@ require (
 	github.com/gin-contrib/cors v1.7.3
 	github.com/gin-gonic/gin v1.10.0
 	github.com/stretchr/testify v1.10.0
+	go.etcd.io/bbolt v1.3.11
 	golang.org/x/crypto v0.32.0
 )
 
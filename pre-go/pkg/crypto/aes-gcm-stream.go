@@ -0,0 +1,202 @@
+package crypto
+
+import (
+	"bufio"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	// DefaultStreamChunkSize is the plaintext size of every chunk but the last one
+	DefaultStreamChunkSize = 64 * 1024
+	// MaxStreamChunkSize bounds the chunk size accepted when decrypting a stream,
+	// so a forged header cannot make the reader allocate arbitrary amounts of memory
+	MaxStreamChunkSize = 16 * 1024 * 1024
+
+	streamNoncePrefixSize = 7
+	streamHeaderSize      = streamNoncePrefixSize + 4
+	gcmTagSize            = 16
+)
+
+// ErrInvalidStream is returned when an encrypted stream is truncated, reordered,
+// tampered with, or was encrypted under a different key.
+var ErrInvalidStream = errors.New("invalid encrypted stream")
+
+// EncryptAESGCMStream encrypts everything read from src and writes the encrypted stream to dst.
+// The plaintext is split into chunks of chunkSize bytes which are sealed independently, so
+// neither side ever holds more than one chunk in memory.
+//
+// Stream layout:
+//   - header: nonce prefix (7 bytes) || chunk size (uint32, big-endian)
+//   - chunks: AES-GCM ciphertext and tag of each plaintext chunk
+//
+// The nonce of chunk i is nonce prefix || i (uint32, big-endian) || last chunk flag (1 byte).
+// The last chunk flag lets the reader detect truncation at a chunk boundary; the last chunk
+// may be empty. Every chunk authenticates the header followed by additionalData, which must
+// be passed unchanged to DecryptAESGCMStream, see EncryptAESGCMWithAD for nil additional data.
+func EncryptAESGCMStream(dst io.Writer, src io.Reader, key []byte, additionalData []byte, chunkSize int) error {
+	return EncryptAESGCMStreamContext(context.Background(), dst, src, key, additionalData, chunkSize)
+}
+
+// EncryptAESGCMStreamContext is EncryptAESGCMStream stopping between chunks once ctx is done.
+// It then returns the error of ctx, and dst holds a stream that does not decrypt.
+func EncryptAESGCMStreamContext(ctx context.Context, dst io.Writer, src io.Reader, key []byte, additionalData []byte, chunkSize int) error {
+	if chunkSize <= 0 || chunkSize > MaxStreamChunkSize {
+		return fmt.Errorf("invalid chunk size: %d", chunkSize)
+	}
+
+	aead, err := newStreamAEAD(key)
+	if err != nil {
+		return err
+	}
+
+	header := make([]byte, streamHeaderSize)
+	if _, err = io.ReadFull(rand.Reader, header[:streamNoncePrefixSize]); err != nil {
+		return fmt.Errorf("could not generate nonce: %v", err)
+	}
+	binary.BigEndian.PutUint32(header[streamNoncePrefixSize:], uint32(chunkSize)) // #nosec G115 -- bounded by MaxStreamChunkSize
+	if _, err = dst.Write(header); err != nil {
+		return fmt.Errorf("could not write stream header: %v", err)
+	}
+
+	ad := append(header[:streamHeaderSize:streamHeaderSize], additionalData...)
+	reader := bufio.NewReader(src)
+	plaintext := make([]byte, chunkSize)
+	ciphertext := make([]byte, 0, chunkSize+gcmTagSize)
+	for counter := uint32(0); ; counter++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		n, last, err := readChunk(reader, plaintext)
+		if err != nil {
+			return fmt.Errorf("could not read plaintext: %v", err)
+		}
+
+		nonce := streamNonce(header[:streamNoncePrefixSize], counter, last)
+		ciphertext = aead.Seal(ciphertext[:0], nonce, plaintext[:n], ad)
+		if _, err = dst.Write(ciphertext); err != nil {
+			return fmt.Errorf("could not write chunk: %v", err)
+		}
+
+		if last {
+			return nil
+		}
+		if counter == ^uint32(0) {
+			return fmt.Errorf("stream too long")
+		}
+	}
+}
+
+// DecryptAESGCMStream decrypts a stream produced by EncryptAESGCMStream from src and writes
+// the plaintext to dst. Each chunk is written as soon as it authenticates, so when an error
+// wrapping ErrInvalidStream is returned dst may already hold a prefix of the plaintext
+// that the caller must discard.
+func DecryptAESGCMStream(dst io.Writer, src io.Reader, key []byte, additionalData []byte) error {
+	return DecryptAESGCMStreamContext(context.Background(), dst, src, key, additionalData)
+}
+
+// DecryptAESGCMStreamContext is DecryptAESGCMStream stopping between chunks once ctx is done.
+// It then returns the error of ctx, and dst may hold a prefix of the plaintext.
+func DecryptAESGCMStreamContext(ctx context.Context, dst io.Writer, src io.Reader, key []byte, additionalData []byte) error {
+	aead, err := newStreamAEAD(key)
+	if err != nil {
+		return err
+	}
+
+	header := make([]byte, streamHeaderSize)
+	if _, err = io.ReadFull(src, header); err != nil {
+		return fmt.Errorf("%w: could not read stream header: %v", ErrInvalidStream, err)
+	}
+	chunkSize := binary.BigEndian.Uint32(header[streamNoncePrefixSize:])
+	if chunkSize == 0 || chunkSize > MaxStreamChunkSize {
+		return fmt.Errorf("%w: invalid chunk size: %d", ErrInvalidStream, chunkSize)
+	}
+
+	ad := append(header[:streamHeaderSize:streamHeaderSize], additionalData...)
+	reader := bufio.NewReader(src)
+	ciphertext := make([]byte, int(chunkSize)+gcmTagSize)
+	plaintext := make([]byte, 0, chunkSize)
+	for counter := uint32(0); ; counter++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		n, last, err := readChunk(reader, ciphertext)
+		if err != nil {
+			return fmt.Errorf("could not read ciphertext: %v", err)
+		}
+		if n < gcmTagSize {
+			return fmt.Errorf("%w: truncated chunk", ErrInvalidStream)
+		}
+
+		nonce := streamNonce(header[:streamNoncePrefixSize], counter, last)
+		plaintext, err = aead.Open(plaintext[:0], nonce, ciphertext[:n], ad)
+		if err != nil {
+			return fmt.Errorf("%w: could not decrypt chunk %d: %v", ErrInvalidStream, counter, err)
+		}
+		if _, err = dst.Write(plaintext); err != nil {
+			return fmt.Errorf("could not write plaintext: %v", err)
+		}
+
+		if last {
+			return nil
+		}
+		if counter == ^uint32(0) {
+			return fmt.Errorf("%w: stream too long", ErrInvalidStream)
+		}
+	}
+}
+
+func newStreamAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != 16 && len(key) != 24 && len(key) != 32 {
+		return nil, fmt.Errorf("invalid key size: %d", len(key))
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("could not create new cipher: %v", err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("could not create GCM: %v", err)
+	}
+
+	return aead, nil
+}
+
+// readChunk fills buf from r and reports whether it was the last chunk of the stream.
+func readChunk(r *bufio.Reader, buf []byte) (int, bool, error) {
+	n, err := io.ReadFull(r, buf)
+	switch {
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return n, true, nil
+	case err != nil:
+		return n, false, err
+	}
+
+	// a full chunk is the last one only if nothing follows it
+	if _, err = r.Peek(1); errors.Is(err, io.EOF) {
+		return n, true, nil
+	} else if err != nil {
+		return n, false, err
+	}
+	return n, false, nil
+}
+
+func streamNonce(prefix []byte, counter uint32, last bool) []byte {
+	nonce := make([]byte, 12)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[streamNoncePrefixSize:], counter)
+	if last {
+		nonce[11] = 1
+	}
+	return nonce
+}
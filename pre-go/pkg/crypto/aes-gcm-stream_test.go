@@ -0,0 +1,123 @@
+package crypto_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"testing"
+
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/crypto"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAESGCMStream(t *testing.T) {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	require.NoError(t, err)
+
+	for _, size := range []int{0, 1, 63, 64, 65, 640, 1000} {
+		message := make([]byte, size)
+		_, err := rand.Read(message)
+		require.NoError(t, err)
+
+		var encrypted bytes.Buffer
+		require.NoError(t, crypto.EncryptAESGCMStream(&encrypted, bytes.NewReader(message), key, nil, 64))
+
+		var decrypted bytes.Buffer
+		require.NoError(t, crypto.DecryptAESGCMStream(&decrypted, bytes.NewReader(encrypted.Bytes()), key, nil))
+		require.True(t, bytes.Equal(message, decrypted.Bytes()), "size %d", size)
+	}
+}
+
+func TestAESGCMStreamErrors(t *testing.T) {
+	key := make([]byte, 32)
+	message := make([]byte, 200)
+	var encrypted bytes.Buffer
+	require.NoError(t, crypto.EncryptAESGCMStream(&encrypted, bytes.NewReader(message), key, nil, 64))
+	stream := encrypted.Bytes()
+
+	t.Run("invalid chunk size", func(t *testing.T) {
+		err := crypto.EncryptAESGCMStream(&bytes.Buffer{}, bytes.NewReader(message), key, nil, 0)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "invalid chunk size")
+	})
+
+	t.Run("invalid key size", func(t *testing.T) {
+		err := crypto.EncryptAESGCMStream(&bytes.Buffer{}, bytes.NewReader(message), []byte("invalid"), nil, 64)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "invalid key size")
+	})
+
+	t.Run("wrong key", func(t *testing.T) {
+		wrongKey := bytes.Repeat([]byte{1}, 32)
+		err := crypto.DecryptAESGCMStream(&bytes.Buffer{}, bytes.NewReader(stream), wrongKey, nil)
+		require.ErrorIs(t, err, crypto.ErrInvalidStream)
+	})
+
+	t.Run("truncated at chunk boundary", func(t *testing.T) {
+		// header (11 bytes) followed by two full chunks of 64+16 bytes
+		truncated := stream[:11+2*(64+16)]
+		err := crypto.DecryptAESGCMStream(&bytes.Buffer{}, bytes.NewReader(truncated), key, nil)
+		require.ErrorIs(t, err, crypto.ErrInvalidStream)
+	})
+
+	t.Run("truncated header", func(t *testing.T) {
+		err := crypto.DecryptAESGCMStream(&bytes.Buffer{}, bytes.NewReader(stream[:5]), key, nil)
+		require.ErrorIs(t, err, crypto.ErrInvalidStream)
+	})
+
+	t.Run("different additional data", func(t *testing.T) {
+		err := crypto.DecryptAESGCMStream(&bytes.Buffer{}, bytes.NewReader(stream), key, []byte("context"))
+		require.ErrorIs(t, err, crypto.ErrInvalidStream)
+	})
+
+	t.Run("tampered chunk", func(t *testing.T) {
+		tampered := append([]byte(nil), stream...)
+		tampered[20] ^= 0x01
+		err := crypto.DecryptAESGCMStream(&bytes.Buffer{}, bytes.NewReader(tampered), key, nil)
+		require.ErrorIs(t, err, crypto.ErrInvalidStream)
+	})
+}
+
+// cancelingWriter cancels a context once it has received the given number of writes
+type cancelingWriter struct {
+	bytes.Buffer
+	writes int
+	cancel context.CancelFunc
+}
+
+func (w *cancelingWriter) Write(p []byte) (int, error) {
+	if w.writes--; w.writes == 0 {
+		w.cancel()
+	}
+	return w.Buffer.Write(p)
+}
+
+func TestAESGCMStreamContext(t *testing.T) {
+	key := make([]byte, 32)
+	message := make([]byte, 640)
+
+	t.Run("encrypt", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		// header and first chunk
+		dst := &cancelingWriter{writes: 2, cancel: cancel}
+		err := crypto.EncryptAESGCMStreamContext(ctx, dst, bytes.NewReader(message), key, nil, 64)
+		require.ErrorIs(t, err, context.Canceled)
+		require.Equal(t, 11+64+16, dst.Len())
+	})
+
+	t.Run("decrypt", func(t *testing.T) {
+		var encrypted bytes.Buffer
+		require.NoError(t, crypto.EncryptAESGCMStream(&encrypted, bytes.NewReader(message), key, nil, 64))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		dst := &cancelingWriter{writes: 2, cancel: cancel}
+		err := crypto.DecryptAESGCMStreamContext(ctx, dst, bytes.NewReader(encrypted.Bytes()), key, nil)
+		require.ErrorIs(t, err, context.Canceled)
+		require.Equal(t, 2*64, dst.Len())
+	})
+}
@@ -14,7 +14,19 @@ type AESGCMOptions struct {
 	Mock bool
 }
 
+// EncryptAESGCM encrypts the message with AES-GCM under a random nonce.
+// It returns the nonce followed by the ciphertext and authentication tag.
 func EncryptAESGCM(message []byte, key []byte, opts *AESGCMOptions) ([]byte, error) {
+	return EncryptAESGCMWithAD(message, key, nil, opts)
+}
+
+// EncryptAESGCMWithAD is EncryptAESGCM authenticating additionalData along with the message.
+//
+// additionalData is authenticated but not encrypted, and must be passed unchanged to
+// DecryptAESGCMWithAD. Nil and empty additional data are the same and authenticate nothing,
+// so the output of EncryptAESGCM decrypts with nil additional data. The stream functions
+// follow the same rule.
+func EncryptAESGCMWithAD(message []byte, key []byte, additionalData []byte, opts *AESGCMOptions) ([]byte, error) {
 	if len(key) != 16 && len(key) != 24 && len(key) != 32 {
 		return nil, fmt.Errorf("invalid key size: %d", len(key))
 	}
@@ -41,11 +53,18 @@ func EncryptAESGCM(message []byte, key []byte, opts *AESGCMOptions) ([]byte, err
 	}
 
 	// Encrypt and authenticate
-	ciphertext := aead.Seal(nonce, nonce, message, nil)
+	ciphertext := aead.Seal(nonce, nonce, message, additionalData)
 	return ciphertext, nil
 }
 
+// DecryptAESGCM decrypts the output of EncryptAESGCM
 func DecryptAESGCM(message []byte, key []byte) ([]byte, error) {
+	return DecryptAESGCMWithAD(message, key, nil)
+}
+
+// DecryptAESGCMWithAD decrypts the output of EncryptAESGCMWithAD, checking the additional
+// data it was encrypted with
+func DecryptAESGCMWithAD(message []byte, key []byte, additionalData []byte) ([]byte, error) {
 	ciphertext := message
 
 	block, err := aes.NewCipher(key)
@@ -66,7 +85,7 @@ func DecryptAESGCM(message []byte, key []byte) ([]byte, error) {
 	ciphertext = ciphertext[12:]
 
 	// Decrypt and verify
-	plaintext, err := aead.Open(nil, nonce, ciphertext, nil)
+	plaintext, err := aead.Open(nil, nonce, ciphertext, additionalData)
 	if err != nil {
 		return nil, fmt.Errorf("could not decrypt: %v", err)
 	}
@@ -24,6 +24,27 @@ func TestAESGCM(t *testing.T) {
 	require.Equal(t, message, plaintext)
 }
 
+func TestAESGCMAdditionalData(t *testing.T) {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	require.NoError(t, err)
+
+	message := []byte("hello, world")
+	additionalData := []byte("record-1")
+	ciphertext, err := crypto.EncryptAESGCMWithAD(message, key, additionalData, nil)
+	require.NoError(t, err)
+
+	plaintext, err := crypto.DecryptAESGCMWithAD(ciphertext, key, additionalData)
+	require.NoError(t, err)
+	require.Equal(t, message, plaintext)
+
+	_, err = crypto.DecryptAESGCMWithAD(ciphertext, key, []byte("record-2"))
+	require.Error(t, err)
+
+	_, err = crypto.DecryptAESGCM(ciphertext, key)
+	require.Error(t, err)
+}
+
 func TestAESGCMErrors(t *testing.T) {
 	t.Run("invalid key size", func(t *testing.T) {
 		_, err := crypto.EncryptAESGCM([]byte("test"), []byte("invalid"), nil)
@@ -0,0 +1,179 @@
+// Package auth authenticates HTTP requests with PRE key pairs.
+//
+// A request is signed with signature.Sign, under a signing key derived from the secret key
+// and bound to the public key, so the signature proves possession of the secret key behind
+// the public key. The signed message covers the method, the request URI, a nonce issued by the server
+// and the SHA-256 of the body. Servers hand out every nonce once and accept it once, which
+// makes each signature a response to a fresh challenge and protects against replays.
+package auth
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre/signature"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre/types"
+)
+
+// Headers carrying the authentication of a request
+const (
+	HeaderPublicKey = "X-Public-Key" // Base64 encoded canonical public key of the signer
+	HeaderNonce     = "X-Nonce"      // Nonce issued by the server
+	HeaderSignature = "X-Signature"  // Base64 encoded signature of RequestMessage
+)
+
+// NoncePath is the path servers issue nonces at, relative to their base URL
+const NoncePath = "/auth/nonce"
+
+// messagePrefix versions the layout of the signed message
+const messagePrefix = "PRE_request_v1"
+
+// Nonce is the response of the nonce endpoint
+type Nonce struct {
+	Nonce     string    `json:"nonce"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// RequestMessage returns the message signed for a request: the method, the request URI
+// (path and query), the nonce and the SHA-256 of the body, one per line
+func RequestMessage(method, requestURI, nonce string, body []byte) []byte {
+	sum := sha256.Sum256(body)
+	return []byte(strings.Join([]string{messagePrefix, method, requestURI, nonce, hex.EncodeToString(sum[:])}, "\n"))
+}
+
+// SignRequest sets the authentication headers of req, signing it with the key pair.
+// The body of req is read and replaced by an in-memory copy.
+func SignRequest(req *http.Request, keyPair *types.KeyPair, nonce string) error {
+	if keyPair == nil || keyPair.PublicKey == nil {
+		return signature.ErrInvalidKey
+	}
+
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return fmt.Errorf("failed to read body: %w", err)
+		}
+		_ = req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	publicKey, err := keyPair.PublicKey.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	sig, err := signature.Sign(keyPair, RequestMessage(req.Method, req.URL.RequestURI(), nonce, body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set(HeaderPublicKey, base64.StdEncoding.EncodeToString(publicKey))
+	req.Header.Set(HeaderNonce, nonce)
+	req.Header.Set(HeaderSignature, base64.StdEncoding.EncodeToString(sig))
+	return nil
+}
+
+// VerifyRequest checks the authentication headers against the request and returns the
+// public key of the signer. It does not check the nonce, which is up to the server.
+func VerifyRequest(header http.Header, method, requestURI string, body []byte) (*types.PublicKey, error) {
+	publicKeyBytes, err := base64.StdEncoding.DecodeString(header.Get(HeaderPublicKey))
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid public key encoding", signature.ErrInvalidKey)
+	}
+	publicKey := new(types.PublicKey)
+	if err := publicKey.UnmarshalBinary(publicKeyBytes); err != nil {
+		return nil, fmt.Errorf("%w: %v", signature.ErrInvalidKey, err)
+	}
+
+	nonce := header.Get(HeaderNonce)
+	if nonce == "" {
+		return nil, fmt.Errorf("%w: missing nonce", signature.ErrInvalidSignature)
+	}
+	sig, err := base64.StdEncoding.DecodeString(header.Get(HeaderSignature))
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid encoding", signature.ErrInvalidSignature)
+	}
+
+	if err := signature.Verify(publicKey, RequestMessage(method, requestURI, nonce, body), sig); err != nil {
+		return nil, err
+	}
+	return publicKey, nil
+}
+
+// Client sends requests signed with a key pair to a server issuing nonces at NoncePath
+type Client struct {
+	BaseURL    string
+	KeyPair    *types.KeyPair
+	HTTPClient *http.Client // http.DefaultClient if nil
+}
+
+// NewClient creates a client signing requests to baseURL with the key pair
+func NewClient(baseURL string, keyPair *types.KeyPair) *Client {
+	return &Client{
+		BaseURL: strings.TrimSuffix(baseURL, "/"),
+		KeyPair: keyPair,
+	}
+}
+
+// Do fetches a fresh nonce and sends the signed request. A nil body sends no body;
+// any other body is encoded as JSON.
+func (c *Client) Do(method, path string, body any) (*http.Response, error) {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return nil, err
+		}
+	}
+
+	nonce, err := c.Nonce()
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(method, c.BaseURL+path, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if err := SignRequest(req, c.KeyPair, nonce); err != nil {
+		return nil, err
+	}
+
+	return c.httpClient().Do(req)
+}
+
+// Nonce fetches a fresh nonce from the server
+func (c *Client) Nonce() (string, error) {
+	resp, err := c.httpClient().Post(c.BaseURL+NoncePath, "application/json", nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to fetch nonce: %s", resp.Status)
+	}
+	var nonce Nonce
+	if err := json.NewDecoder(resp.Body).Decode(&nonce); err != nil {
+		return "", fmt.Errorf("failed to decode nonce: %w", err)
+	}
+	return nonce.Nonce, nil
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
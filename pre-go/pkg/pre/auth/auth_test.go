@@ -0,0 +1,54 @@
+package auth_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre/auth"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre/signature"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/testutils"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignVerifyRequest(t *testing.T) {
+	scheme := pre.NewPreScheme()
+	alice := testutils.GenerateRandomKeyPair(scheme.Params.G2, scheme.Params.Z)
+	body := []byte(`{"record_id":"42"}`)
+
+	req := httptest.NewRequest(http.MethodPost, "/records?x=1", bytes.NewReader(body))
+	require.NoError(t, auth.SignRequest(req, alice, "nonce-1"))
+
+	signer, err := auth.VerifyRequest(req.Header, http.MethodPost, "/records?x=1", body)
+	require.NoError(t, err)
+	require.Equal(t, alice.PublicKey.Fingerprint(), signer.Fingerprint())
+
+	for name, tc := range map[string]struct {
+		method, uri string
+		body        []byte
+	}{
+		"other method": {http.MethodPut, "/records?x=1", body},
+		"other path":   {http.MethodPost, "/request?x=1", body},
+		"other query":  {http.MethodPost, "/records?x=2", body},
+		"other body":   {http.MethodPost, "/records?x=1", []byte(`{"record_id":"43"}`)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := auth.VerifyRequest(req.Header, tc.method, tc.uri, tc.body)
+			require.ErrorIs(t, err, signature.ErrInvalidSignature)
+		})
+	}
+
+	t.Run("other nonce", func(t *testing.T) {
+		header := req.Header.Clone()
+		header.Set(auth.HeaderNonce, "nonce-2")
+		_, err := auth.VerifyRequest(header, http.MethodPost, "/records?x=1", body)
+		require.ErrorIs(t, err, signature.ErrInvalidSignature)
+	})
+
+	t.Run("missing headers", func(t *testing.T) {
+		_, err := auth.VerifyRequest(http.Header{}, http.MethodPost, "/records?x=1", body)
+		require.ErrorIs(t, err, signature.ErrInvalidKey)
+	})
+}
@@ -0,0 +1,84 @@
+package pre
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/big"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre/types"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre/utils"
+)
+
+// foScalarDST separates the scalars derived by the Fujisaki-Okamoto transform from other hashes
+const foScalarDST = "PRE_BN254_fo_scalar_v1"
+
+// NewCCAClient creates a client of the CCA-secure variant of the scheme, obtained with the
+// Fujisaki-Okamoto transform. It uses the same keys and produces the same kind of encrypted
+// keys as NewClient, with three differences:
+//
+//   - the scalar k of an encrypted key is derived from its symmetric key, owner and context
+//     instead of being drawn at random, so the scalar given to SecondLevelEncryption and its
+//     variants is ignored and may be nil;
+//   - every encrypted key carries a proof of knowledge of k, see types.EncryptOptions.Prove,
+//     which NewCCAProxy requires before re-encrypting it;
+//   - decryption derives k again from the recovered symmetric key and rejects the key unless
+//     g1^k is its First component, or the Capsule component of a first-level key.
+//
+// Encrypted keys of NewClient fail the last check, so this client only decrypts keys that
+// were produced by a CCA client, and only envelopes of scheme types.SchemeBN254FO.
+// NewClient decrypts the keys of this client without the checks.
+func NewCCAClient(params types.SystemParams) types.PreClient {
+	return &preClient{
+		Params:   params,
+		prepared: utils.PrepareParams(params),
+		fo:       true,
+	}
+}
+
+// NewCCAProxy creates a proxy of the CCA-secure variant of the scheme, see NewCCAClient.
+// It only re-encrypts keys that pass CheckCapsule and carry a proof, and fails with an error
+// wrapping types.ErrMalformedCapsule otherwise; ReEncryption panics as for any other failure.
+func NewCCAProxy() types.PreProxy {
+	return &preProxy{fo: true}
+}
+
+// foScalar derives the scalar of an encrypted key from its symmetric key, owner and context
+func foScalar(symmetricKeyGT *bn254.GT, owner, keyContext []byte) (*big.Int, error) {
+	keyBytes := symmetricKeyGT.Bytes()
+
+	msg := make([]byte, 0, len(keyBytes)+8+len(owner)+len(keyContext))
+	msg = append(msg, keyBytes[:]...)
+	msg = binary.BigEndian.AppendUint32(msg, uint32(len(owner))) // #nosec G115 -- fingerprint size
+	msg = append(msg, owner...)
+	msg = binary.BigEndian.AppendUint32(msg, uint32(len(keyContext))) // #nosec G115 -- bounded by memory
+	msg = append(msg, keyContext...)
+
+	scalar, err := fr.Hash(msg, []byte(foScalarDST), 1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive scalar: %v", err)
+	}
+	if scalar[0].IsZero() {
+		return nil, fmt.Errorf("failed to derive scalar: zero")
+	}
+	return scalar[0].BigInt(new(big.Int)), nil
+}
+
+// checkFOCapsule checks that capsule is g1^k for the scalar k derived from the recovered
+// symmetric key. A wrong secret key fails the check just like a forged capsule, so the error
+// wraps types.ErrAuthenticationFailed.
+func (p *preClient) checkFOCapsule(symmetricKeyGT *bn254.GT, capsule *bn254.G1Affine, owner, keyContext []byte) error {
+	if capsule == nil {
+		return fmt.Errorf("%w: missing capsule", types.ErrMalformedCapsule)
+	}
+
+	scalar, err := foScalar(symmetricKeyGT, owner, keyContext)
+	if err != nil {
+		return err
+	}
+	if !p.prepared.G1Exp(scalar).Equal(capsule) {
+		return fmt.Errorf("%w: capsule does not match its symmetric key", types.ErrAuthenticationFailed)
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package pre_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre/types"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/testutils"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCCAScheme(t *testing.T) {
+	scheme := pre.NewPreScheme(pre.WithCCA())
+	keyPairAlice := testutils.GenerateRandomKeyPair(scheme.Params.G2, scheme.Params.Z)
+	keyPairBob := testutils.GenerateRandomKeyPair(scheme.Params.G2, scheme.Params.Z)
+	reKey := scheme.Client.GenerateReEncryptionKey(keyPairAlice.SecretKey, keyPairBob.PublicKey)
+
+	// the scalar is derived from the symmetric key, so none is given
+	message := []byte("chosen ciphertexts")
+	opts := &types.EncryptOptions{Context: []byte("record-1")}
+	encryptedKey, encryptedMessage, err := scheme.Client.SecondLevelEncryptionBytes(keyPairAlice.SecretKey, message, nil, opts)
+	require.NoError(t, err)
+	require.NotNil(t, encryptedKey.Proof)
+	require.NoError(t, pre.CheckCapsule(encryptedKey))
+
+	decrypted, err := scheme.Client.DecryptSecondLevelBytes(encryptedKey, encryptedMessage, keyPairAlice.SecretKey)
+	require.NoError(t, err)
+	require.Equal(t, message, decrypted)
+
+	firstLevelKey := scheme.Proxy.ReEncryption(encryptedKey, reKey)
+	require.True(t, firstLevelKey.Capsule.Equal(encryptedKey.First))
+	decrypted, err = scheme.Client.DecryptFirstLevelBytes(firstLevelKey, encryptedMessage, keyPairBob.SecretKey)
+	require.NoError(t, err)
+	require.Equal(t, message, decrypted)
+
+	// the keys are keys of the base scheme, which decrypts them without the checks
+	plain := pre.NewPreScheme()
+	decrypted, err = plain.Client.DecryptFirstLevelBytes(plain.Proxy.ReEncryption(encryptedKey, reKey), encryptedMessage, keyPairBob.SecretKey)
+	require.NoError(t, err)
+	require.Equal(t, message, decrypted)
+
+	t.Run("every encryption method", func(t *testing.T) {
+		var stream bytes.Buffer
+		streamKey, err := scheme.Client.SecondLevelEncryptionStream(keyPairAlice.SecretKey, &stream, bytes.NewReader(message), testutils.GenerateRandomScalar(), nil)
+		require.NoError(t, err)
+		var decryptedStream bytes.Buffer
+		require.NoError(t, scheme.Client.DecryptFirstLevelStream(scheme.Proxy.ReEncryption(streamKey, reKey), &decryptedStream, &stream, keyPairBob.SecretKey))
+		require.Equal(t, message, decryptedStream.Bytes())
+
+		toKey, toMessage, err := scheme.Client.EncryptTo(keyPairAlice.PublicKey, message, nil)
+		require.NoError(t, err)
+		decrypted, err := scheme.Client.DecryptSecondLevelBytes(toKey, toMessage, keyPairAlice.SecretKey)
+		require.NoError(t, err)
+		require.Equal(t, message, decrypted)
+
+		toKey, toMessage, err = scheme.Client.EncryptToPrepared(types.PreparePublicKey(keyPairAlice.PublicKey), message, nil)
+		require.NoError(t, err)
+		decrypted, err = scheme.Client.DecryptFirstLevelBytes(scheme.Proxy.ReEncryption(toKey, reKey), toMessage, keyPairBob.SecretKey)
+		require.NoError(t, err)
+		require.Equal(t, message, decrypted)
+	})
+
+	t.Run("envelope", func(t *testing.T) {
+		envelope, err := scheme.Client.EncryptForRecipients(keyPairAlice.SecretKey, message, nil, opts)
+		require.NoError(t, err)
+		require.Equal(t, types.SchemeBN254FO, envelope.Scheme)
+		require.NoError(t, scheme.Proxy.AddRecipient(envelope, keyPairBob.PublicKey.Fingerprint(), reKey))
+
+		data, err := envelope.Marshal()
+		require.NoError(t, err)
+		recovered := new(types.Envelope)
+		require.NoError(t, recovered.Unmarshal(data))
+
+		decrypted, err := scheme.Client.DecryptEnvelopeAsRecipient(recovered, keyPairBob.SecretKey)
+		require.NoError(t, err)
+		require.Equal(t, message, decrypted)
+		decrypted, err = plain.Client.DecryptEnvelope(recovered, keyPairAlice.SecretKey)
+		require.NoError(t, err)
+		require.Equal(t, message, decrypted)
+
+		// envelopes of the base scheme cannot be checked
+		recovered.Scheme = types.SchemeBN254
+		_, err = scheme.Client.DecryptEnvelope(recovered, keyPairAlice.SecretKey)
+		require.ErrorIs(t, err, types.ErrUnsupportedEnvelope)
+
+		// keys wrapped by the caller take the scheme of the client that produced them
+		wrapped := types.NewEnvelopeFor(types.SchemeBN254FO, encryptedKey, encryptedMessage)
+		decrypted, err = scheme.Client.DecryptEnvelope(wrapped, keyPairAlice.SecretKey)
+		require.NoError(t, err)
+		require.Equal(t, message, decrypted)
+		_, err = scheme.Client.DecryptEnvelope(types.NewEnvelope(encryptedKey, encryptedMessage), keyPairAlice.SecretKey)
+		require.ErrorIs(t, err, types.ErrUnsupportedEnvelope)
+	})
+
+	t.Run("proxy checks", func(t *testing.T) {
+		// keys of the base scheme carry no proof
+		plainKey, _, err := plain.Client.EncryptTo(keyPairAlice.PublicKey, message, nil)
+		require.NoError(t, err)
+		_, err = scheme.Proxy.(types.ContextProxy).ReEncryptionContext(context.Background(), plainKey, reKey)
+		require.ErrorIs(t, err, types.ErrMalformedCapsule)
+		_, err = scheme.Proxy.ReEncryptBatch(context.Background(), []*types.SecondLevelSymmetricKey{encryptedKey, plainKey}, reKey)
+		require.ErrorIs(t, err, types.ErrMalformedCapsule)
+		require.Panics(t, func() { scheme.Proxy.ReEncryption(plainKey, reKey) })
+
+		malleated := *encryptedKey
+		malleated.Second = new(bn254.GT).Mul(encryptedKey.Second, testutils.GenerateRandomGTElem())
+		_, err = scheme.Proxy.(types.ContextProxy).ReEncryptionContext(context.Background(), &malleated, reKey)
+		require.ErrorIs(t, err, types.ErrMalformedCapsule)
+
+		envelope := types.NewEnvelope(plainKey, nil)
+		require.ErrorIs(t, scheme.Proxy.AddRecipient(envelope, keyPairBob.PublicKey.Fingerprint(), reKey), types.ErrMalformedCapsule)
+
+		batch, err := scheme.Proxy.ReEncryptBatch(context.Background(), []*types.SecondLevelSymmetricKey{encryptedKey}, reKey)
+		require.NoError(t, err)
+		require.True(t, batch[0].First.Equal(firstLevelKey.First))
+	})
+
+	t.Run("decryption checks", func(t *testing.T) {
+		// keys of the base scheme fail the re-encryption check
+		plainKey, plainMessage, err := plain.Client.EncryptTo(keyPairAlice.PublicKey, message, nil)
+		require.NoError(t, err)
+		_, err = scheme.Client.DecryptSecondLevelBytes(plainKey, plainMessage, keyPairAlice.SecretKey)
+		require.ErrorIs(t, err, types.ErrAuthenticationFailed)
+		_, err = scheme.Client.DecryptFirstLevelBytes(plain.Proxy.ReEncryption(plainKey, reKey), plainMessage, keyPairBob.SecretKey)
+		require.ErrorIs(t, err, types.ErrAuthenticationFailed)
+
+		// a first-level key must name the capsule it was re-encrypted from
+		swapped := *firstLevelKey
+		swapped.Capsule = plainKey.First
+		_, err = scheme.Client.DecryptFirstLevelBytes(&swapped, encryptedMessage, keyPairBob.SecretKey)
+		require.ErrorIs(t, err, types.ErrAuthenticationFailed)
+
+		missing := *firstLevelKey
+		missing.Capsule = nil
+		_, err = scheme.Client.DecryptFirstLevelBytes(&missing, encryptedMessage, keyPairBob.SecretKey)
+		require.ErrorIs(t, err, types.ErrMalformedCapsule)
+
+		// the owner and context are bound to the scalar as well
+		moved := *firstLevelKey
+		moved.Context = []byte("record-2")
+		_, err = scheme.Client.DecryptFirstLevelBytes(&moved, encryptedMessage, keyPairBob.SecretKey)
+		require.ErrorIs(t, err, types.ErrAuthenticationFailed)
+
+		// the wrong secret key recovers another symmetric key
+		_, err = scheme.Client.DecryptFirstLevelBytes(firstLevelKey, encryptedMessage, keyPairAlice.SecretKey)
+		require.ErrorIs(t, err, types.ErrAuthenticationFailed)
+	})
+}
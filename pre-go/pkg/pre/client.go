@@ -1,26 +1,44 @@
 package pre
 
 import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"io"
 	"math/big"
 
 	"github.com/consensys/gnark-crypto/ecc/bn254"
 	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/crypto"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre/keys"
 	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre/types"
 	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre/utils"
 )
 
+// associatedDataPrefix versions the layout of the additional data authenticated with messages
+const associatedDataPrefix = "PRE_associated_data_v3"
+
 // preScheme implements the PreScheme interface
 type preClient struct {
-	Params types.SystemParams
+	Params   types.SystemParams
+	prepared *types.PreparedParams
+	fo       bool // Fujisaki-Okamoto transform, see NewCCAClient
 }
 
-var _ types.PreClient = (*preClient)(nil)
+var (
+	_ types.PreClient         = (*preClient)(nil)
+	_ types.ContextClient     = (*preClient)(nil)
+	_ types.FragmentClient    = (*preClient)(nil)
+	_ types.ConditionalClient = (*preClient)(nil)
+)
 
 // NewPreScheme creates a new instance of preScheme with generated system parameters
 func NewClient(params types.SystemParams) types.PreClient {
 	return &preClient{
-		Params: params,
+		Params:   params,
+		prepared: utils.PrepareParams(params),
 	}
 }
 
@@ -31,80 +49,681 @@ func (p *preClient) GenerateReEncryptionKey(secretA *types.SecretKey, publicB *t
 	return new(bn254.G2Affine).ScalarMultiplication(publicB.Second, secretA.First)
 }
 
+// GenerateReEncryptionKeyContext is GenerateReEncryptionKey returning an error instead of
+// panicking on incomplete keys, or the error of ctx if it is already done
+func (p *preClient) GenerateReEncryptionKeyContext(ctx context.Context, secretA *types.SecretKey, publicB *types.PublicKey) (*types.ReEncryptionKey, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if secretA == nil || !isValidScalar(secretA.First) || publicB == nil || publicB.Second == nil {
+		return nil, types.ErrInvalidKey
+	}
+
+	return p.GenerateReEncryptionKey(secretA, publicB), nil
+}
+
 // SecondLevelEncryption performs the second level encryption for the PRE scheme.
 // It encrypts a message m ∈ GT under pkA such that it can be decrypted by A and delegatees.
 // It takes the public key of A, a portion of secret key of B, the message m and a random scalar as input.
 // The scalar is used to randomize the encryption, should not be reused in other sessions.
 // It returns the ciphertext in the form of a pair of points in G1 and GT groups.
 func (p *preClient) SecondLevelEncryption(secretA *types.SecretKey, message string, scalar *types.Scalar) (*types.SecondLevelSymmetricKey, []byte, error) {
-	// check if scalar is in the correct range
-	if scalar.Cmp(bn254.ID.ScalarField()) >= 0 {
-		return nil, nil, fmt.Errorf("scalar is out of range")
+	return p.SecondLevelEncryptionBytes(secretA, []byte(message), scalar, nil)
+}
+
+// SecondLevelEncryptionBytes is SecondLevelEncryption for binary messages.
+// The context in opts, if any, is authenticated with the message and attached to the encrypted key.
+func (p *preClient) SecondLevelEncryptionBytes(secretA *types.SecretKey, message []byte, scalar *types.Scalar, opts *types.EncryptOptions) (*types.SecondLevelSymmetricKey, []byte, error) {
+	return p.SecondLevelEncryptionBytesContext(context.Background(), secretA, message, scalar, opts)
+}
+
+// SecondLevelEncryptionBytesContext is SecondLevelEncryptionBytes returning the error of ctx
+// if it is done before the key is encapsulated or before the message is encrypted
+func (p *preClient) SecondLevelEncryptionBytesContext(ctx context.Context, secretA *types.SecretKey, message []byte, scalar *types.Scalar, opts *types.EncryptOptions) (*types.SecondLevelSymmetricKey, []byte, error) {
+	encryptedKey, key, err := p.encapsulate(ctx, secretA, scalar, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = ctx.Err(); err != nil {
+		return nil, nil, err
 	}
 
-	// generate random symmetric key
-	keyGT, key, err := crypto.GenerateRandomSymmetricKeyFromGT(32)
+	// encrypt the message
+	ad, err := secondLevelAssociatedData(encryptedKey)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to generate random key: %v", err)
+		return nil, nil, err
+	}
+	encryptedMessage, err := crypto.EncryptAESGCMWithAD(message, key, ad, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encrypt message: %v", err)
+	}
+
+	return encryptedKey, encryptedMessage, nil
+}
+
+// SecondLevelEncryptionStream is SecondLevelEncryption for messages too large to hold in memory.
+// It encrypts everything read from src in chunks and writes the encrypted stream to dst,
+// see crypto.EncryptAESGCMStream for the stream layout.
+// The returned key is handled exactly like the one of SecondLevelEncryption, so the proxy
+// re-encrypts it without ever touching the stream.
+func (p *preClient) SecondLevelEncryptionStream(secretA *types.SecretKey, dst io.Writer, src io.Reader, scalar *types.Scalar, opts *types.EncryptOptions) (*types.SecondLevelSymmetricKey, error) {
+	return p.SecondLevelEncryptionStreamContext(context.Background(), secretA, dst, src, scalar, opts)
+}
+
+// SecondLevelEncryptionStreamContext is SecondLevelEncryptionStream stopping between chunks
+// once ctx is done. It then returns the error of ctx, and dst holds a stream that does not decrypt.
+func (p *preClient) SecondLevelEncryptionStreamContext(ctx context.Context, secretA *types.SecretKey, dst io.Writer, src io.Reader, scalar *types.Scalar, opts *types.EncryptOptions) (*types.SecondLevelSymmetricKey, error) {
+	encryptedKey, key, err := p.encapsulate(ctx, secretA, scalar, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	ad, err := secondLevelAssociatedData(encryptedKey)
+	if err != nil {
+		return nil, err
+	}
+	err = crypto.EncryptAESGCMStreamContext(ctx, dst, src, key, ad, crypto.DefaultStreamChunkSize)
+	if ctxErr := ctx.Err(); ctxErr != nil && errors.Is(err, ctxErr) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt message: %v", err)
+	}
+
+	return encryptedKey, nil
+}
+
+// EncryptTo encrypts a message for the owner of publicA without their secret key, so third
+// parties (e.g. a lab uploading results for a patient) can produce ciphertext for a data owner.
+// It computes (Z^a1)^k from the public key instead of Z^(a1*k), which yields the same
+// second-level encrypted key as SecondLevelEncryption: the owner decrypts it with
+// DecryptSecondLevelBytes and the proxy re-encrypts it with ReEncryption.
+// A fresh random scalar is drawn for every call.
+func (p *preClient) EncryptTo(publicA *types.PublicKey, message []byte, opts *types.EncryptOptions) (*types.SecondLevelSymmetricKey, []byte, error) {
+	return p.EncryptToContext(context.Background(), publicA, message, opts)
+}
+
+// EncryptToContext is EncryptTo returning the error of ctx if it is done before the key is
+// encapsulated or before the message is encrypted
+func (p *preClient) EncryptToContext(ctx context.Context, publicA *types.PublicKey, message []byte, opts *types.EncryptOptions) (*types.SecondLevelSymmetricKey, []byte, error) {
+	scalar, err := keys.RandomScalar(rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	encryptedKey, key, err := p.encapsulateTo(ctx, publicA, scalar, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	// encrypt the message
+	ad, err := secondLevelAssociatedData(encryptedKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	encryptedMessage, err := crypto.EncryptAESGCMWithAD(message, key, ad, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encrypt message: %v", err)
+	}
+
+	return encryptedKey, encryptedMessage, nil
+}
+
+// EncryptToPrepared is EncryptTo for a public key prepared with types.PreparePublicKey, whose
+// fixed-base table replaces the exponentiation of Z^a1. Callers encrypting many messages for
+// the same owner should prepare the public key once and keep it.
+// A fresh random scalar is drawn for every call.
+func (p *preClient) EncryptToPrepared(publicA *types.PreparedPublicKey, message []byte, opts *types.EncryptOptions) (*types.SecondLevelSymmetricKey, []byte, error) {
+	return p.EncryptToPreparedContext(context.Background(), publicA, message, opts)
+}
+
+// EncryptToPreparedContext is EncryptToPrepared returning the error of ctx if it is done
+// before the key is encapsulated or before the message is encrypted
+func (p *preClient) EncryptToPreparedContext(ctx context.Context, publicA *types.PreparedPublicKey, message []byte, opts *types.EncryptOptions) (*types.SecondLevelSymmetricKey, []byte, error) {
+	if publicA == nil || !isValidPublicKey(publicA.PublicKey) {
+		return nil, nil, fmt.Errorf("invalid public key")
+	}
+	if opts != nil && (len(opts.Tag) > 0 || len(opts.Epoch) > 0) {
+		return nil, nil, errConditionRequiresSecretKey
+	}
+
+	scalar, err := keys.RandomScalar(rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	encryptedKey, key, err := p.encapsulateWith(ctx, publicA.Fingerprint(), publicA.FirstExp, scalar, nil, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = ctx.Err(); err != nil {
+		return nil, nil, err
 	}
 
 	// encrypt the message
-	encryptedMessage, err := crypto.EncryptAESGCM([]byte(message), key, nil)
+	ad, err := secondLevelAssociatedData(encryptedKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	encryptedMessage, err := crypto.EncryptAESGCMWithAD(message, key, ad, nil)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to encrypt message: %v", err)
 	}
 
-	// g1^k
-	first := new(bn254.G1Affine).ScalarMultiplication(p.Params.G1, scalar)
+	return encryptedKey, encryptedMessage, nil
+}
+
+// EncryptForRecipients encrypts a message once for several delegatees of A, e.g. a lab report
+// shared with five doctors. The payload is encrypted a single time; the envelope carries the
+// second-level encrypted key and, for every recipient, the first-level key a proxy holding
+// the re-encryption key A->recipient would produce. The proxy can later add or remove
+// recipients with AddRecipient and RemoveRecipient without touching the payload.
+// A fresh random scalar is drawn for every call.
+func (p *preClient) EncryptForRecipients(secretA *types.SecretKey, message []byte, recipients []*types.PublicKey, opts *types.EncryptOptions) (*types.Envelope, error) {
+	return p.EncryptForRecipientsContext(context.Background(), secretA, message, recipients, opts)
+}
+
+// EncryptForRecipientsContext is EncryptForRecipients returning the error of ctx if it is
+// done before the message is encrypted or before the key of a recipient is computed
+func (p *preClient) EncryptForRecipientsContext(ctx context.Context, secretA *types.SecretKey, message []byte, recipients []*types.PublicKey, opts *types.EncryptOptions) (*types.Envelope, error) {
+	scalar, err := keys.RandomScalar(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	encryptedKey, key, err := p.encapsulate(ctx, secretA, scalar, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// encrypt the message
+	ad, err := secondLevelAssociatedData(encryptedKey)
+	if err != nil {
+		return nil, err
+	}
+	encryptedMessage, err := crypto.EncryptAESGCMWithAD(message, key, ad, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt message: %v", err)
+	}
+
+	envelope := types.NewEnvelopeFor(p.scheme(), encryptedKey, encryptedMessage)
+	for _, publicB := range recipients {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if publicB == nil || publicB.First == nil || publicB.Second == nil {
+			return nil, fmt.Errorf("invalid public key")
+		}
 
-	// m*Z^(a1*k)
-	secondTemp1 := new(bn254.GT).Exp(*p.Z(), secretA.First)
-	secondTemp := new(bn254.GT).Exp(*secondTemp1, scalar)
-	second := new(bn254.GT).Mul(keyGT, secondTemp)
+		reKey, err := p.GenerateEpochReEncryptionKeyContext(ctx, secretA, publicB, encryptedKey.Tag, encryptedKey.Epoch)
+		if err != nil {
+			return nil, err
+		}
+		firstLevelKey, err := reEncrypt(encryptedKey, reKey)
+		if err != nil {
+			return nil, err
+		}
+		if err = envelope.SetRecipient(publicB.Fingerprint(), firstLevelKey); err != nil {
+			return nil, err
+		}
+	}
+
+	return envelope, nil
+}
+
+// encapsulate generates a random symmetric key and encrypts it under the key of A.
+// It returns the second-level encrypted key along with the derived symmetric key.
+func (p *preClient) encapsulate(ctx context.Context, secretA *types.SecretKey, scalar *types.Scalar, opts *types.EncryptOptions) (*types.SecondLevelSymmetricKey, []byte, error) {
+	// check if scalar is in the correct range, unless it is derived from the symmetric key
+	if !p.fo && scalar.Cmp(bn254.ID.ScalarField()) >= 0 {
+		return nil, nil, fmt.Errorf("scalar is out of range")
+	}
+	if secretA == nil || !isValidScalar(secretA.First) || !isValidScalar(secretA.Second) {
+		return nil, nil, types.ErrInvalidKey
+	}
+
+	// (Z^a1)^k = Z^(a1*k), a single exponentiation of the fixed base Z
+	exp := func(k *big.Int) *bn254.GT {
+		a1k := new(big.Int).Mul(secretA.First, k)
+		return p.prepared.ZExp(a1k.Mod(a1k, bn254.ID.ScalarField()))
+	}
+
+	var condition *big.Int
+	if opts != nil && (len(opts.Tag) > 0 || len(opts.Epoch) > 0) {
+		if p.fo {
+			return nil, nil, fmt.Errorf("tagged and epoch-scoped encryption is not supported by the CCA client")
+		}
+		var err error
+		if condition, err = conditionScalar(secretA, opts.Tag, opts.Epoch); err != nil {
+			return nil, nil, err
+		}
+	}
+	return p.encapsulateWith(ctx, p.SecretToPubkey(secretA).Fingerprint(), exp, scalar, condition, opts)
+}
+
+// encapsulateTo is encapsulate for callers that only hold the public key of A.
+// The scalar must already be checked to be in range.
+func (p *preClient) encapsulateTo(ctx context.Context, publicA *types.PublicKey, scalar *types.Scalar, opts *types.EncryptOptions) (*types.SecondLevelSymmetricKey, []byte, error) {
+	if !isValidPublicKey(publicA) {
+		return nil, nil, fmt.Errorf("invalid public key")
+	}
+	if opts != nil && (len(opts.Tag) > 0 || len(opts.Epoch) > 0) {
+		return nil, nil, errConditionRequiresSecretKey
+	}
+
+	exp := func(k *big.Int) *bn254.GT {
+		return new(bn254.GT).Exp(*publicA.First, k)
+	}
+	return p.encapsulateWith(ctx, publicA.Fingerprint(), exp, scalar, nil, opts)
+}
+
+// encapsulateWith generates a random symmetric key and encrypts it under the key of the owner
+// with the given fingerprint. exp raises Z^a1, the First component of their public key, to a scalar.
+// condition is the scalar of opts.Tag and opts.Epoch, or nil for unconditional keys.
+// It returns the error of ctx if it is already done.
+func (p *preClient) encapsulateWith(ctx context.Context, owner []byte, exp func(*big.Int) *bn254.GT, scalar *types.Scalar, condition *big.Int, opts *types.EncryptOptions) (*types.SecondLevelSymmetricKey, []byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	// generate random symmetric key
+	keyGT, key, err := crypto.GenerateRandomSymmetricKeyFromGT(types.SymmetricKeySize)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate random key: %v", err)
+	}
+
+	var keyContext []byte
+	if opts != nil && len(opts.Context) > 0 {
+		keyContext = append([]byte(nil), opts.Context...)
+	}
+	if p.fo {
+		if scalar, err = foScalar(keyGT, owner, keyContext); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// g1^k, or g1^(k/t) for conditional keys so that only the re-encryption key of the
+	// tag and epoch pairs it with g2^(a1*b2*t) into Z^(a1*b2*k)
+	firstScalar := scalar
+	var keyTag, keyEpoch []byte
+	if condition != nil {
+		firstScalar = new(big.Int).ModInverse(condition, bn254.ID.ScalarField())
+		firstScalar.Mul(firstScalar, scalar).Mod(firstScalar, bn254.ID.ScalarField())
+		if len(opts.Tag) > 0 {
+			keyTag = append([]byte(nil), opts.Tag...)
+		}
+		if len(opts.Epoch) > 0 {
+			keyEpoch = append([]byte(nil), opts.Epoch...)
+		}
+	}
+	first := p.prepared.G1Exp(firstScalar)
+
+	// m*(Z^a1)^k = m*Z^(a1*k)
+	second := new(bn254.GT).Mul(keyGT, exp(scalar))
 
 	encryptedKey := &types.SecondLevelSymmetricKey{
 		First:  first,
 		Second: second,
+		CapsuleAttributes: types.CapsuleAttributes{
+			Owner:   owner,
+			Context: keyContext,
+			Tag:     keyTag,
+			Epoch:   keyEpoch,
+		},
+	}
+	if p.fo || (opts != nil && opts.Prove) {
+		if encryptedKey.Proof, err = proveCapsule(p.prepared, encryptedKey, firstScalar); err != nil {
+			return nil, nil, fmt.Errorf("failed to prove capsule: %v", err)
+		}
 	}
 
-	return encryptedKey, encryptedMessage, nil
+	return encryptedKey, key, nil
+}
+
+// associatedData builds the additional data authenticated by AES-GCM along with the message:
+// the capsule g1^k, the GT component of the encrypted key, the fingerprint of the owner and
+// the caller context, if any. Re-encryption carries all of them over to the first-level key,
+// whose Capsule is the G1 component of the second-level key.
+//
+// Keys without owner and context authenticate no additional data. Those are the keys of
+// pre-ts and of version 1 envelopes, and the keys decoded from the bare encoding, which
+// NewEnvelope and the encrypting methods of this package never produce: they encrypt with the
+// owner set, and MarshalBinary refuses to drop it. Their payload is only bound to the capsule
+// by the symmetric key derived from it.
+func associatedData(capsule *bn254.G1Affine, encryptedKeyGT *bn254.GT, attributes *types.CapsuleAttributes) ([]byte, error) {
+	if len(attributes.Owner) == 0 && len(attributes.Context) == 0 {
+		return nil, nil
+	}
+	if capsule == nil {
+		return nil, fmt.Errorf("%w: missing capsule", types.ErrMalformedCapsule)
+	}
+
+	capsuleBytes := capsule.Bytes()
+	keyBytes := encryptedKeyGT.Bytes()
+
+	ad := make([]byte, 0, len(associatedDataPrefix)+len(capsuleBytes)+len(keyBytes)+8+len(attributes.Owner)+len(attributes.Context))
+	ad = append(ad, associatedDataPrefix...)
+	ad = append(ad, capsuleBytes[:]...)
+	ad = append(ad, keyBytes[:]...)
+	ad = binary.BigEndian.AppendUint32(ad, uint32(len(attributes.Owner))) // #nosec G115 -- fingerprint size
+	ad = append(ad, attributes.Owner...)
+	ad = binary.BigEndian.AppendUint32(ad, uint32(len(attributes.Context))) // #nosec G115 -- bounded by memory
+	ad = append(ad, attributes.Context...)
+	return ad, nil
+}
+
+// secondLevelAssociatedData is associatedData of a second-level key
+func secondLevelAssociatedData(encryptedKey *types.SecondLevelSymmetricKey) ([]byte, error) {
+	return associatedData(encryptedKey.First, encryptedKey.Second, &encryptedKey.CapsuleAttributes)
+}
+
+// firstLevelAssociatedData is associatedData of a first-level key
+func firstLevelAssociatedData(encryptedKey *types.FirstLevelSymmetricKey) ([]byte, error) {
+	return associatedData(encryptedKey.Capsule, encryptedKey.Second, &encryptedKey.CapsuleAttributes)
 }
 
 // Convert the secret key to public key in the PRE scheme.
 func (p *preClient) SecretToPubkey(secret *types.SecretKey) *types.PublicKey {
-	return utils.SecretToPubkey(secret, p.Params.G2, p.Params.Z)
+	return p.prepared.SecretToPubkey(secret)
 }
 
-// Decrypt with first-level encrypted key
-func (p *preClient) DecryptFirstLevel(encryptedKey *types.FirstLevelSymmetricKey, encryptedMessage []byte, secretKey *types.SecretKey) string {
-	symmetricKey, err := p.decryptFirstLevelKey(encryptedKey, secretKey)
+// DecryptFirstLevelBytes decrypts a message with a first-level encrypted key.
+// Failures are reported as errors wrapping types.ErrInvalidKey,
+// types.ErrAuthenticationFailed or types.ErrMalformedCapsule.
+func (p *preClient) DecryptFirstLevelBytes(encryptedKey *types.FirstLevelSymmetricKey, encryptedMessage []byte, secretKey *types.SecretKey) ([]byte, error) {
+	return p.DecryptFirstLevelBytesContext(context.Background(), encryptedKey, encryptedMessage, secretKey)
+}
+
+// DecryptFirstLevelBytesContext is DecryptFirstLevelBytes returning the error of ctx if it is
+// done before the key is recovered or before the message is decrypted
+func (p *preClient) DecryptFirstLevelBytesContext(ctx context.Context, encryptedKey *types.FirstLevelSymmetricKey, encryptedMessage []byte, secretKey *types.SecretKey) ([]byte, error) {
+	symmetricKey, err := p.decryptFirstLevelKey(ctx, encryptedKey, secretKey)
 	if err != nil {
-		panic("error in deriving key")
+		return nil, err
+	}
+	if err = ctx.Err(); err != nil {
+		return nil, err
 	}
 
-	decryptedMessage, _ := crypto.DecryptAESGCM(encryptedMessage, symmetricKey)
-	return string(decryptedMessage)
+	ad, err := firstLevelAssociatedData(encryptedKey)
+	if err != nil {
+		return nil, err
+	}
+	return openMessage(encryptedMessage, symmetricKey, ad)
+}
+
+// DecryptSecondLevelBytes decrypts a message with a second-level encrypted key.
+// Failures are reported as errors wrapping types.ErrInvalidKey,
+// types.ErrAuthenticationFailed or types.ErrMalformedCapsule.
+func (p *preClient) DecryptSecondLevelBytes(encryptedKey *types.SecondLevelSymmetricKey, encryptedMessage []byte, secretKey *types.SecretKey) ([]byte, error) {
+	return p.DecryptSecondLevelBytesContext(context.Background(), encryptedKey, encryptedMessage, secretKey)
+}
+
+// DecryptSecondLevelBytesContext is DecryptSecondLevelBytes returning the error of ctx if it
+// is done before the key is recovered or before the message is decrypted
+func (p *preClient) DecryptSecondLevelBytesContext(ctx context.Context, encryptedKey *types.SecondLevelSymmetricKey, encryptedMessage []byte, secretKey *types.SecretKey) ([]byte, error) {
+	symmetricKey, err := p.decryptSecondLevelKey(ctx, encryptedKey, secretKey)
+	if err != nil {
+		return nil, err
+	}
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	ad, err := secondLevelAssociatedData(encryptedKey)
+	if err != nil {
+		return nil, err
+	}
+	return openMessage(encryptedMessage, symmetricKey, ad)
+}
+
+// DecryptEnvelope decrypts the payload of an envelope with the secret key of the data owner;
+// delegatees use DecryptEnvelopeAsRecipient. The scheme, KDF and key size recorded in the
+// envelope are checked against those of the client, see checkEnvelope.
+func (p *preClient) DecryptEnvelope(envelope *types.Envelope, secretKey *types.SecretKey) ([]byte, error) {
+	return p.DecryptEnvelopeContext(context.Background(), envelope, secretKey)
+}
+
+// DecryptEnvelopeContext is DecryptEnvelope returning the error of ctx if it is done before
+// the key is recovered or before the payload is decrypted
+func (p *preClient) DecryptEnvelopeContext(ctx context.Context, envelope *types.Envelope, secretKey *types.SecretKey) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := p.checkEnvelope(envelope); err != nil {
+		return nil, err
+	}
+
+	encryptedKey := envelope.Capsule
+	if encryptedKey == nil || encryptedKey.First == nil || encryptedKey.Second == nil {
+		return nil, types.ErrMalformedCapsule
+	}
+	if secretKey == nil || !isValidScalar(secretKey.First) {
+		return nil, types.ErrInvalidKey
+	}
+
+	symmetricKeyGT, err := p.decryptSecondLevelKeyGT(encryptedKey, secretKey)
+	if err != nil {
+		return nil, err
+	}
+
+	symmetricKey, err := deriveEnvelopeKey(envelope, symmetricKeyGT)
+	if err != nil {
+		return nil, err
+	}
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	ad, err := secondLevelAssociatedData(encryptedKey)
+	if err != nil {
+		return nil, err
+	}
+	return openMessage(envelope.Payload, symmetricKey, ad)
+}
+
+// DecryptEnvelopeAsRecipient decrypts the payload of a multi-recipient envelope with the
+// secret key of one of its delegatees. The capsule of the delegatee is looked up by the
+// fingerprint of their public key; types.ErrNotRecipient is returned if there is none.
+func (p *preClient) DecryptEnvelopeAsRecipient(envelope *types.Envelope, secretKey *types.SecretKey) ([]byte, error) {
+	return p.DecryptEnvelopeAsRecipientContext(context.Background(), envelope, secretKey)
+}
+
+// DecryptEnvelopeAsRecipientContext is DecryptEnvelopeAsRecipient returning the error of ctx
+// if it is done before the key is recovered or before the payload is decrypted
+func (p *preClient) DecryptEnvelopeAsRecipientContext(ctx context.Context, envelope *types.Envelope, secretKey *types.SecretKey) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := p.checkEnvelope(envelope); err != nil {
+		return nil, err
+	}
+	if secretKey == nil || !isValidScalar(secretKey.First) || !isValidScalar(secretKey.Second) {
+		return nil, types.ErrInvalidKey
+	}
+
+	encryptedKey := envelope.RecipientKey(p.SecretToPubkey(secretKey).Fingerprint())
+	if encryptedKey == nil {
+		return nil, types.ErrNotRecipient
+	}
+	if encryptedKey.First == nil || encryptedKey.Second == nil {
+		return nil, types.ErrMalformedCapsule
+	}
+
+	symmetricKeyGT, err := p.decryptFirstLevelKeyGT(encryptedKey, secretKey)
+	if err != nil {
+		return nil, err
+	}
+
+	symmetricKey, err := deriveEnvelopeKey(envelope, symmetricKeyGT)
+	if err != nil {
+		return nil, err
+	}
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	ad, err := firstLevelAssociatedData(encryptedKey)
+	if err != nil {
+		return nil, err
+	}
+	return openMessage(envelope.Payload, symmetricKey, ad)
+}
+
+// checkEnvelope rejects envelopes this client cannot decrypt with types.ErrUnsupportedEnvelope.
+// SchemeBN254FO capsules are SchemeBN254 capsules, so every client decrypts them, but the
+// CCA-secure client only decrypts capsules it can check. Both schemes encrypt with
+// types.SymmetricKeySize AES keys, so no other key size can be right.
+func (p *preClient) checkEnvelope(envelope *types.Envelope) error {
+	if envelope == nil {
+		return types.ErrMalformedCapsule
+	}
+	switch {
+	case envelope.Scheme == types.SchemeBN254FO:
+	case envelope.Scheme == types.SchemeBN254 && !p.fo:
+	default:
+		return fmt.Errorf("%w: scheme %d", types.ErrUnsupportedEnvelope, envelope.Scheme)
+	}
+	if envelope.KeySize != types.SymmetricKeySize {
+		return fmt.Errorf("%w: key size %d", types.ErrUnsupportedEnvelope, envelope.KeySize)
+	}
+	return nil
+}
+
+// scheme returns the envelope scheme of the keys of the client
+func (p *preClient) scheme() types.SchemeID {
+	if p.fo {
+		return types.SchemeBN254FO
+	}
+	return types.SchemeBN254
+}
+
+// deriveEnvelopeKey derives the symmetric key with the KDF recorded in the envelope
+func deriveEnvelopeKey(envelope *types.Envelope, symmetricKeyGT *bn254.GT) ([]byte, error) {
+	switch envelope.KDF {
+	case types.KDFHKDFSHA256:
+		symmetricKey, err := utils.DeriveKeyFromGT(symmetricKeyGT, types.SymmetricKeySize)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", types.ErrUnsupportedEnvelope, err)
+		}
+		return symmetricKey, nil
+	default:
+		return nil, fmt.Errorf("%w: KDF %d", types.ErrUnsupportedEnvelope, envelope.KDF)
+	}
+}
+
+// DecryptFirstLevelStream decrypts a stream produced by SecondLevelEncryptionStream with a
+// first-level encrypted key. Chunks are written to dst as soon as they authenticate, so on an
+// error wrapping types.ErrAuthenticationFailed dst may hold a plaintext prefix to discard.
+func (p *preClient) DecryptFirstLevelStream(encryptedKey *types.FirstLevelSymmetricKey, dst io.Writer, src io.Reader, secretKey *types.SecretKey) error {
+	return p.DecryptFirstLevelStreamContext(context.Background(), encryptedKey, dst, src, secretKey)
+}
+
+// DecryptFirstLevelStreamContext is DecryptFirstLevelStream stopping between chunks once ctx
+// is done. It then returns the error of ctx, and dst may hold a plaintext prefix to discard.
+func (p *preClient) DecryptFirstLevelStreamContext(ctx context.Context, encryptedKey *types.FirstLevelSymmetricKey, dst io.Writer, src io.Reader, secretKey *types.SecretKey) error {
+	symmetricKey, err := p.decryptFirstLevelKey(ctx, encryptedKey, secretKey)
+	if err != nil {
+		return err
+	}
+
+	ad, err := firstLevelAssociatedData(encryptedKey)
+	if err != nil {
+		return err
+	}
+	return openStream(ctx, dst, src, symmetricKey, ad)
+}
+
+// DecryptSecondLevelStream decrypts a stream produced by SecondLevelEncryptionStream with a
+// second-level encrypted key. Chunks are written to dst as soon as they authenticate, so on an
+// error wrapping types.ErrAuthenticationFailed dst may hold a plaintext prefix to discard.
+func (p *preClient) DecryptSecondLevelStream(encryptedKey *types.SecondLevelSymmetricKey, dst io.Writer, src io.Reader, secretKey *types.SecretKey) error {
+	return p.DecryptSecondLevelStreamContext(context.Background(), encryptedKey, dst, src, secretKey)
+}
+
+// DecryptSecondLevelStreamContext is DecryptSecondLevelStream stopping between chunks once ctx
+// is done. It then returns the error of ctx, and dst may hold a plaintext prefix to discard.
+func (p *preClient) DecryptSecondLevelStreamContext(ctx context.Context, encryptedKey *types.SecondLevelSymmetricKey, dst io.Writer, src io.Reader, secretKey *types.SecretKey) error {
+	symmetricKey, err := p.decryptSecondLevelKey(ctx, encryptedKey, secretKey)
+	if err != nil {
+		return err
+	}
+
+	ad, err := secondLevelAssociatedData(encryptedKey)
+	if err != nil {
+		return err
+	}
+	return openStream(ctx, dst, src, symmetricKey, ad)
+}
+
+// Decrypt with first-level encrypted key
+//
+// Deprecated: Use DecryptFirstLevelBytes.
+func (p *preClient) DecryptFirstLevel(encryptedKey *types.FirstLevelSymmetricKey, encryptedMessage []byte, secretKey *types.SecretKey) string {
+	return legacyDecryptResult(p.DecryptFirstLevelBytes(encryptedKey, encryptedMessage, secretKey))
 }
 
 // Decrypt with second-level encrypted key
+//
+// Deprecated: Use DecryptSecondLevelBytes.
 func (p *preClient) DecryptSecondLevel(encryptedKey *types.SecondLevelSymmetricKey, encryptedMessage []byte, secretKey *types.SecretKey) string {
-	symmetricKey, err := p.decryptSecondLevelKey(encryptedKey, secretKey)
+	return legacyDecryptResult(p.DecryptSecondLevelBytes(encryptedKey, encryptedMessage, secretKey))
+}
+
+// legacyDecryptResult keeps the behavior of the string-returning decryption methods:
+// they panic when the key cannot be derived and return an empty string when
+// the message does not authenticate.
+func legacyDecryptResult(decryptedMessage []byte, err error) string {
+	if err != nil && !errors.Is(err, types.ErrAuthenticationFailed) {
+		panic(err)
+	}
+	return string(decryptedMessage)
+}
+
+// openMessage decrypts the AES-GCM encrypted message with the derived symmetric key
+func openMessage(encryptedMessage []byte, symmetricKey []byte, ad []byte) ([]byte, error) {
+	decryptedMessage, err := crypto.DecryptAESGCMWithAD(encryptedMessage, symmetricKey, ad)
 	if err != nil {
-		panic("error in deriving key")
+		return nil, fmt.Errorf("%w: %v", types.ErrAuthenticationFailed, err)
 	}
 
-	decryptedMessage, _ := crypto.DecryptAESGCM(encryptedMessage, symmetricKey)
-	return string(decryptedMessage)
+	return decryptedMessage, nil
 }
 
-// Decrypt first-level encrypted symmetric key
-func (p *preClient) decryptFirstLevelKey(encryptedKey *types.FirstLevelSymmetricKey, secretKey *types.SecretKey) ([]byte, error) {
-	order := bn254.ID.ScalarField()
-	temp := new(bn254.GT).Exp(*encryptedKey.First, new(big.Int).ModInverse(secretKey.Second, order))
+// openStream decrypts the chunked AES-GCM stream with the derived symmetric key
+func openStream(ctx context.Context, dst io.Writer, src io.Reader, symmetricKey []byte, ad []byte) error {
+	err := crypto.DecryptAESGCMStreamContext(ctx, dst, src, symmetricKey, ad)
+	if errors.Is(err, crypto.ErrInvalidStream) {
+		return fmt.Errorf("%w: %v", types.ErrAuthenticationFailed, err)
+	}
 
-	symmetricKeyGT := new(bn254.GT).Div(encryptedKey.Second, temp)
+	return err
+}
+
+// Decrypt first-level encrypted symmetric key, unless ctx is already done
+func (p *preClient) decryptFirstLevelKey(ctx context.Context, encryptedKey *types.FirstLevelSymmetricKey, secretKey *types.SecretKey) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if encryptedKey == nil || encryptedKey.First == nil || encryptedKey.Second == nil {
+		return nil, types.ErrMalformedCapsule
+	}
+	if secretKey == nil || !isValidScalar(secretKey.Second) {
+		return nil, types.ErrInvalidKey
+	}
+
+	symmetricKeyGT, err := p.decryptFirstLevelKeyGT(encryptedKey, secretKey)
+	if err != nil {
+		return nil, err
+	}
 
-	symmetricKey, err := utils.DeriveKeyFromGT(symmetricKeyGT, 32)
+	symmetricKey, err := utils.DeriveKeyFromGT(symmetricKeyGT, types.SymmetricKeySize)
 	if err != nil {
 		return nil, fmt.Errorf("failed to derive key: %v", err)
 	}
@@ -112,16 +731,39 @@ func (p *preClient) decryptFirstLevelKey(encryptedKey *types.FirstLevelSymmetric
 	return symmetricKey, nil
 }
 
-// Decrypt second-level encrypted symmetric key
+// Recover the GT element encrypted in a first-level encrypted symmetric key
+func (p *preClient) decryptFirstLevelKeyGT(encryptedKey *types.FirstLevelSymmetricKey, secretKey *types.SecretKey) (*bn254.GT, error) {
+	order := bn254.ID.ScalarField()
+	temp := new(bn254.GT).Exp(*encryptedKey.First, new(big.Int).ModInverse(secretKey.Second, order))
+	symmetricKeyGT := new(bn254.GT).Div(encryptedKey.Second, temp)
+
+	if p.fo {
+		if err := p.checkFOCapsule(symmetricKeyGT, encryptedKey.Capsule, encryptedKey.Owner, encryptedKey.Context); err != nil {
+			return nil, err
+		}
+	}
+	return symmetricKeyGT, nil
+}
+
+// Decrypt second-level encrypted symmetric key, unless ctx is already done
 // Supposed to run by the original encryptor
-func (p *preClient) decryptSecondLevelKey(encryptedKey *types.SecondLevelSymmetricKey, secretKey *types.SecretKey) ([]byte, error) {
-	temp, err := bn254.Pair([]bn254.G1Affine{*encryptedKey.First}, []bn254.G2Affine{*p.Params.G2})
+func (p *preClient) decryptSecondLevelKey(ctx context.Context, encryptedKey *types.SecondLevelSymmetricKey, secretKey *types.SecretKey) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if encryptedKey == nil || encryptedKey.First == nil || encryptedKey.Second == nil {
+		return nil, types.ErrMalformedCapsule
+	}
+	if secretKey == nil || !isValidScalar(secretKey.First) {
+		return nil, types.ErrInvalidKey
+	}
+
+	symmetricKeyGT, err := p.decryptSecondLevelKeyGT(encryptedKey, secretKey)
 	if err != nil {
-		return nil, fmt.Errorf("error in pairing")
+		return nil, err
 	}
 
-	symmetricKeyGT := new(bn254.GT).Div(encryptedKey.Second, new(bn254.GT).Exp(temp, secretKey.First))
-	symmetricKey, err := utils.DeriveKeyFromGT(symmetricKeyGT, 32)
+	symmetricKey, err := utils.DeriveKeyFromGT(symmetricKeyGT, types.SymmetricKeySize)
 	if err != nil {
 		return nil, fmt.Errorf("failed to derive key: %v", err)
 	}
@@ -129,6 +771,48 @@ func (p *preClient) decryptSecondLevelKey(encryptedKey *types.SecondLevelSymmetr
 	return symmetricKey, nil
 }
 
+// Recover the GT element encrypted in a second-level encrypted symmetric key.
+// The owner recorded in the key, if any, is checked against the key of the decryptor rather
+// than trusted, so a key claiming another owner does not decrypt.
+func (p *preClient) decryptSecondLevelKeyGT(encryptedKey *types.SecondLevelSymmetricKey, secretKey *types.SecretKey) (*bn254.GT, error) {
+	if len(encryptedKey.Owner) > 0 {
+		if !isValidScalar(secretKey.Second) {
+			return nil, types.ErrInvalidKey
+		}
+		if !bytes.Equal(encryptedKey.Owner, p.SecretToPubkey(secretKey).Fingerprint()) {
+			return nil, fmt.Errorf("%w: encrypted key belongs to another owner", types.ErrAuthenticationFailed)
+		}
+	}
+
+	temp, err := bn254.Pair([]bn254.G1Affine{*encryptedKey.First}, []bn254.G2Affine{*p.Params.G2})
+	if err != nil {
+		return nil, fmt.Errorf("%w: error in pairing: %v", types.ErrMalformedCapsule, err)
+	}
+
+	exponent, err := secondLevelExponent(encryptedKey, secretKey)
+	if err != nil {
+		return nil, err
+	}
+	symmetricKeyGT := new(bn254.GT).Div(encryptedKey.Second, new(bn254.GT).Exp(temp, exponent))
+
+	if p.fo {
+		if err := p.checkFOCapsule(symmetricKeyGT, encryptedKey.First, encryptedKey.Owner, encryptedKey.Context); err != nil {
+			return nil, err
+		}
+	}
+	return symmetricKeyGT, nil
+}
+
+// isValidScalar reports whether s is a non-zero element of the BN254 scalar field
+func isValidScalar(s *big.Int) bool {
+	return s != nil && s.Sign() > 0 && s.Cmp(bn254.ID.ScalarField()) < 0
+}
+
+// isValidPublicKey checks that the public key is complete and that Z^a1 is not the identity
+func isValidPublicKey(pk *types.PublicKey) bool {
+	return pk != nil && pk.First != nil && pk.Second != nil && !pk.First.IsOne()
+}
+
 // GetG1 returns the G1 group element
 func (p *preClient) G1() *bn254.G1Affine {
 	return p.Params.G1
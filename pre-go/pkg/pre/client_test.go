@@ -0,0 +1,57 @@
+package pre_test
+
+import (
+	"crypto/rand"
+	"testing"
+
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre/keys"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre/types"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/testutils"
+)
+
+var benchmarkMessage = []byte("lab results for alice")
+
+func BenchmarkGenerateKeyPair(b *testing.B) {
+	scheme := pre.NewPreScheme()
+	for n := 0; n < b.N; n++ {
+		if _, err := keys.GenerateKeyPair(scheme.Params, rand.Reader); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSecondLevelEncryption(b *testing.B) {
+	scheme := pre.NewPreScheme()
+	keyPair := testutils.GenerateRandomKeyPair(scheme.Params.G2, scheme.Params.Z)
+	scalar := testutils.GenerateRandomScalar()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		if _, _, err := scheme.Client.SecondLevelEncryptionBytes(keyPair.SecretKey, benchmarkMessage, scalar, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkEncryptTo compares encrypting to a public key with encrypting to the same key
+// prepared once
+func BenchmarkEncryptTo(b *testing.B) {
+	scheme := pre.NewPreScheme()
+	keyPair := testutils.GenerateRandomKeyPair(scheme.Params.G2, scheme.Params.Z)
+	b.Run("public key", func(b *testing.B) {
+		for n := 0; n < b.N; n++ {
+			if _, _, err := scheme.Client.EncryptTo(keyPair.PublicKey, benchmarkMessage, nil); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("prepared", func(b *testing.B) {
+		prepared := types.PreparePublicKey(keyPair.PublicKey)
+		b.ResetTimer()
+		for n := 0; n < b.N; n++ {
+			if _, _, err := scheme.Client.EncryptToPrepared(prepared, benchmarkMessage, nil); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
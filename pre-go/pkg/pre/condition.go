@@ -0,0 +1,80 @@
+package pre
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre/types"
+)
+
+// conditionScalarDST separates the scalars of conditions (tags and epochs) from other hashes
+const conditionScalarDST = "PRE_BN254_tag_scalar_v1"
+
+// errConditionRequiresSecretKey is returned when a tag or an epoch is given to an encryption
+// without the secret key of the owner, who alone can derive the scalar of a condition
+var errConditionRequiresSecretKey = errors.New("tagged or epoch-scoped encryption needs the secret key of the owner")
+
+// GenerateTaggedReEncryptionKey generates a re-encryption key A->B that only re-encrypts keys
+// encrypted with the same tag in types.EncryptOptions, e.g. "lab-results", so A can delegate
+// one category of records without the others. Keys re-encrypted with the key of another tag,
+// or without a tag, do not decrypt; B then gets an error wrapping types.ErrAuthenticationFailed.
+//
+// The tag is hashed with a1 to a scalar t, the re-encryption key is g2^(a1·b2·t) and
+// tagged keys have g1^(k/t) as First component, so only A can compute either of them.
+// An empty tag gives the key of GenerateReEncryptionKey.
+func (p *preClient) GenerateTaggedReEncryptionKey(secretA *types.SecretKey, publicB *types.PublicKey, tag []byte) (*types.ReEncryptionKey, error) {
+	return p.GenerateTaggedReEncryptionKeyContext(context.Background(), secretA, publicB, tag)
+}
+
+// GenerateTaggedReEncryptionKeyContext is GenerateTaggedReEncryptionKey returning the error
+// of ctx if it is already done
+func (p *preClient) GenerateTaggedReEncryptionKeyContext(ctx context.Context, secretA *types.SecretKey, publicB *types.PublicKey, tag []byte) (*types.ReEncryptionKey, error) {
+	return p.GenerateEpochReEncryptionKeyContext(ctx, secretA, publicB, tag, nil)
+}
+
+// conditionScalar derives the scalar of a tag and an epoch from a1, or returns nil if both
+// are empty. The epoch is only hashed when present, so tagged keys without epoch keep the
+// scalar they had before epochs existed.
+func conditionScalar(secretA *types.SecretKey, tag, epoch []byte) (*big.Int, error) {
+	if len(tag) == 0 && len(epoch) == 0 {
+		return nil, nil
+	}
+
+	var a1 [fr.Bytes]byte
+	secretA.First.FillBytes(a1[:])
+
+	msg := make([]byte, 0, len(a1)+8+len(tag)+len(epoch))
+	msg = append(msg, a1[:]...)
+	msg = binary.BigEndian.AppendUint32(msg, uint32(len(tag))) // #nosec G115 -- bounded by memory
+	msg = append(msg, tag...)
+	if len(epoch) > 0 {
+		msg = binary.BigEndian.AppendUint32(msg, uint32(len(epoch))) // #nosec G115 -- bounded by memory
+		msg = append(msg, epoch...)
+	}
+
+	scalar, err := fr.Hash(msg, []byte(conditionScalarDST), 1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive condition scalar: %v", err)
+	}
+	if scalar[0].IsZero() {
+		return nil, fmt.Errorf("failed to derive condition scalar: zero")
+	}
+	return scalar[0].BigInt(new(big.Int)), nil
+}
+
+// secondLevelExponent returns the exponent a1·t, or a1 for unconditional keys, that raises
+// e(First, g2) to the mask Z^(a1·k) of a second-level key
+func secondLevelExponent(encryptedKey *types.SecondLevelSymmetricKey, secretKey *types.SecretKey) (*big.Int, error) {
+	t, err := conditionScalar(secretKey, encryptedKey.Tag, encryptedKey.Epoch)
+	if err != nil || t == nil {
+		return secretKey.First, err
+	}
+
+	exponent := new(big.Int).Mul(secretKey.First, t)
+	return exponent.Mod(exponent, bn254.ID.ScalarField()), nil
+}
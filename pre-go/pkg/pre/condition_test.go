@@ -0,0 +1,110 @@
+package pre_test
+
+import (
+	"testing"
+
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre/types"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/testutils"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTaggedReEncryption(t *testing.T) {
+	scheme := pre.NewPreScheme()
+	keyPairAlice := testutils.GenerateRandomKeyPair(scheme.Params.G2, scheme.Params.Z)
+	keyPairBob := testutils.GenerateRandomKeyPair(scheme.Params.G2, scheme.Params.Z)
+
+	labKey, err := scheme.Client.(types.ConditionalClient).GenerateTaggedReEncryptionKey(keyPairAlice.SecretKey, keyPairBob.PublicKey, []byte("lab-results"))
+	require.NoError(t, err)
+	imagingKey, err := scheme.Client.(types.ConditionalClient).GenerateTaggedReEncryptionKey(keyPairAlice.SecretKey, keyPairBob.PublicKey, []byte("imaging"))
+	require.NoError(t, err)
+	plainKey := scheme.Client.GenerateReEncryptionKey(keyPairAlice.SecretKey, keyPairBob.PublicKey)
+
+	message := []byte("blood panel")
+	opts := &types.EncryptOptions{Tag: []byte("lab-results"), Prove: true}
+	encryptedKey, encryptedMessage, err := scheme.Client.SecondLevelEncryptionBytes(keyPairAlice.SecretKey, message, testutils.GenerateRandomScalar(), opts)
+	require.NoError(t, err)
+	require.Equal(t, []byte("lab-results"), encryptedKey.Tag)
+	require.NoError(t, pre.CheckCapsule(encryptedKey))
+
+	// the owner decrypts tagged keys like any other
+	decrypted, err := scheme.Client.DecryptSecondLevelBytes(encryptedKey, encryptedMessage, keyPairAlice.SecretKey)
+	require.NoError(t, err)
+	require.Equal(t, message, decrypted)
+
+	decrypted, err = scheme.Client.DecryptFirstLevelBytes(scheme.Proxy.ReEncryption(encryptedKey, labKey), encryptedMessage, keyPairBob.SecretKey)
+	require.NoError(t, err)
+	require.Equal(t, message, decrypted)
+
+	for name, reKey := range map[string]*types.ReEncryptionKey{"other tag": imagingKey, "untagged": plainKey} {
+		_, err := scheme.Client.DecryptFirstLevelBytes(scheme.Proxy.ReEncryption(encryptedKey, reKey), encryptedMessage, keyPairBob.SecretKey)
+		require.ErrorIs(t, err, types.ErrAuthenticationFailed, name)
+	}
+
+	t.Run("untagged keys", func(t *testing.T) {
+		// an empty tag is no tag
+		emptyKey, err := scheme.Client.(types.ConditionalClient).GenerateTaggedReEncryptionKey(keyPairAlice.SecretKey, keyPairBob.PublicKey, nil)
+		require.NoError(t, err)
+		require.True(t, emptyKey.Equal(plainKey))
+
+		plainEncryptedKey, plainMessage, err := scheme.Client.SecondLevelEncryptionBytes(keyPairAlice.SecretKey, message, testutils.GenerateRandomScalar(), nil)
+		require.NoError(t, err)
+		require.Nil(t, plainEncryptedKey.Tag)
+
+		decrypted, err := scheme.Client.DecryptFirstLevelBytes(scheme.Proxy.ReEncryption(plainEncryptedKey, plainKey), plainMessage, keyPairBob.SecretKey)
+		require.NoError(t, err)
+		require.Equal(t, message, decrypted)
+
+		_, err = scheme.Client.DecryptFirstLevelBytes(scheme.Proxy.ReEncryption(plainEncryptedKey, labKey), plainMessage, keyPairBob.SecretKey)
+		require.ErrorIs(t, err, types.ErrAuthenticationFailed)
+	})
+
+	t.Run("stripped tag", func(t *testing.T) {
+		stripped := *encryptedKey
+		stripped.Tag = nil
+		_, err := scheme.Client.DecryptSecondLevelBytes(&stripped, encryptedMessage, keyPairAlice.SecretKey)
+		require.ErrorIs(t, err, types.ErrAuthenticationFailed)
+
+		// which is why the bare encoding refuses tagged keys
+		_, err = encryptedKey.MarshalBinary()
+		require.ErrorIs(t, err, types.ErrAttributesNeedEnvelope)
+	})
+
+	t.Run("envelope", func(t *testing.T) {
+		envelope, err := scheme.Client.EncryptForRecipients(keyPairAlice.SecretKey, message, []*types.PublicKey{keyPairBob.PublicKey}, opts)
+		require.NoError(t, err)
+
+		data, err := envelope.Marshal()
+		require.NoError(t, err)
+		decoded := new(types.Envelope)
+		require.NoError(t, decoded.Unmarshal(data))
+		require.Equal(t, []byte("lab-results"), decoded.Capsule.Tag)
+
+		decrypted, err := scheme.Client.DecryptEnvelope(decoded, keyPairAlice.SecretKey)
+		require.NoError(t, err)
+		require.Equal(t, message, decrypted)
+		decrypted, err = scheme.Client.DecryptEnvelopeAsRecipient(decoded, keyPairBob.SecretKey)
+		require.NoError(t, err)
+		require.Equal(t, message, decrypted)
+
+		// the proxy adds recipients with the key of the tag
+		keyPairCharlie := testutils.GenerateRandomKeyPair(scheme.Params.G2, scheme.Params.Z)
+		charlieKey, err := scheme.Client.(types.ConditionalClient).GenerateTaggedReEncryptionKey(keyPairAlice.SecretKey, keyPairCharlie.PublicKey, []byte("lab-results"))
+		require.NoError(t, err)
+		require.NoError(t, scheme.Proxy.AddRecipient(decoded, keyPairCharlie.PublicKey.Fingerprint(), charlieKey))
+		decrypted, err = scheme.Client.DecryptEnvelopeAsRecipient(decoded, keyPairCharlie.SecretKey)
+		require.NoError(t, err)
+		require.Equal(t, message, decrypted)
+	})
+
+	t.Run("public key encryption", func(t *testing.T) {
+		_, _, err := scheme.Client.EncryptTo(keyPairAlice.PublicKey, message, opts)
+		require.Error(t, err)
+		_, _, err = scheme.Client.EncryptToPrepared(types.PreparePublicKey(keyPairAlice.PublicKey), message, opts)
+		require.Error(t, err)
+
+		cca := pre.NewPreScheme(pre.WithCCA())
+		_, _, err = cca.Client.SecondLevelEncryptionBytes(keyPairAlice.SecretKey, message, nil, opts)
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,79 @@
+package pre
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre/types"
+)
+
+// EpochFunc returns the epoch of an instant, see DailyEpoch, WeeklyEpoch and MonthlyEpoch
+type EpochFunc func(t time.Time) []byte
+
+// DailyEpoch returns the epoch of the UTC day of t, e.g. "day:2026-10-17"
+func DailyEpoch(t time.Time) []byte {
+	return []byte(t.UTC().Format("day:2006-01-02"))
+}
+
+// WeeklyEpoch returns the epoch of the ISO 8601 week of t in UTC, e.g. "week:2026-W42"
+func WeeklyEpoch(t time.Time) []byte {
+	year, week := t.UTC().ISOWeek()
+	return []byte(fmt.Sprintf("week:%04d-W%02d", year, week))
+}
+
+// MonthlyEpoch returns the epoch of the UTC month of t, e.g. "month:2026-10"
+func MonthlyEpoch(t time.Time) []byte {
+	return []byte(t.UTC().Format("month:2006-01"))
+}
+
+// Epochs returns the epochs of epoch from the one of from to the one of to, both included,
+// e.g. the 30 daily epochs of a 30-day consult. It returns nil if to is before from.
+func Epochs(from, to time.Time, epoch EpochFunc) [][]byte {
+	if to.Before(from) {
+		return nil
+	}
+
+	var epochs [][]byte
+	// epochs last at least a day, so stepping by days meets all of them
+	for day := from; ; day = day.Add(24 * time.Hour) {
+		if day.After(to) {
+			day = to
+		}
+		current := epoch(day)
+		if len(epochs) == 0 || string(epochs[len(epochs)-1]) != string(current) {
+			epochs = append(epochs, current)
+		}
+		if day.Equal(to) {
+			return epochs
+		}
+	}
+}
+
+// GenerateEpochReEncryptionKey generates a re-encryption key A->B that only re-encrypts keys
+// encrypted with the same tag and epoch in types.EncryptOptions. A grant to B lapses once
+// the epochs of its keys are over: A encrypts every key with the epoch of the time it is
+// encrypted at, e.g. DailyEpoch(time.Now()), and hands the proxy the keys of the epochs of
+// the grant, see Epochs. Keys of other epochs do not decrypt once re-encrypted, even if the
+// proxy keeps the re-encryption keys forever.
+//
+// The epoch is hashed with the tag, see GenerateTaggedReEncryptionKey; an empty epoch gives
+// the key of GenerateTaggedReEncryptionKey.
+func (p *preClient) GenerateEpochReEncryptionKey(secretA *types.SecretKey, publicB *types.PublicKey, tag, epoch []byte) (*types.ReEncryptionKey, error) {
+	return p.GenerateEpochReEncryptionKeyContext(context.Background(), secretA, publicB, tag, epoch)
+}
+
+// GenerateEpochReEncryptionKeyContext is GenerateEpochReEncryptionKey returning the error of
+// ctx if it is already done
+func (p *preClient) GenerateEpochReEncryptionKeyContext(ctx context.Context, secretA *types.SecretKey, publicB *types.PublicKey, tag, epoch []byte) (*types.ReEncryptionKey, error) {
+	reKey, err := p.GenerateReEncryptionKeyContext(ctx, secretA, publicB)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := conditionScalar(secretA, tag, epoch)
+	if err != nil || t == nil {
+		return reKey, err
+	}
+	return reKey.ScalarMultiplication(reKey, t), nil
+}
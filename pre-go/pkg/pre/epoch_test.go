@@ -0,0 +1,122 @@
+package pre_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre/types"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/testutils"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEpochs(t *testing.T) {
+	at := time.Date(2026, time.October, 17, 23, 30, 0, 0, time.FixedZone("UTC-2", -2*60*60))
+	require.Equal(t, "day:2026-10-18", string(pre.DailyEpoch(at)))
+	require.Equal(t, "week:2026-W42", string(pre.WeeklyEpoch(at)))
+	require.Equal(t, "month:2026-10", string(pre.MonthlyEpoch(at)))
+
+	// a 30-day consult
+	from := time.Date(2026, time.October, 17, 15, 0, 0, 0, time.UTC)
+	to := from.Add(29 * 24 * time.Hour)
+	days := pre.Epochs(from, to, pre.DailyEpoch)
+	require.Len(t, days, 30)
+	require.Equal(t, "day:2026-10-17", string(days[0]))
+	require.Equal(t, "day:2026-11-15", string(days[29]))
+
+	require.Equal(t, [][]byte{[]byte("month:2026-10"), []byte("month:2026-11")}, pre.Epochs(from, to, pre.MonthlyEpoch))
+	require.Len(t, pre.Epochs(from, to, pre.WeeklyEpoch), 5)
+	require.Equal(t, [][]byte{[]byte("day:2026-10-17")}, pre.Epochs(from, from, pre.DailyEpoch))
+	require.Nil(t, pre.Epochs(to, from, pre.DailyEpoch))
+}
+
+func TestEpochReEncryption(t *testing.T) {
+	scheme := pre.NewPreScheme()
+	keyPairAlice := testutils.GenerateRandomKeyPair(scheme.Params.G2, scheme.Params.Z)
+	keyPairBob := testutils.GenerateRandomKeyPair(scheme.Params.G2, scheme.Params.Z)
+
+	// alice grants bob the records of October, encrypted with monthly epochs
+	october := time.Date(2026, time.October, 17, 0, 0, 0, 0, time.UTC)
+	grant, err := scheme.Client.(types.ConditionalClient).GenerateEpochReEncryptionKey(keyPairAlice.SecretKey, keyPairBob.PublicKey, nil, pre.MonthlyEpoch(october))
+	require.NoError(t, err)
+
+	encrypt := func(tag []byte, at time.Time) (*types.SecondLevelSymmetricKey, []byte) {
+		opts := &types.EncryptOptions{Tag: tag, Epoch: pre.MonthlyEpoch(at), Prove: true}
+		encryptedKey, encryptedMessage, err := scheme.Client.SecondLevelEncryptionBytes(keyPairAlice.SecretKey, []byte("visit notes"), testutils.GenerateRandomScalar(), opts)
+		require.NoError(t, err)
+		require.NoError(t, pre.CheckCapsule(encryptedKey))
+
+		// the owner decrypts keys of every epoch
+		decrypted, err := scheme.Client.DecryptSecondLevelBytes(encryptedKey, encryptedMessage, keyPairAlice.SecretKey)
+		require.NoError(t, err)
+		require.Equal(t, []byte("visit notes"), decrypted)
+		return encryptedKey, encryptedMessage
+	}
+
+	encryptedKey, encryptedMessage := encrypt(nil, october.Add(7*24*time.Hour))
+	require.Equal(t, []byte("month:2026-10"), encryptedKey.Epoch)
+	decrypted, err := scheme.Client.DecryptFirstLevelBytes(scheme.Proxy.ReEncryption(encryptedKey, grant), encryptedMessage, keyPairBob.SecretKey)
+	require.NoError(t, err)
+	require.Equal(t, []byte("visit notes"), decrypted)
+
+	t.Run("other epochs", func(t *testing.T) {
+		for _, at := range []time.Time{october.AddDate(0, 1, 0), october.AddDate(0, -1, 0), october.AddDate(1, 0, 0)} {
+			encryptedKey, encryptedMessage := encrypt(nil, at)
+			_, err := scheme.Client.DecryptFirstLevelBytes(scheme.Proxy.ReEncryption(encryptedKey, grant), encryptedMessage, keyPairBob.SecretKey)
+			require.ErrorIs(t, err, types.ErrAuthenticationFailed, at)
+		}
+
+		// nor does the key of an epoch re-encrypt keys without epoch, or the other way around
+		plainKey, plainMessage, err := scheme.Client.SecondLevelEncryptionBytes(keyPairAlice.SecretKey, []byte("visit notes"), testutils.GenerateRandomScalar(), nil)
+		require.NoError(t, err)
+		_, err = scheme.Client.DecryptFirstLevelBytes(scheme.Proxy.ReEncryption(plainKey, grant), plainMessage, keyPairBob.SecretKey)
+		require.ErrorIs(t, err, types.ErrAuthenticationFailed)
+
+		plainReKey := scheme.Client.GenerateReEncryptionKey(keyPairAlice.SecretKey, keyPairBob.PublicKey)
+		_, err = scheme.Client.DecryptFirstLevelBytes(scheme.Proxy.ReEncryption(encryptedKey, plainReKey), encryptedMessage, keyPairBob.SecretKey)
+		require.ErrorIs(t, err, types.ErrAuthenticationFailed)
+	})
+
+	t.Run("tagged epochs", func(t *testing.T) {
+		labGrant, err := scheme.Client.(types.ConditionalClient).GenerateEpochReEncryptionKey(keyPairAlice.SecretKey, keyPairBob.PublicKey, []byte("lab-results"), pre.MonthlyEpoch(october))
+		require.NoError(t, err)
+
+		encryptedKey, encryptedMessage := encrypt([]byte("lab-results"), october)
+		decrypted, err := scheme.Client.DecryptFirstLevelBytes(scheme.Proxy.ReEncryption(encryptedKey, labGrant), encryptedMessage, keyPairBob.SecretKey)
+		require.NoError(t, err)
+		require.Equal(t, []byte("visit notes"), decrypted)
+
+		// the grant of the epoch without tag and the key of the tag without epoch do not apply
+		tagKey, err := scheme.Client.(types.ConditionalClient).GenerateTaggedReEncryptionKey(keyPairAlice.SecretKey, keyPairBob.PublicKey, []byte("lab-results"))
+		require.NoError(t, err)
+		for _, reKey := range []*types.ReEncryptionKey{grant, tagKey} {
+			_, err := scheme.Client.DecryptFirstLevelBytes(scheme.Proxy.ReEncryption(encryptedKey, reKey), encryptedMessage, keyPairBob.SecretKey)
+			require.ErrorIs(t, err, types.ErrAuthenticationFailed)
+		}
+	})
+
+	t.Run("envelope", func(t *testing.T) {
+		opts := &types.EncryptOptions{Epoch: pre.MonthlyEpoch(october)}
+		envelope, err := scheme.Client.EncryptForRecipients(keyPairAlice.SecretKey, []byte("visit notes"), []*types.PublicKey{keyPairBob.PublicKey}, opts)
+		require.NoError(t, err)
+
+		data, err := envelope.Marshal()
+		require.NoError(t, err)
+		decoded := new(types.Envelope)
+		require.NoError(t, decoded.Unmarshal(data))
+		require.Equal(t, []byte("month:2026-10"), decoded.Capsule.Epoch)
+		require.Equal(t, []byte("month:2026-10"), decoded.RecipientKey(keyPairBob.PublicKey.Fingerprint()).Epoch)
+		_, err = decoded.Capsule.MarshalBinary()
+		require.ErrorIs(t, err, types.ErrAttributesNeedEnvelope)
+
+		decrypted, err := scheme.Client.DecryptEnvelope(decoded, keyPairAlice.SecretKey)
+		require.NoError(t, err)
+		require.Equal(t, []byte("visit notes"), decrypted)
+		decrypted, err = scheme.Client.DecryptEnvelopeAsRecipient(decoded, keyPairBob.SecretKey)
+		require.NoError(t, err)
+		require.Equal(t, []byte("visit notes"), decrypted)
+
+		_, _, err = scheme.Client.EncryptTo(keyPairAlice.PublicKey, []byte("visit notes"), opts)
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,137 @@
+// Package fixedbase implements fixed-base scalar multiplication and exponentiation on BN254.
+//
+// A table holds base^(d·16^i) for every 4-bit digit d and every position i of a scalar, so
+// raising the base to a scalar takes one group operation per non-zero digit and no doubling
+// or squaring. Tables pay off for bases that are used many times, like the generators of
+// the system parameters or the public key of a data owner.
+package fixedbase
+
+import (
+	"math/big"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+)
+
+const (
+	windowSize = 4
+	digits     = 1<<windowSize - 1 // non-zero values of a digit
+	windows    = (fr.Bits + windowSize - 1) / windowSize
+)
+
+// digitsOf splits the scalar, reduced modulo the group order, into little-endian base-16 digits
+func digitsOf(k *big.Int) [windows]uint8 {
+	var e fr.Element
+	e.SetBigInt(k)
+	limbs := e.Bits()
+
+	var d [windows]uint8
+	for i := range d {
+		bit := i * windowSize
+		d[i] = uint8(limbs[bit/64]>>(bit%64)) & digits
+	}
+	return d
+}
+
+// G1 is a fixed-base table of a point of G1
+type G1 struct {
+	table [windows][digits]bn254.G1Affine
+}
+
+// NewG1 precomputes the table of base
+func NewG1(base *bn254.G1Affine) *G1 {
+	t := new(G1)
+
+	var jac [windows * digits]bn254.G1Jac
+	var window bn254.G1Jac
+	window.FromAffine(base)
+	for i := 0; i < windows; i++ {
+		jac[i*digits] = window
+		for d := 1; d < digits; d++ {
+			jac[i*digits+d].Set(&jac[i*digits+d-1]).AddAssign(&window)
+		}
+		window.Set(&jac[i*digits+digits-1]).AddAssign(&jac[i*digits])
+	}
+
+	affine := bn254.BatchJacobianToAffineG1(jac[:])
+	for i := range t.table {
+		copy(t.table[i][:], affine[i*digits:])
+	}
+	return t
+}
+
+// ScalarMultiplication returns base^k
+func (t *G1) ScalarMultiplication(k *big.Int) *bn254.G1Affine {
+	var acc bn254.G1Jac
+	for i, d := range digitsOf(k) {
+		if d != 0 {
+			acc.AddMixed(&t.table[i][d-1])
+		}
+	}
+	return new(bn254.G1Affine).FromJacobian(&acc)
+}
+
+// G2 is a fixed-base table of a point of G2
+type G2 struct {
+	table [windows][digits]bn254.G2Affine
+}
+
+// NewG2 precomputes the table of base
+func NewG2(base *bn254.G2Affine) *G2 {
+	t := new(G2)
+
+	var window, acc bn254.G2Jac
+	window.FromAffine(base)
+	for i := 0; i < windows; i++ {
+		acc = window
+		t.table[i][0].FromJacobian(&acc)
+		for d := 1; d < digits; d++ {
+			acc.AddAssign(&window)
+			t.table[i][d].FromJacobian(&acc)
+		}
+		window.AddAssign(&acc)
+	}
+	return t
+}
+
+// ScalarMultiplication returns base^k
+func (t *G2) ScalarMultiplication(k *big.Int) *bn254.G2Affine {
+	var acc bn254.G2Jac
+	for i, d := range digitsOf(k) {
+		if d != 0 {
+			acc.AddMixed(&t.table[i][d-1])
+		}
+	}
+	return new(bn254.G2Affine).FromJacobian(&acc)
+}
+
+// GT is a fixed-base table of an element of GT
+type GT struct {
+	table [windows][digits]bn254.GT
+}
+
+// NewGT precomputes the table of base
+func NewGT(base *bn254.GT) *GT {
+	t := new(GT)
+
+	window := *base
+	for i := 0; i < windows; i++ {
+		t.table[i][0] = window
+		for d := 1; d < digits; d++ {
+			t.table[i][d].Mul(&t.table[i][d-1], &window)
+		}
+		window.Mul(&t.table[i][digits-1], &window)
+	}
+	return t
+}
+
+// Exp returns base^k
+func (t *GT) Exp(k *big.Int) *bn254.GT {
+	result := new(bn254.GT).SetOne()
+	for i, d := range digitsOf(k) {
+		if d != 0 {
+			result.Mul(result, &t.table[i][d-1])
+		}
+	}
+	return result
+}
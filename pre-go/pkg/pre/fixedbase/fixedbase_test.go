@@ -0,0 +1,109 @@
+package fixedbase_test
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre/fixedbase"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/testutils"
+	"github.com/stretchr/testify/require"
+)
+
+func testScalars() []*big.Int {
+	order := bn254.ID.ScalarField()
+	return []*big.Int{
+		big.NewInt(0),
+		big.NewInt(1),
+		big.NewInt(15),
+		big.NewInt(16),
+		new(big.Int).Sub(order, big.NewInt(1)),
+		order,
+		new(big.Int).Add(order, big.NewInt(2)),
+		testutils.GenerateRandomScalar(),
+		testutils.GenerateRandomScalar(),
+	}
+}
+
+func TestG1(t *testing.T) {
+	base := testutils.GenerateRandomG1Elem()
+	table := fixedbase.NewG1(base)
+	for _, k := range testScalars() {
+		expected := new(bn254.G1Affine).ScalarMultiplication(base, k)
+		require.True(t, expected.Equal(table.ScalarMultiplication(k)), "k = %v", k)
+	}
+}
+
+func TestG2(t *testing.T) {
+	base := testutils.GenerateRandomG2Elem()
+	table := fixedbase.NewG2(base)
+	for _, k := range testScalars() {
+		expected := new(bn254.G2Affine).ScalarMultiplication(base, k)
+		require.True(t, expected.Equal(table.ScalarMultiplication(k)), "k = %v", k)
+	}
+}
+
+func TestGT(t *testing.T) {
+	base := testutils.GenerateRandomGTElem()
+	table := fixedbase.NewGT(base)
+	for _, k := range testScalars() {
+		expected := new(bn254.GT).Exp(*base, k)
+		require.True(t, expected.Equal(table.Exp(k)), "k = %v", k)
+	}
+}
+
+func BenchmarkG1(b *testing.B) {
+	base := testutils.GenerateRandomG1Elem()
+	k := testutils.GenerateRandomScalar()
+	b.Run("generic", func(b *testing.B) {
+		for n := 0; n < b.N; n++ {
+			new(bn254.G1Affine).ScalarMultiplication(base, k)
+		}
+	})
+	b.Run("fixed-base", func(b *testing.B) {
+		table := fixedbase.NewG1(base)
+		b.ResetTimer()
+		for n := 0; n < b.N; n++ {
+			table.ScalarMultiplication(k)
+		}
+	})
+}
+
+func BenchmarkG2(b *testing.B) {
+	base := testutils.GenerateRandomG2Elem()
+	k := testutils.GenerateRandomScalar()
+	b.Run("generic", func(b *testing.B) {
+		for n := 0; n < b.N; n++ {
+			new(bn254.G2Affine).ScalarMultiplication(base, k)
+		}
+	})
+	b.Run("fixed-base", func(b *testing.B) {
+		table := fixedbase.NewG2(base)
+		b.ResetTimer()
+		for n := 0; n < b.N; n++ {
+			table.ScalarMultiplication(k)
+		}
+	})
+}
+
+func BenchmarkGT(b *testing.B) {
+	base := testutils.GenerateRandomGTElem()
+	k := testutils.GenerateRandomScalar()
+	b.Run("generic", func(b *testing.B) {
+		for n := 0; n < b.N; n++ {
+			new(bn254.GT).Exp(*base, k)
+		}
+	})
+	b.Run("fixed-base", func(b *testing.B) {
+		table := fixedbase.NewGT(base)
+		b.ResetTimer()
+		for n := 0; n < b.N; n++ {
+			table.Exp(k)
+		}
+	})
+	b.Run("precompute", func(b *testing.B) {
+		for n := 0; n < b.N; n++ {
+			fixedbase.NewGT(base)
+		}
+	})
+}
@@ -0,0 +1,121 @@
+// Package keys generates and validates key pairs for the PRE scheme.
+package keys
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre/types"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre/utils"
+	"golang.org/x/crypto/hkdf"
+)
+
+// MinSeedSize is the minimum seed length accepted by DeriveKeyPair
+const MinSeedSize = 32
+
+var (
+	// ErrInvalidSecretKey is returned for secret keys with a missing, zero or out of range scalar
+	ErrInvalidSecretKey = errors.New("invalid secret key")
+
+	// ErrKeyMismatch is returned when a public key does not belong to the secret key it is paired with
+	ErrKeyMismatch = errors.New("public key does not match secret key")
+)
+
+// RandomScalar draws a uniformly random non-zero scalar of the BN254 scalar field from rand.
+func RandomScalar(rand io.Reader) (*big.Int, error) {
+	order := bn254.ID.ScalarField()
+	// 48 bytes reduced modulo the 254-bit order keeps the bias below 2^-128
+	buf := make([]byte, 48)
+	for {
+		if _, err := io.ReadFull(rand, buf); err != nil {
+			return nil, fmt.Errorf("failed to read randomness: %v", err)
+		}
+		scalar := new(big.Int).SetBytes(buf)
+		scalar.Mod(scalar, order)
+		if scalar.Sign() > 0 {
+			return scalar, nil
+		}
+	}
+}
+
+// GenerateKeyPair generates a random key pair, reading randomness from rand
+// (usually crypto/rand.Reader).
+func GenerateKeyPair(params types.SystemParams, rand io.Reader) (*types.KeyPair, error) {
+	first, err := RandomScalar(rand)
+	if err != nil {
+		return nil, err
+	}
+	second, err := RandomScalar(rand)
+	if err != nil {
+		return nil, err
+	}
+
+	return newKeyPair(params, &types.SecretKey{First: first, Second: second})
+}
+
+// DeriveKeyPair deterministically derives a key pair from a seed of at least MinSeedSize bytes.
+// The same seed always yields the same key pair, so the seed must be kept as secret as the key.
+func DeriveKeyPair(params types.SystemParams, seed []byte) (*types.KeyPair, error) {
+	if len(seed) < MinSeedSize {
+		return nil, fmt.Errorf("seed too short: need at least %d bytes, got %d", MinSeedSize, len(seed))
+	}
+
+	// HKDF output is an endless pseudorandom stream, so rejection sampling in RandomScalar terminates
+	stream := hkdf.New(sha256.New, seed, []byte("PRE_derive_keypair"), []byte("PRE_secret_key"))
+	return GenerateKeyPair(params, stream)
+}
+
+// SecretToPubkey validates the secret key and computes the matching public key (Z^a1, g2^a2).
+func SecretToPubkey(params types.SystemParams, secret *types.SecretKey) (*types.PublicKey, error) {
+	if err := ValidateSecretKey(secret); err != nil {
+		return nil, err
+	}
+
+	return utils.SecretToPubkey(secret, params.G2, params.Z), nil
+}
+
+// ValidateSecretKey checks that both scalars of the secret key are non-zero elements of the
+// scalar field. A zero scalar would map to the identity and make every ciphertext trivial.
+func ValidateSecretKey(secret *types.SecretKey) error {
+	if secret == nil || !isValidScalar(secret.First) || !isValidScalar(secret.Second) {
+		return ErrInvalidSecretKey
+	}
+	return nil
+}
+
+// ValidateKeyPair checks that the secret key is valid and that the public key belongs to it.
+func ValidateKeyPair(params types.SystemParams, keyPair *types.KeyPair) error {
+	if keyPair == nil || keyPair.PublicKey == nil || keyPair.PublicKey.First == nil || keyPair.PublicKey.Second == nil {
+		return fmt.Errorf("incomplete key pair")
+	}
+
+	publicKey, err := SecretToPubkey(params, keyPair.SecretKey)
+	if err != nil {
+		return err
+	}
+
+	if !publicKey.First.Equal(keyPair.PublicKey.First) || !publicKey.Second.Equal(keyPair.PublicKey.Second) {
+		return ErrKeyMismatch
+	}
+	return nil
+}
+
+func newKeyPair(params types.SystemParams, secret *types.SecretKey) (*types.KeyPair, error) {
+	publicKey, err := SecretToPubkey(params, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	return &types.KeyPair{
+		PublicKey: publicKey,
+		SecretKey: secret,
+	}, nil
+}
+
+func isValidScalar(s *big.Int) bool {
+	return s != nil && s.Sign() > 0 && s.Cmp(bn254.ID.ScalarField()) < 0
+}
@@ -0,0 +1,102 @@
+package keys_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"math/big"
+	"testing"
+
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre/keys"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateKeyPair(t *testing.T) {
+	scheme := pre.NewPreScheme()
+
+	keyPair, err := keys.GenerateKeyPair(scheme.Params, rand.Reader)
+	require.NoError(t, err)
+	require.NoError(t, keys.ValidateKeyPair(scheme.Params, keyPair))
+
+	other, err := keys.GenerateKeyPair(scheme.Params, rand.Reader)
+	require.NoError(t, err)
+	require.NotEqual(t, keyPair.SecretKey, other.SecretKey)
+
+	t.Run("failing reader", func(t *testing.T) {
+		_, err := keys.GenerateKeyPair(scheme.Params, bytes.NewReader(nil))
+		require.Error(t, err)
+	})
+
+	t.Run("zero randomness is rejected", func(t *testing.T) {
+		// an all-zero source can never produce a valid scalar, so only the exhausted reader stops it
+		_, err := keys.GenerateKeyPair(scheme.Params, bytes.NewReader(make([]byte, 1024)))
+		require.Error(t, err)
+	})
+}
+
+func TestDeriveKeyPair(t *testing.T) {
+	scheme := pre.NewPreScheme()
+	seed := bytes.Repeat([]byte{7}, keys.MinSeedSize)
+
+	keyPair, err := keys.DeriveKeyPair(scheme.Params, seed)
+	require.NoError(t, err)
+	require.NoError(t, keys.ValidateKeyPair(scheme.Params, keyPair))
+
+	again, err := keys.DeriveKeyPair(scheme.Params, seed)
+	require.NoError(t, err)
+	require.Equal(t, keyPair.SecretKey, again.SecretKey)
+
+	otherSeed := bytes.Repeat([]byte{8}, keys.MinSeedSize)
+	other, err := keys.DeriveKeyPair(scheme.Params, otherSeed)
+	require.NoError(t, err)
+	require.NotEqual(t, keyPair.SecretKey, other.SecretKey)
+
+	_, err = keys.DeriveKeyPair(scheme.Params, seed[:16])
+	require.Error(t, err)
+}
+
+func TestValidateKeys(t *testing.T) {
+	scheme := pre.NewPreScheme()
+	keyPair, err := keys.GenerateKeyPair(scheme.Params, rand.Reader)
+	require.NoError(t, err)
+
+	t.Run("zero secret", func(t *testing.T) {
+		_, err := keys.SecretToPubkey(scheme.Params, &types.SecretKey{First: big.NewInt(0), Second: big.NewInt(1)})
+		require.ErrorIs(t, err, keys.ErrInvalidSecretKey)
+	})
+
+	t.Run("out of range secret", func(t *testing.T) {
+		_, err := keys.SecretToPubkey(scheme.Params, &types.SecretKey{First: big.NewInt(1), Second: new(big.Int).Lsh(big.NewInt(1), 300)})
+		require.ErrorIs(t, err, keys.ErrInvalidSecretKey)
+	})
+
+	t.Run("nil secret", func(t *testing.T) {
+		require.ErrorIs(t, keys.ValidateSecretKey(nil), keys.ErrInvalidSecretKey)
+	})
+
+	t.Run("mismatched key pair", func(t *testing.T) {
+		other, err := keys.GenerateKeyPair(scheme.Params, rand.Reader)
+		require.NoError(t, err)
+
+		mismatched := &types.KeyPair{PublicKey: other.PublicKey, SecretKey: keyPair.SecretKey}
+		require.ErrorIs(t, keys.ValidateKeyPair(scheme.Params, mismatched), keys.ErrKeyMismatch)
+	})
+}
+
+func TestZeroize(t *testing.T) {
+	scheme := pre.NewPreScheme()
+	keyPair, err := keys.GenerateKeyPair(scheme.Params, rand.Reader)
+	require.NoError(t, err)
+
+	first := keyPair.SecretKey.First
+	words := first.Bits()
+
+	keyPair.SecretKey.Zeroize()
+	require.Zero(t, keyPair.SecretKey.First.Sign())
+	require.Zero(t, keyPair.SecretKey.Second.Sign())
+	for _, word := range words {
+		require.Zero(t, word)
+	}
+	require.ErrorIs(t, keys.ValidateSecretKey(keyPair.SecretKey), keys.ErrInvalidSecretKey)
+}
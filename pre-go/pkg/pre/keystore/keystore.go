@@ -0,0 +1,349 @@
+// Package keystore stores key pairs in passphrase-protected JSON files.
+//
+// The format is modelled on version 3 of the Ethereum keystore: the secret key is encrypted
+// under a key derived from the passphrase with scrypt or Argon2id, and the file keeps the
+// KDF parameters, the salt, a checksum of the ciphertext and the public key in cleartext,
+// so a keystore can be looked up without the passphrase.
+//
+//	{
+//	  "version": 1,
+//	  "id": "<random hex>",
+//	  "fingerprint": "<hex SHA-256 of the public key>",
+//	  "publicKey": {"First": "<base64 GT>", "Second": "<base64 G2>"},
+//	  "crypto": {
+//	    "cipher": "aes-256-gcm",
+//	    "ciphertext": "<hex nonce || ciphertext || tag>",
+//	    "kdf": "scrypt",
+//	    "kdfparams": {"dklen": 64, "salt": "<hex>", "n": 262144, "r": 8, "p": 1},
+//	    "mac": "<hex SHA-256(derived key[32:64] || ciphertext)>"
+//	  }
+//	}
+//
+// The first 32 bytes of the derived key encrypt the 64-byte canonical encoding of the secret
+// key with pkg/crypto's AES-GCM, authenticating the public key as additional data. The last
+// 32 bytes feed the checksum, which tells a wrong passphrase apart from a damaged file.
+package keystore
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/crypto"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre/types"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Version is the keystore format version written by Encrypt
+const Version = 1
+
+// KDF names a passphrase-based key derivation function
+type KDF string
+
+const (
+	// KDFScrypt derives the key with scrypt
+	KDFScrypt KDF = "scrypt"
+	// KDFArgon2id derives the key with Argon2id
+	KDFArgon2id KDF = "argon2id"
+)
+
+const (
+	cipherAES256GCM = "aes-256-gcm"
+
+	derivedKeySize = 64
+	saltSize       = 32
+
+	// upper bounds on the parameters read from a file, so a crafted keystore cannot make
+	// Decrypt allocate arbitrary amounts of memory
+	maxScryptMemory  = 1 << 30 // bytes, 128 * N * r
+	maxArgon2Memory  = 1 << 22 // KiB
+	maxArgon2Time    = 64
+	maxScryptThreads = 64
+)
+
+var (
+	// ErrWrongPassphrase is returned when the passphrase does not open the keystore
+	ErrWrongPassphrase = errors.New("wrong passphrase")
+
+	// ErrInvalidKeystore is returned for keystore data that cannot be parsed or was tampered with
+	ErrInvalidKeystore = errors.New("invalid keystore")
+
+	// ErrUnsupportedKeystore is returned for keystores using a version, cipher or KDF
+	// this build does not know about
+	ErrUnsupportedKeystore = errors.New("unsupported keystore")
+)
+
+// Options selects the KDF and its cost when encrypting a keystore
+type Options struct {
+	KDF KDF
+
+	// scrypt parameters: CPU/memory cost (a power of two), block size and parallelism
+	ScryptN, ScryptR, ScryptP int
+
+	// Argon2id parameters: passes, memory in KiB and parallelism
+	Argon2Time    uint32
+	Argon2Memory  uint32
+	Argon2Threads uint8
+}
+
+var (
+	// StandardScrypt takes about a second and 256 MiB on a modern machine
+	StandardScrypt = Options{KDF: KDFScrypt, ScryptN: 1 << 18, ScryptR: 8, ScryptP: 1}
+
+	// LightScrypt takes about 100 ms and 4 MiB, for mobile and browser environments
+	LightScrypt = Options{KDF: KDFScrypt, ScryptN: 1 << 12, ScryptR: 8, ScryptP: 6}
+
+	// StandardArgon2id follows the second recommended option of RFC 9106 (64 MiB, 3 passes)
+	StandardArgon2id = Options{KDF: KDFArgon2id, Argon2Time: 3, Argon2Memory: 64 * 1024, Argon2Threads: 4}
+)
+
+// keystoreJSON is the serialized keystore
+type keystoreJSON struct {
+	Version     int              `json:"version"`
+	ID          string           `json:"id"`
+	Fingerprint string           `json:"fingerprint"`
+	PublicKey   *types.PublicKey `json:"publicKey"`
+	Crypto      cryptoJSON       `json:"crypto"`
+}
+
+type cryptoJSON struct {
+	Cipher     string        `json:"cipher"`
+	CipherText string        `json:"ciphertext"`
+	KDF        KDF           `json:"kdf"`
+	KDFParams  kdfParamsJSON `json:"kdfparams"`
+	MAC        string        `json:"mac"`
+}
+
+type kdfParamsJSON struct {
+	DKLen int    `json:"dklen"`
+	Salt  string `json:"salt"`
+
+	N int `json:"n,omitempty"`
+	R int `json:"r,omitempty"`
+	P int `json:"p,omitempty"`
+
+	Time    uint32 `json:"time,omitempty"`
+	Memory  uint32 `json:"memory,omitempty"`
+	Threads uint8  `json:"threads,omitempty"`
+}
+
+// Encrypt serializes the key pair into a keystore protected by passphrase.
+// A nil opts uses StandardScrypt.
+func Encrypt(keyPair *types.KeyPair, passphrase []byte, opts *Options) ([]byte, error) {
+	if keyPair == nil {
+		return nil, fmt.Errorf("%w: missing key pair", types.ErrInvalidKey)
+	}
+	if opts == nil {
+		opts = &StandardScrypt
+	}
+
+	secret, err := keyPair.SecretKey.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	defer clear(secret)
+	public, err := keyPair.PublicKey.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	salt := make([]byte, saltSize)
+	id := make([]byte, 16)
+	if _, err = io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, fmt.Errorf("could not generate salt: %v", err)
+	}
+	if _, err = io.ReadFull(rand.Reader, id); err != nil {
+		return nil, fmt.Errorf("could not generate id: %v", err)
+	}
+
+	params := kdfParamsJSON{DKLen: derivedKeySize, Salt: hex.EncodeToString(salt)}
+	switch opts.KDF {
+	case KDFScrypt:
+		params.N, params.R, params.P = opts.ScryptN, opts.ScryptR, opts.ScryptP
+	case KDFArgon2id:
+		params.Time, params.Memory, params.Threads = opts.Argon2Time, opts.Argon2Memory, opts.Argon2Threads
+	default:
+		return nil, fmt.Errorf("%w: kdf %q", ErrUnsupportedKeystore, opts.KDF)
+	}
+
+	derivedKey, err := deriveKey(opts.KDF, params, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	defer clear(derivedKey)
+
+	ciphertext, err := crypto.EncryptAESGCMWithAD(secret, derivedKey[:32], public, nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not encrypt secret key: %v", err)
+	}
+
+	return json.MarshalIndent(keystoreJSON{
+		Version:     Version,
+		ID:          hex.EncodeToString(id),
+		Fingerprint: hex.EncodeToString(keyPair.PublicKey.Fingerprint()),
+		PublicKey:   keyPair.PublicKey,
+		Crypto: cryptoJSON{
+			Cipher:     cipherAES256GCM,
+			CipherText: hex.EncodeToString(ciphertext),
+			KDF:        opts.KDF,
+			KDFParams:  params,
+			MAC:        hex.EncodeToString(checksum(derivedKey, ciphertext)),
+		},
+	}, "", "  ")
+}
+
+// Decrypt opens a keystore produced by Encrypt. It returns ErrWrongPassphrase when the
+// checksum does not match the passphrase and ErrInvalidKeystore when the file is damaged.
+func Decrypt(data []byte, passphrase []byte) (*types.KeyPair, error) {
+	var keystore keystoreJSON
+	if err := json.Unmarshal(data, &keystore); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKeystore, err)
+	}
+	if keystore.Version != Version {
+		return nil, fmt.Errorf("%w: version %d", ErrUnsupportedKeystore, keystore.Version)
+	}
+	if keystore.Crypto.Cipher != cipherAES256GCM {
+		return nil, fmt.Errorf("%w: cipher %q", ErrUnsupportedKeystore, keystore.Crypto.Cipher)
+	}
+	if keystore.PublicKey == nil {
+		return nil, fmt.Errorf("%w: missing public key", ErrInvalidKeystore)
+	}
+
+	ciphertext, err := hex.DecodeString(keystore.Crypto.CipherText)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid ciphertext: %v", ErrInvalidKeystore, err)
+	}
+	mac, err := hex.DecodeString(keystore.Crypto.MAC)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid mac: %v", ErrInvalidKeystore, err)
+	}
+
+	derivedKey, err := deriveKey(keystore.Crypto.KDF, keystore.Crypto.KDFParams, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	defer clear(derivedKey)
+
+	if subtle.ConstantTimeCompare(checksum(derivedKey, ciphertext), mac) != 1 {
+		return nil, ErrWrongPassphrase
+	}
+
+	public, err := keystore.PublicKey.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	secret, err := crypto.DecryptAESGCMWithAD(ciphertext, derivedKey[:32], public)
+	if err != nil {
+		// the checksum matched, so the passphrase is right and the file was modified
+		return nil, fmt.Errorf("%w: could not decrypt secret key: %v", ErrInvalidKeystore, err)
+	}
+	defer clear(secret)
+
+	secretKey := new(types.SecretKey)
+	if err = secretKey.UnmarshalBinary(secret); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKeystore, err)
+	}
+
+	return &types.KeyPair{PublicKey: keystore.PublicKey, SecretKey: secretKey}, nil
+}
+
+// Save encrypts the key pair and writes the keystore to filename with mode 0600.
+// It fails if the file already exists, so a keystore is never overwritten by accident.
+func Save(filename string, keyPair *types.KeyPair, passphrase []byte, opts *Options) error {
+	data, err := Encrypt(keyPair, passphrase, opts)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(filepath.Clean(filename), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to create keystore file: %v", err)
+	}
+	if _, err = file.Write(data); err != nil {
+		_ = file.Close()
+		_ = os.Remove(filename)
+		return fmt.Errorf("failed to write keystore file: %v", err)
+	}
+	if err = file.Close(); err != nil {
+		_ = os.Remove(filename)
+		return fmt.Errorf("failed to write keystore file: %v", err)
+	}
+
+	return nil
+}
+
+// Load reads the keystore in filename and decrypts it with passphrase
+func Load(filename string, passphrase []byte) (*types.KeyPair, error) {
+	data, err := os.ReadFile(filepath.Clean(filename))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keystore file: %v", err)
+	}
+	return Decrypt(data, passphrase)
+}
+
+// PublicKey returns the cleartext public key of a keystore without decrypting it
+func PublicKey(data []byte) (*types.PublicKey, error) {
+	var keystore keystoreJSON
+	if err := json.Unmarshal(data, &keystore); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKeystore, err)
+	}
+	if keystore.PublicKey == nil {
+		return nil, fmt.Errorf("%w: missing public key", ErrInvalidKeystore)
+	}
+
+	fingerprint, err := hex.DecodeString(keystore.Fingerprint)
+	if err != nil || !bytes.Equal(fingerprint, keystore.PublicKey.Fingerprint()) {
+		return nil, fmt.Errorf("%w: fingerprint does not match public key", ErrInvalidKeystore)
+	}
+
+	return keystore.PublicKey, nil
+}
+
+// deriveKey runs the KDF named in the keystore, rejecting parameters outside sane bounds
+func deriveKey(kdf KDF, params kdfParamsJSON, passphrase []byte) ([]byte, error) {
+	if params.DKLen != derivedKeySize {
+		return nil, fmt.Errorf("%w: derived key size %d", ErrUnsupportedKeystore, params.DKLen)
+	}
+	salt, err := hex.DecodeString(params.Salt)
+	if err != nil || len(salt) < 16 {
+		return nil, fmt.Errorf("%w: invalid salt", ErrInvalidKeystore)
+	}
+
+	switch kdf {
+	case KDFScrypt:
+		if params.N <= 1 || params.N&(params.N-1) != 0 || params.R <= 0 || params.P <= 0 ||
+			params.P > maxScryptThreads || 128*params.N*params.R > maxScryptMemory {
+			return nil, fmt.Errorf("%w: invalid scrypt parameters", ErrInvalidKeystore)
+		}
+		key, err := scrypt.Key(passphrase, salt, params.N, params.R, params.P, params.DKLen)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidKeystore, err)
+		}
+		return key, nil
+	case KDFArgon2id:
+		if params.Time == 0 || params.Time > maxArgon2Time || params.Memory == 0 ||
+			params.Memory > maxArgon2Memory || params.Threads == 0 {
+			return nil, fmt.Errorf("%w: invalid argon2id parameters", ErrInvalidKeystore)
+		}
+		return argon2.IDKey(passphrase, salt, params.Time, params.Memory, params.Threads, derivedKeySize), nil
+	default:
+		return nil, fmt.Errorf("%w: kdf %q", ErrUnsupportedKeystore, kdf)
+	}
+}
+
+// checksum binds the ciphertext to the second half of the derived key
+func checksum(derivedKey, ciphertext []byte) []byte {
+	h := sha256.New()
+	h.Write(derivedKey[32:])
+	h.Write(ciphertext)
+	return h.Sum(nil)
+}
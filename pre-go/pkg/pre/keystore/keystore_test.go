@@ -0,0 +1,130 @@
+package keystore_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre/keystore"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre/types"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/testutils"
+	"github.com/stretchr/testify/require"
+)
+
+// fastArgon2id keeps the tests quick; never use it for real keystores
+var fastArgon2id = keystore.Options{KDF: keystore.KDFArgon2id, Argon2Time: 1, Argon2Memory: 1024, Argon2Threads: 1}
+
+func loadKeyPair(t *testing.T) *types.KeyPair {
+	keyPair, err := testutils.LoadKeyPairFromFile("../../../../testdata/alice_keypair.json")
+	require.NoError(t, err)
+	return keyPair
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	keyPair := loadKeyPair(t)
+	passphrase := []byte("correct horse battery staple")
+
+	for name, opts := range map[string]keystore.Options{
+		"scrypt":   keystore.LightScrypt,
+		"argon2id": fastArgon2id,
+	} {
+		t.Run(name, func(t *testing.T) {
+			data, err := keystore.Encrypt(keyPair, passphrase, &opts)
+			require.NoError(t, err)
+			require.NotContains(t, string(data), keyPair.SecretKey.First.Text(16))
+
+			decrypted, err := keystore.Decrypt(data, passphrase)
+			require.NoError(t, err)
+			require.Equal(t, keyPair, decrypted)
+
+			_, err = keystore.Decrypt(data, []byte("wrong"))
+			require.ErrorIs(t, err, keystore.ErrWrongPassphrase)
+
+			publicKey, err := keystore.PublicKey(data)
+			require.NoError(t, err)
+			require.Equal(t, keyPair.PublicKey, publicKey)
+		})
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	keyPair := loadKeyPair(t)
+	passphrase := []byte("passphrase")
+	filename := filepath.Join(t.TempDir(), "alice.json")
+
+	require.NoError(t, keystore.Save(filename, keyPair, passphrase, &keystore.LightScrypt))
+
+	info, err := os.Stat(filename)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	loaded, err := keystore.Load(filename, passphrase)
+	require.NoError(t, err)
+	require.Equal(t, keyPair, loaded)
+
+	// an existing keystore is never overwritten
+	require.Error(t, keystore.Save(filename, keyPair, passphrase, &keystore.LightScrypt))
+
+	_, err = keystore.Load(filepath.Join(t.TempDir(), "missing.json"), passphrase)
+	require.Error(t, err)
+}
+
+func TestDecryptErrors(t *testing.T) {
+	keyPair := loadKeyPair(t)
+	passphrase := []byte("passphrase")
+	data, err := keystore.Encrypt(keyPair, passphrase, &keystore.LightScrypt)
+	require.NoError(t, err)
+
+	modify := func(t *testing.T, change func(map[string]any)) []byte {
+		var fields map[string]any
+		require.NoError(t, json.Unmarshal(data, &fields))
+		change(fields)
+		modified, err := json.Marshal(fields)
+		require.NoError(t, err)
+		return modified
+	}
+
+	t.Run("not json", func(t *testing.T) {
+		_, err := keystore.Decrypt([]byte("not json"), passphrase)
+		require.ErrorIs(t, err, keystore.ErrInvalidKeystore)
+	})
+
+	t.Run("unknown version", func(t *testing.T) {
+		modified := modify(t, func(fields map[string]any) { fields["version"] = 99 })
+		_, err := keystore.Decrypt(modified, passphrase)
+		require.ErrorIs(t, err, keystore.ErrUnsupportedKeystore)
+	})
+
+	t.Run("unknown kdf", func(t *testing.T) {
+		modified := modify(t, func(fields map[string]any) {
+			fields["crypto"].(map[string]any)["kdf"] = "pbkdf2"
+		})
+		_, err := keystore.Decrypt(modified, passphrase)
+		require.ErrorIs(t, err, keystore.ErrUnsupportedKeystore)
+	})
+
+	t.Run("excessive kdf cost", func(t *testing.T) {
+		modified := modify(t, func(fields map[string]any) {
+			fields["crypto"].(map[string]any)["kdfparams"].(map[string]any)["n"] = 1 << 30
+		})
+		_, err := keystore.Decrypt(modified, passphrase)
+		require.ErrorIs(t, err, keystore.ErrInvalidKeystore)
+	})
+
+	t.Run("swapped public key", func(t *testing.T) {
+		bob, err := testutils.LoadKeyPairFromFile("../../../../testdata/bob_keypair.json")
+		require.NoError(t, err)
+		modified := modify(t, func(fields map[string]any) { fields["publicKey"] = bob.PublicKey })
+		_, err = keystore.Decrypt(modified, passphrase)
+		require.ErrorIs(t, err, keystore.ErrInvalidKeystore)
+
+		_, err = keystore.PublicKey(modified)
+		require.ErrorIs(t, err, keystore.ErrInvalidKeystore)
+	})
+
+	t.Run("unsupported options", func(t *testing.T) {
+		_, err := keystore.Encrypt(keyPair, passphrase, &keystore.Options{KDF: "pbkdf2"})
+		require.ErrorIs(t, err, keystore.ErrUnsupportedKeystore)
+	})
+}
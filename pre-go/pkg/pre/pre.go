@@ -5,13 +5,42 @@ import (
 	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre/utils"
 )
 
-// NewPreScheme creates a new instance of preScheme with generated system parameters
-func NewPreScheme() *types.PreScheme {
-	g1, g2, Z := utils.GenerateSystemParameters()
+// SchemeOption selects a variant of the scheme created by NewPreScheme
+type SchemeOption func(*schemeOptions)
+
+// schemeOptions holds the variant selected by the options of NewPreScheme
+type schemeOptions struct {
+	cca bool
+}
+
+// WithCCA selects the CCA-secure variant of the scheme, see NewCCAClient and NewCCAProxy
+func WithCCA() SchemeOption {
+	return func(o *schemeOptions) {
+		o.cca = true
+	}
+}
+
+// NewPreScheme creates a new instance of preScheme with generated system parameters.
+// Without options, the client and proxy are those of NewClient and NewProxy.
+func NewPreScheme(opts ...SchemeOption) *types.PreScheme {
+	var options schemeOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	prepared := utils.PreparedSystemParameters()
+	g1, g2, Z := *prepared.G1, *prepared.G2, *prepared.Z
 	systemParams := types.SystemParams{
-		G1: g1,
-		G2: g2,
-		Z:  Z,
+		G1: &g1,
+		G2: &g2,
+		Z:  &Z,
+	}
+	if options.cca {
+		return &types.PreScheme{
+			Client: NewCCAClient(systemParams),
+			Proxy:  NewCCAProxy(),
+			Params: systemParams,
+		}
 	}
 	return &types.PreScheme{
 		Client: NewClient(systemParams),
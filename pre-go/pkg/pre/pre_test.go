@@ -1,6 +1,10 @@
 package pre_test
 
 import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
 	"math/big"
 	"testing"
 
@@ -146,3 +150,486 @@ func TestPreSchemeAdditional(t *testing.T) {
 		})
 	})
 }
+
+func TestDecryptBytes(t *testing.T) {
+	scheme := pre.NewPreScheme()
+	keyPairAlice := testutils.GenerateRandomKeyPair(scheme.Params.G2, scheme.Params.Z)
+	keyPairBob := testutils.GenerateRandomKeyPair(scheme.Params.G2, scheme.Params.Z)
+	reKey := scheme.Client.GenerateReEncryptionKey(keyPairAlice.SecretKey, keyPairBob.PublicKey)
+
+	message := "test message"
+	encryptedKey, encryptedMessage, err := scheme.Client.SecondLevelEncryption(keyPairAlice.SecretKey, message, testutils.GenerateRandomScalar())
+	require.NoError(t, err)
+	firstLevelKey := scheme.Proxy.ReEncryption(encryptedKey, reKey)
+
+	t.Run("DecryptSecondLevelBytes", func(t *testing.T) {
+		decrypted, err := scheme.Client.DecryptSecondLevelBytes(encryptedKey, encryptedMessage, keyPairAlice.SecretKey)
+		require.NoError(t, err)
+		require.Equal(t, []byte(message), decrypted)
+	})
+
+	t.Run("DecryptFirstLevelBytes", func(t *testing.T) {
+		decrypted, err := scheme.Client.DecryptFirstLevelBytes(firstLevelKey, encryptedMessage, keyPairBob.SecretKey)
+		require.NoError(t, err)
+		require.Equal(t, []byte(message), decrypted)
+	})
+
+	t.Run("wrong secret key", func(t *testing.T) {
+		_, err := scheme.Client.DecryptSecondLevelBytes(encryptedKey, encryptedMessage, keyPairBob.SecretKey)
+		require.ErrorIs(t, err, types.ErrAuthenticationFailed)
+
+		_, err = scheme.Client.DecryptFirstLevelBytes(firstLevelKey, encryptedMessage, keyPairAlice.SecretKey)
+		require.ErrorIs(t, err, types.ErrAuthenticationFailed)
+	})
+
+	t.Run("tampered message", func(t *testing.T) {
+		tampered := append([]byte(nil), encryptedMessage...)
+		tampered[len(tampered)-1] ^= 0x01
+		_, err := scheme.Client.DecryptSecondLevelBytes(encryptedKey, tampered, keyPairAlice.SecretKey)
+		require.ErrorIs(t, err, types.ErrAuthenticationFailed)
+
+		_, err = scheme.Client.DecryptFirstLevelBytes(firstLevelKey, tampered[:5], keyPairBob.SecretKey)
+		require.ErrorIs(t, err, types.ErrAuthenticationFailed)
+	})
+
+	t.Run("invalid secret key", func(t *testing.T) {
+		_, err := scheme.Client.DecryptSecondLevelBytes(encryptedKey, encryptedMessage, nil)
+		require.ErrorIs(t, err, types.ErrInvalidKey)
+
+		zeroKey := &types.SecretKey{First: big.NewInt(0), Second: big.NewInt(0)}
+		_, err = scheme.Client.DecryptFirstLevelBytes(firstLevelKey, encryptedMessage, zeroKey)
+		require.ErrorIs(t, err, types.ErrInvalidKey)
+	})
+
+	t.Run("malformed capsule", func(t *testing.T) {
+		_, err := scheme.Client.DecryptSecondLevelBytes(nil, encryptedMessage, keyPairAlice.SecretKey)
+		require.ErrorIs(t, err, types.ErrMalformedCapsule)
+
+		_, err = scheme.Client.DecryptFirstLevelBytes(&types.FirstLevelSymmetricKey{}, encryptedMessage, keyPairBob.SecretKey)
+		require.ErrorIs(t, err, types.ErrMalformedCapsule)
+		require.False(t, errors.Is(err, types.ErrInvalidKey))
+	})
+
+	t.Run("deprecated wrappers", func(t *testing.T) {
+		require.Equal(t, message, scheme.Client.DecryptFirstLevel(firstLevelKey, encryptedMessage, keyPairBob.SecretKey))
+		require.Empty(t, scheme.Client.DecryptSecondLevel(encryptedKey, encryptedMessage, keyPairBob.SecretKey))
+		require.Panics(t, func() {
+			scheme.Client.DecryptSecondLevel(encryptedKey, encryptedMessage, nil)
+		})
+	})
+}
+
+func TestBinaryAndStreamEncryption(t *testing.T) {
+	scheme := pre.NewPreScheme()
+	keyPairAlice := testutils.GenerateRandomKeyPair(scheme.Params.G2, scheme.Params.Z)
+	keyPairBob := testutils.GenerateRandomKeyPair(scheme.Params.G2, scheme.Params.Z)
+	reKey := scheme.Client.GenerateReEncryptionKey(keyPairAlice.SecretKey, keyPairBob.PublicKey)
+
+	// not valid UTF-8, and spans several stream chunks
+	message := make([]byte, 200*1024+7)
+	_, err := rand.Read(message)
+	require.NoError(t, err)
+
+	t.Run("bytes", func(t *testing.T) {
+		encryptedKey, encryptedMessage, err := scheme.Client.SecondLevelEncryptionBytes(keyPairAlice.SecretKey, message, testutils.GenerateRandomScalar(), nil)
+		require.NoError(t, err)
+
+		decrypted, err := scheme.Client.DecryptSecondLevelBytes(encryptedKey, encryptedMessage, keyPairAlice.SecretKey)
+		require.NoError(t, err)
+		require.Equal(t, message, decrypted)
+
+		firstLevelKey := scheme.Proxy.ReEncryption(encryptedKey, reKey)
+		decrypted, err = scheme.Client.DecryptFirstLevelBytes(firstLevelKey, encryptedMessage, keyPairBob.SecretKey)
+		require.NoError(t, err)
+		require.Equal(t, message, decrypted)
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		var encrypted bytes.Buffer
+		encryptedKey, err := scheme.Client.SecondLevelEncryptionStream(keyPairAlice.SecretKey, &encrypted, bytes.NewReader(message), testutils.GenerateRandomScalar(), nil)
+		require.NoError(t, err)
+
+		var decrypted bytes.Buffer
+		err = scheme.Client.DecryptSecondLevelStream(encryptedKey, &decrypted, bytes.NewReader(encrypted.Bytes()), keyPairAlice.SecretKey)
+		require.NoError(t, err)
+		require.Equal(t, message, decrypted.Bytes())
+
+		firstLevelKey := scheme.Proxy.ReEncryption(encryptedKey, reKey)
+		decrypted.Reset()
+		err = scheme.Client.DecryptFirstLevelStream(firstLevelKey, &decrypted, bytes.NewReader(encrypted.Bytes()), keyPairBob.SecretKey)
+		require.NoError(t, err)
+		require.Equal(t, message, decrypted.Bytes())
+
+		err = scheme.Client.DecryptFirstLevelStream(firstLevelKey, &bytes.Buffer{}, bytes.NewReader(encrypted.Bytes()), keyPairAlice.SecretKey)
+		require.ErrorIs(t, err, types.ErrAuthenticationFailed)
+	})
+}
+
+func TestDecryptEnvelope(t *testing.T) {
+	scheme := pre.NewPreScheme()
+	keyPair := testutils.GenerateRandomKeyPair(scheme.Params.G2, scheme.Params.Z)
+
+	message := []byte("envelope message")
+	encryptedKey, encryptedMessage, err := scheme.Client.SecondLevelEncryptionBytes(keyPair.SecretKey, message, testutils.GenerateRandomScalar(), nil)
+	require.NoError(t, err)
+
+	data, err := types.NewEnvelope(encryptedKey, encryptedMessage).Marshal()
+	require.NoError(t, err)
+
+	envelope := new(types.Envelope)
+	require.NoError(t, envelope.Unmarshal(data))
+
+	decrypted, err := scheme.Client.DecryptEnvelope(envelope, keyPair.SecretKey)
+	require.NoError(t, err)
+	require.Equal(t, message, decrypted)
+
+	t.Run("unsupported KDF", func(t *testing.T) {
+		unsupported := *envelope
+		unsupported.KDF = 0xff
+		_, err := scheme.Client.DecryptEnvelope(&unsupported, keyPair.SecretKey)
+		require.ErrorIs(t, err, types.ErrUnsupportedEnvelope)
+	})
+
+	t.Run("key size other than the one of the scheme", func(t *testing.T) {
+		smaller := *envelope
+		smaller.KeySize = 16
+		_, err := scheme.Client.DecryptEnvelope(&smaller, keyPair.SecretKey)
+		require.ErrorIs(t, err, types.ErrUnsupportedEnvelope)
+		_, err = scheme.Client.DecryptEnvelopeAsRecipient(&smaller, keyPair.SecretKey)
+		require.ErrorIs(t, err, types.ErrUnsupportedEnvelope)
+	})
+}
+
+func TestAssociatedData(t *testing.T) {
+	scheme := pre.NewPreScheme()
+	keyPairAlice := testutils.GenerateRandomKeyPair(scheme.Params.G2, scheme.Params.Z)
+	keyPairBob := testutils.GenerateRandomKeyPair(scheme.Params.G2, scheme.Params.Z)
+	reKey := scheme.Client.GenerateReEncryptionKey(keyPairAlice.SecretKey, keyPairBob.PublicKey)
+
+	opts := &types.EncryptOptions{Context: []byte("record-1;application/pdf")}
+	keyA, messageA, err := scheme.Client.SecondLevelEncryptionBytes(keyPairAlice.SecretKey, []byte("record one"), testutils.GenerateRandomScalar(), opts)
+	require.NoError(t, err)
+	require.Equal(t, keyPairAlice.PublicKey.Fingerprint(), keyA.Owner)
+	require.Equal(t, opts.Context, keyA.Context)
+
+	keyB, messageB, err := scheme.Client.SecondLevelEncryptionBytes(keyPairAlice.SecretKey, []byte("record two"), testutils.GenerateRandomScalar(), nil)
+	require.NoError(t, err)
+
+	t.Run("context survives re-encryption", func(t *testing.T) {
+		firstLevelKey := scheme.Proxy.ReEncryption(keyA, reKey)
+		require.Equal(t, opts.Context, firstLevelKey.Context)
+		require.Equal(t, keyA.Owner, firstLevelKey.Owner)
+
+		decrypted, err := scheme.Client.DecryptFirstLevelBytes(firstLevelKey, messageA, keyPairBob.SecretKey)
+		require.NoError(t, err)
+		require.Equal(t, []byte("record one"), decrypted)
+	})
+
+	t.Run("context is authenticated", func(t *testing.T) {
+		tampered := *keyA
+		tampered.Context = []byte("record-2;application/pdf")
+		_, err := scheme.Client.DecryptSecondLevelBytes(&tampered, messageA, keyPairAlice.SecretKey)
+		require.ErrorIs(t, err, types.ErrAuthenticationFailed)
+	})
+
+	t.Run("bare encoding", func(t *testing.T) {
+		// the bare encoding drops the attributes the message is bound to, so they must be
+		// supplied again
+		for _, record := range []struct {
+			key     *types.SecondLevelSymmetricKey
+			message []byte
+		}{{keyA, messageA}, {keyB, messageB}} {
+			decoded := new(types.SecondLevelSymmetricKey)
+			require.NoError(t, decoded.UnmarshalBinary(record.key.ToBytes()))
+			_, err := scheme.Client.DecryptSecondLevelBytes(decoded, record.message, keyPairAlice.SecretKey)
+			require.ErrorIs(t, err, types.ErrAuthenticationFailed)
+			decoded.CapsuleAttributes = record.key.CapsuleAttributes
+			_, err = scheme.Client.DecryptSecondLevelBytes(decoded, record.message, keyPairAlice.SecretKey)
+			require.NoError(t, err)
+
+			firstLevelKey := new(types.FirstLevelSymmetricKey)
+			require.NoError(t, firstLevelKey.UnmarshalBinary(scheme.Proxy.ReEncryption(decoded, reKey).ToBytes()))
+			_, err = scheme.Client.DecryptFirstLevelBytes(firstLevelKey, record.message, keyPairBob.SecretKey)
+			require.ErrorIs(t, err, types.ErrAuthenticationFailed)
+			firstLevelKey.Capsule = record.key.First
+			firstLevelKey.CapsuleAttributes = record.key.CapsuleAttributes
+			_, err = scheme.Client.DecryptFirstLevelBytes(firstLevelKey, record.message, keyPairBob.SecretKey)
+			require.NoError(t, err)
+		}
+	})
+
+	t.Run("legacy keys", func(t *testing.T) {
+		// keys of pre-ts carry no attributes and their messages authenticate no additional data
+		legacy := mocks.NewMockPreScheme()
+		encryptedKey, encryptedMessage, err := legacy.SecondLevelEncryption(legacy.AliceKeyPair.SecretKey, string(legacy.Message), legacy.Scalar)
+		require.NoError(t, err)
+		require.True(t, encryptedKey.CapsuleAttributes.IsZero())
+
+		decrypted, err := scheme.Client.DecryptSecondLevelBytes(encryptedKey, encryptedMessage, legacy.AliceKeyPair.SecretKey)
+		require.NoError(t, err)
+		require.Equal(t, legacy.Message, decrypted)
+
+		firstLevelKey := scheme.Proxy.ReEncryption(encryptedKey, legacy.ReKey)
+		decrypted, err = scheme.Client.DecryptFirstLevelBytes(firstLevelKey, encryptedMessage, legacy.BobKeyPair.SecretKey)
+		require.NoError(t, err)
+		require.Equal(t, legacy.Message, decrypted)
+	})
+
+	t.Run("owner is authenticated", func(t *testing.T) {
+		tampered := *keyA
+		tampered.Owner = keyPairBob.PublicKey.Fingerprint()
+		_, err := scheme.Client.DecryptSecondLevelBytes(&tampered, messageA, keyPairAlice.SecretKey)
+		require.ErrorIs(t, err, types.ErrAuthenticationFailed)
+
+		// delegatees check it too, along with the capsule
+		firstLevelKey := scheme.Proxy.ReEncryption(keyB, reKey)
+		firstLevelKey.Owner = keyPairBob.PublicKey.Fingerprint()
+		_, err = scheme.Client.DecryptFirstLevelBytes(firstLevelKey, messageB, keyPairBob.SecretKey)
+		require.ErrorIs(t, err, types.ErrAuthenticationFailed)
+
+		firstLevelKey = scheme.Proxy.ReEncryption(keyB, reKey)
+		firstLevelKey.Capsule = keyA.First
+		_, err = scheme.Client.DecryptFirstLevelBytes(firstLevelKey, messageB, keyPairBob.SecretKey)
+		require.ErrorIs(t, err, types.ErrAuthenticationFailed)
+	})
+
+	t.Run("swapped capsule is detected", func(t *testing.T) {
+		// keep the attributes of record two so only the key material is swapped
+		swapped := *keyA
+		swapped.Context = keyB.Context
+		_, err := scheme.Client.DecryptSecondLevelBytes(&swapped, messageB, keyPairAlice.SecretKey)
+		require.ErrorIs(t, err, types.ErrAuthenticationFailed)
+
+		firstLevelKey := scheme.Proxy.ReEncryption(&swapped, reKey)
+		_, err = scheme.Client.DecryptFirstLevelBytes(firstLevelKey, messageB, keyPairBob.SecretKey)
+		require.ErrorIs(t, err, types.ErrAuthenticationFailed)
+	})
+}
+
+func TestEncryptTo(t *testing.T) {
+	scheme := pre.NewPreScheme()
+	keyPairAlice := testutils.GenerateRandomKeyPair(scheme.Params.G2, scheme.Params.Z)
+	keyPairBob := testutils.GenerateRandomKeyPair(scheme.Params.G2, scheme.Params.Z)
+	reKey := scheme.Client.GenerateReEncryptionKey(keyPairAlice.SecretKey, keyPairBob.PublicKey)
+
+	// a lab encrypts results for Alice knowing only her public key
+	message := []byte("lab results for alice")
+	opts := &types.EncryptOptions{Context: []byte("lab-report-7")}
+	encryptedKey, encryptedMessage, err := scheme.Client.EncryptTo(keyPairAlice.PublicKey, message, opts)
+	require.NoError(t, err)
+	require.Equal(t, keyPairAlice.PublicKey.Fingerprint(), encryptedKey.Owner)
+
+	decrypted, err := scheme.Client.DecryptSecondLevelBytes(encryptedKey, encryptedMessage, keyPairAlice.SecretKey)
+	require.NoError(t, err)
+	require.Equal(t, message, decrypted)
+
+	firstLevelKey := scheme.Proxy.ReEncryption(encryptedKey, reKey)
+	decrypted, err = scheme.Client.DecryptFirstLevelBytes(firstLevelKey, encryptedMessage, keyPairBob.SecretKey)
+	require.NoError(t, err)
+	require.Equal(t, message, decrypted)
+
+	t.Run("invalid public key", func(t *testing.T) {
+		_, _, err := scheme.Client.EncryptTo(nil, message, nil)
+		require.Error(t, err)
+
+		_, _, err = scheme.Client.EncryptTo(&types.PublicKey{First: new(bn254.GT).SetOne(), Second: keyPairAlice.PublicKey.Second}, message, nil)
+		require.Error(t, err)
+	})
+}
+
+func TestEncryptToPrepared(t *testing.T) {
+	scheme := pre.NewPreScheme()
+	keyPairAlice := testutils.GenerateRandomKeyPair(scheme.Params.G2, scheme.Params.Z)
+	keyPairBob := testutils.GenerateRandomKeyPair(scheme.Params.G2, scheme.Params.Z)
+	reKey := scheme.Client.GenerateReEncryptionKey(keyPairAlice.SecretKey, keyPairBob.PublicKey)
+
+	// the lab prepares Alice's public key once and encrypts every result with it
+	alice := types.PreparePublicKey(keyPairAlice.PublicKey)
+	for _, message := range [][]byte{[]byte("blood test"), []byte("x-ray")} {
+		encryptedKey, encryptedMessage, err := scheme.Client.EncryptToPrepared(alice, message, nil)
+		require.NoError(t, err)
+		require.Equal(t, keyPairAlice.PublicKey.Fingerprint(), encryptedKey.Owner)
+
+		decrypted, err := scheme.Client.DecryptSecondLevelBytes(encryptedKey, encryptedMessage, keyPairAlice.SecretKey)
+		require.NoError(t, err)
+		require.Equal(t, message, decrypted)
+
+		firstLevelKey := scheme.Proxy.ReEncryption(encryptedKey, reKey)
+		decrypted, err = scheme.Client.DecryptFirstLevelBytes(firstLevelKey, encryptedMessage, keyPairBob.SecretKey)
+		require.NoError(t, err)
+		require.Equal(t, message, decrypted)
+	}
+
+	t.Run("invalid public key", func(t *testing.T) {
+		_, _, err := scheme.Client.EncryptToPrepared(nil, []byte("message"), nil)
+		require.Error(t, err)
+
+		identity := types.PreparePublicKey(&types.PublicKey{First: new(bn254.GT).SetOne(), Second: keyPairAlice.PublicKey.Second})
+		_, _, err = scheme.Client.EncryptToPrepared(identity, []byte("message"), nil)
+		require.Error(t, err)
+	})
+}
+
+func TestCustomSystemParams(t *testing.T) {
+	// generators other than the standard ones get tables of their own
+	g1, g2, _ := utils.GenerateSystemParameters()
+	g1 = new(bn254.G1Affine).ScalarMultiplication(g1, big.NewInt(7))
+	Z, err := bn254.Pair([]bn254.G1Affine{*g1}, []bn254.G2Affine{*g2})
+	require.NoError(t, err)
+	params := types.SystemParams{G1: g1, G2: g2, Z: &Z}
+	client := pre.NewClient(params)
+
+	keyPairAlice := testutils.GenerateRandomKeyPair(g2, &Z)
+	keyPairBob := testutils.GenerateRandomKeyPair(g2, &Z)
+	require.True(t, keyPairAlice.PublicKey.First.Equal(new(bn254.GT).Exp(Z, keyPairAlice.SecretKey.First)))
+
+	message := []byte("custom parameters")
+	encryptedKey, encryptedMessage, err := client.SecondLevelEncryptionBytes(keyPairAlice.SecretKey, message, testutils.GenerateRandomScalar(), nil)
+	require.NoError(t, err)
+	require.Equal(t, keyPairAlice.PublicKey.Fingerprint(), encryptedKey.Owner)
+
+	firstLevelKey := pre.NewProxy().ReEncryption(encryptedKey, client.GenerateReEncryptionKey(keyPairAlice.SecretKey, keyPairBob.PublicKey))
+	decrypted, err := client.DecryptFirstLevelBytes(firstLevelKey, encryptedMessage, keyPairBob.SecretKey)
+	require.NoError(t, err)
+	require.Equal(t, message, decrypted)
+}
+
+func TestMultiRecipientEnvelope(t *testing.T) {
+	scheme := pre.NewPreScheme()
+	keyPairAlice := testutils.GenerateRandomKeyPair(scheme.Params.G2, scheme.Params.Z)
+	doctors := make([]*types.KeyPair, 3)
+	recipients := make([]*types.PublicKey, len(doctors))
+	for i := range doctors {
+		doctors[i] = testutils.GenerateRandomKeyPair(scheme.Params.G2, scheme.Params.Z)
+		recipients[i] = doctors[i].PublicKey
+	}
+
+	message := []byte("lab report shared with every doctor")
+	envelope, err := scheme.Client.EncryptForRecipients(keyPairAlice.SecretKey, message, recipients, &types.EncryptOptions{Context: []byte("report-9")})
+	require.NoError(t, err)
+	require.Len(t, envelope.Recipients, len(doctors))
+
+	data, err := envelope.Marshal()
+	require.NoError(t, err)
+	recovered := new(types.Envelope)
+	require.NoError(t, recovered.Unmarshal(data))
+
+	for _, doctor := range doctors {
+		decrypted, err := scheme.Client.DecryptEnvelopeAsRecipient(recovered, doctor.SecretKey)
+		require.NoError(t, err)
+		require.Equal(t, message, decrypted)
+	}
+
+	decrypted, err := scheme.Client.DecryptEnvelope(recovered, keyPairAlice.SecretKey)
+	require.NoError(t, err)
+	require.Equal(t, message, decrypted)
+
+	t.Run("proxy adds and removes recipients", func(t *testing.T) {
+		keyPairBob := testutils.GenerateRandomKeyPair(scheme.Params.G2, scheme.Params.Z)
+		bob := keyPairBob.PublicKey.Fingerprint()
+		payload := append([]byte(nil), recovered.Payload...)
+
+		_, err := scheme.Client.DecryptEnvelopeAsRecipient(recovered, keyPairBob.SecretKey)
+		require.ErrorIs(t, err, types.ErrNotRecipient)
+
+		reKey := scheme.Client.GenerateReEncryptionKey(keyPairAlice.SecretKey, keyPairBob.PublicKey)
+		require.NoError(t, scheme.Proxy.AddRecipient(recovered, bob, reKey))
+		require.Equal(t, payload, recovered.Payload)
+
+		decrypted, err := scheme.Client.DecryptEnvelopeAsRecipient(recovered, keyPairBob.SecretKey)
+		require.NoError(t, err)
+		require.Equal(t, message, decrypted)
+
+		require.True(t, scheme.Proxy.RemoveRecipient(recovered, bob))
+		require.False(t, scheme.Proxy.RemoveRecipient(recovered, bob))
+		require.Equal(t, payload, recovered.Payload)
+
+		_, err = scheme.Client.DecryptEnvelopeAsRecipient(recovered, keyPairBob.SecretKey)
+		require.ErrorIs(t, err, types.ErrNotRecipient)
+	})
+
+	t.Run("wrong re-encryption key", func(t *testing.T) {
+		keyPairBob := testutils.GenerateRandomKeyPair(scheme.Params.G2, scheme.Params.Z)
+		reKey := scheme.Client.GenerateReEncryptionKey(keyPairAlice.SecretKey, doctors[0].PublicKey)
+		require.NoError(t, scheme.Proxy.AddRecipient(recovered, keyPairBob.PublicKey.Fingerprint(), reKey))
+
+		_, err := scheme.Client.DecryptEnvelopeAsRecipient(recovered, keyPairBob.SecretKey)
+		require.ErrorIs(t, err, types.ErrAuthenticationFailed)
+	})
+
+	t.Run("invalid recipient", func(t *testing.T) {
+		_, err := scheme.Client.EncryptForRecipients(keyPairAlice.SecretKey, message, []*types.PublicKey{nil}, nil)
+		require.Error(t, err)
+
+		err = scheme.Proxy.AddRecipient(recovered, nil, testutils.GenerateRandomG2Elem())
+		require.ErrorIs(t, err, types.ErrInvalidEnvelope)
+	})
+}
+
+func TestContextMethods(t *testing.T) {
+	scheme := pre.NewPreScheme()
+	keyPairAlice := testutils.GenerateRandomKeyPair(scheme.Params.G2, scheme.Params.Z)
+	keyPairBob := testutils.GenerateRandomKeyPair(scheme.Params.G2, scheme.Params.Z)
+	message := []byte("context-aware")
+	ctx := context.Background()
+	client := scheme.Client.(types.ContextClient)
+	proxy := scheme.Proxy.(types.ContextProxy)
+
+	reKey, err := client.GenerateReEncryptionKeyContext(ctx, keyPairAlice.SecretKey, keyPairBob.PublicKey)
+	require.NoError(t, err)
+	require.True(t, reKey.Equal(scheme.Client.GenerateReEncryptionKey(keyPairAlice.SecretKey, keyPairBob.PublicKey)))
+
+	encryptedKey, encryptedMessage, err := client.SecondLevelEncryptionBytesContext(ctx, keyPairAlice.SecretKey, message, testutils.GenerateRandomScalar(), nil)
+	require.NoError(t, err)
+	firstLevelKey, err := proxy.ReEncryptionContext(ctx, encryptedKey, reKey)
+	require.NoError(t, err)
+	decrypted, err := client.DecryptFirstLevelBytesContext(ctx, firstLevelKey, encryptedMessage, keyPairBob.SecretKey)
+	require.NoError(t, err)
+	require.Equal(t, message, decrypted)
+
+	t.Run("errors instead of panics", func(t *testing.T) {
+		_, err := client.GenerateReEncryptionKeyContext(ctx, nil, keyPairBob.PublicKey)
+		require.ErrorIs(t, err, types.ErrInvalidKey)
+		_, err = proxy.ReEncryptionContext(ctx, &types.SecondLevelSymmetricKey{}, reKey)
+		require.ErrorIs(t, err, types.ErrMalformedCapsule)
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := client.GenerateReEncryptionKeyContext(ctx, keyPairAlice.SecretKey, keyPairBob.PublicKey)
+		require.ErrorIs(t, err, context.Canceled)
+		_, _, err = client.SecondLevelEncryptionBytesContext(ctx, keyPairAlice.SecretKey, message, testutils.GenerateRandomScalar(), nil)
+		require.ErrorIs(t, err, context.Canceled)
+		_, err = client.SecondLevelEncryptionStreamContext(ctx, keyPairAlice.SecretKey, &bytes.Buffer{}, bytes.NewReader(message), testutils.GenerateRandomScalar(), nil)
+		require.ErrorIs(t, err, context.Canceled)
+		_, _, err = client.EncryptToContext(ctx, keyPairAlice.PublicKey, message, nil)
+		require.ErrorIs(t, err, context.Canceled)
+		_, _, err = client.EncryptToPreparedContext(ctx, types.PreparePublicKey(keyPairAlice.PublicKey), message, nil)
+		require.ErrorIs(t, err, context.Canceled)
+		_, err = client.EncryptForRecipientsContext(ctx, keyPairAlice.SecretKey, message, []*types.PublicKey{keyPairBob.PublicKey}, nil)
+		require.ErrorIs(t, err, context.Canceled)
+
+		_, err = client.DecryptFirstLevelBytesContext(ctx, firstLevelKey, encryptedMessage, keyPairBob.SecretKey)
+		require.ErrorIs(t, err, context.Canceled)
+		_, err = client.DecryptSecondLevelBytesContext(ctx, encryptedKey, encryptedMessage, keyPairAlice.SecretKey)
+		require.ErrorIs(t, err, context.Canceled)
+		err = client.DecryptFirstLevelStreamContext(ctx, firstLevelKey, &bytes.Buffer{}, bytes.NewReader(encryptedMessage), keyPairBob.SecretKey)
+		require.ErrorIs(t, err, context.Canceled)
+		err = client.DecryptSecondLevelStreamContext(ctx, encryptedKey, &bytes.Buffer{}, bytes.NewReader(encryptedMessage), keyPairAlice.SecretKey)
+		require.ErrorIs(t, err, context.Canceled)
+
+		envelope, err := scheme.Client.EncryptForRecipients(keyPairAlice.SecretKey, message, []*types.PublicKey{keyPairBob.PublicKey}, nil)
+		require.NoError(t, err)
+		_, err = client.DecryptEnvelopeContext(ctx, envelope, keyPairAlice.SecretKey)
+		require.ErrorIs(t, err, context.Canceled)
+		_, err = client.DecryptEnvelopeAsRecipientContext(ctx, envelope, keyPairBob.SecretKey)
+		require.ErrorIs(t, err, context.Canceled)
+
+		_, err = proxy.ReEncryptionContext(ctx, encryptedKey, reKey)
+		require.ErrorIs(t, err, context.Canceled)
+		err = proxy.AddRecipientContext(ctx, envelope, keyPairBob.PublicKey.Fingerprint(), reKey)
+		require.ErrorIs(t, err, context.Canceled)
+	})
+}
@@ -0,0 +1,229 @@
+package pre
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre/keys"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre/types"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre/utils"
+)
+
+// Domain separation tags of the challenges of the proofs
+const (
+	reEncryptionProofDST = "PRE_BN254_reencryption_proof_v1"
+	capsuleProofDST      = "PRE_BN254_capsule_proof_v1"
+)
+
+// ReKeyCommitment returns e(g1, rk), the commitment to a re-encryption key that
+// VerifyReEncryption checks proofs against, g1 being the generator of G1.
+// The owner computes it when delegating and publishes it with the delegation. Unlike the
+// re-encryption key itself, which together with the secret key of the delegatee reveals
+// g2^a1, it can be handed to delegatees and auditors.
+func ReKeyCommitment(reKey *types.ReEncryptionKey) (*bn254.GT, error) {
+	if reKey == nil {
+		return nil, fmt.Errorf("missing re-encryption key")
+	}
+
+	_, _, g1, _ := bn254.Generators()
+	commitment, err := bn254.Pair([]bn254.G1Affine{g1}, []bn254.G2Affine{*reKey})
+	if err != nil {
+		return nil, err
+	}
+	return &commitment, nil
+}
+
+// VerifyReEncryption checks that the First component of a first-level key is e(g1^k, rk) for
+// the re-encryption key rk behind commitment, g1^k being the capsule carried by the proof.
+// It needs no secret key. Callers holding the second-level key should also check that the
+// capsule of the proof is its First component. An error wrapping types.ErrInvalidProof is
+// returned if the proof does not verify.
+func VerifyReEncryption(commitment *bn254.GT, firstLevelKey *types.FirstLevelSymmetricKey, proof *types.ReEncryptionProof) error {
+	if commitment == nil || firstLevelKey == nil || firstLevelKey.First == nil || firstLevelKey.Second == nil {
+		return fmt.Errorf("%w: incomplete statement", types.ErrInvalidProof)
+	}
+	if proof == nil || proof.Capsule == nil || proof.Response == nil || proof.Challenge == nil ||
+		proof.Challenge.Sign() < 0 || proof.Challenge.Cmp(fr.Modulus()) >= 0 {
+		return fmt.Errorf("%w: incomplete proof", types.ErrInvalidProof)
+	}
+	if !proof.Capsule.IsInSubGroup() || !proof.Response.IsInSubGroup() {
+		return fmt.Errorf("%w: point not in subgroup", types.ErrInvalidProof)
+	}
+
+	// T1 = e(g1, S) / C^c and T2 = e(U, S) / First^c
+	_, _, g1, _ := bn254.Generators()
+	t1, err := bn254.Pair([]bn254.G1Affine{g1}, []bn254.G2Affine{*proof.Response})
+	if err != nil {
+		return fmt.Errorf("%w: %v", types.ErrInvalidProof, err)
+	}
+	t2, err := bn254.Pair([]bn254.G1Affine{*proof.Capsule}, []bn254.G2Affine{*proof.Response})
+	if err != nil {
+		return fmt.Errorf("%w: %v", types.ErrInvalidProof, err)
+	}
+	var blind bn254.GT
+	t1.Mul(&t1, blind.Inverse(blind.Exp(*commitment, proof.Challenge)))
+	t2.Mul(&t2, blind.Inverse(blind.Exp(*firstLevelKey.First, proof.Challenge)))
+
+	challenge, err := reEncryptionChallenge(commitment, proof.Capsule, firstLevelKey, &t1, &t2)
+	if err != nil {
+		return fmt.Errorf("%w: %v", types.ErrInvalidProof, err)
+	}
+	if challenge.Cmp(proof.Challenge) != 0 {
+		return types.ErrInvalidProof
+	}
+	return nil
+}
+
+// proveReEncryption proves that firstLevelKey was re-encrypted from encryptedKey with reKey.
+// With R = g2^r for a random r, it commits to T1 = e(g1, R) = Z^r and T2 = e(g1^k, R) and
+// responds S = R + c·rk to the challenge c derived from the statement and T1, T2.
+func proveReEncryption(encryptedKey *types.SecondLevelSymmetricKey, reKey *types.ReEncryptionKey, firstLevelKey *types.FirstLevelSymmetricKey) (*types.ReEncryptionProof, error) {
+	commitment, err := ReKeyCommitment(reKey)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := keys.RandomScalar(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	params := utils.PreparedSystemParameters()
+	blind := params.G2Exp(r)
+
+	t1 := params.ZExp(r)
+	t2, err := bn254.Pair([]bn254.G1Affine{*encryptedKey.First}, []bn254.G2Affine{*blind})
+	if err != nil {
+		return nil, err
+	}
+
+	challenge, err := reEncryptionChallenge(commitment, encryptedKey.First, firstLevelKey, t1, &t2)
+	if err != nil {
+		return nil, err
+	}
+
+	response := new(bn254.G2Affine).ScalarMultiplication(reKey, challenge)
+	response.Add(response, blind)
+
+	return &types.ReEncryptionProof{
+		Capsule:   new(bn254.G1Affine).Set(encryptedKey.First),
+		Challenge: challenge,
+		Response:  response,
+	}, nil
+}
+
+// reEncryptionChallenge hashes the statement and the commitments of the prover to a scalar
+func reEncryptionChallenge(commitment *bn254.GT, capsule *bn254.G1Affine, firstLevelKey *types.FirstLevelSymmetricKey, t1, t2 *bn254.GT) (*big.Int, error) {
+	commitmentBytes := commitment.Bytes()
+	capsuleBytes := capsule.Bytes()
+	firstBytes := firstLevelKey.First.Bytes()
+	secondBytes := firstLevelKey.Second.Bytes()
+	t1Bytes := t1.Bytes()
+	t2Bytes := t2.Bytes()
+
+	msg := make([]byte, 0, 5*bn254.SizeOfGT+bn254.SizeOfG1AffineCompressed)
+	for _, b := range [][]byte{commitmentBytes[:], capsuleBytes[:], firstBytes[:], secondBytes[:], t1Bytes[:], t2Bytes[:]} {
+		msg = append(msg, b...)
+	}
+
+	challenge, err := fr.Hash(msg, []byte(reEncryptionProofDST), 1)
+	if err != nil {
+		return nil, err
+	}
+	return challenge[0].BigInt(new(big.Int)), nil
+}
+
+// CheckCapsule checks that a second-level key is well formed without any secret key, so
+// that a proxy can run it before re-encrypting the key: First must be a point of the
+// subgroup of G1 other than the identity and Second must be invertible. If the key
+// carries a proof, see types.EncryptOptions.Prove, the proof must verify, which also
+// shows that First, Second, Owner and Context were not changed since encryption.
+// Proofs are checked against the generator of utils.GenerateSystemParameters, like the keys of
+// the proxy. Errors wrap types.ErrMalformedCapsule.
+func CheckCapsule(encryptedKey *types.SecondLevelSymmetricKey) error {
+	if encryptedKey == nil || encryptedKey.First == nil || encryptedKey.Second == nil {
+		return fmt.Errorf("%w: missing group element", types.ErrMalformedCapsule)
+	}
+	if !encryptedKey.First.IsOnCurve() || !encryptedKey.First.IsInSubGroup() {
+		return fmt.Errorf("%w: G1 point is not in the subgroup", types.ErrMalformedCapsule)
+	}
+	if encryptedKey.First.IsInfinity() {
+		return fmt.Errorf("%w: G1 point at infinity", types.ErrMalformedCapsule)
+	}
+	if encryptedKey.Second.IsZero() {
+		return fmt.Errorf("%w: GT element is zero", types.ErrMalformedCapsule)
+	}
+
+	proof := encryptedKey.Proof
+	if proof == nil {
+		return nil
+	}
+	modulus := fr.Modulus()
+	if proof.Challenge == nil || proof.Response == nil ||
+		proof.Challenge.Sign() < 0 || proof.Challenge.Cmp(modulus) >= 0 ||
+		proof.Response.Sign() < 0 || proof.Response.Cmp(modulus) >= 0 {
+		return fmt.Errorf("%w: incomplete capsule proof", types.ErrMalformedCapsule)
+	}
+
+	// T = g1^s / U^c
+	commitment := utils.PreparedSystemParameters().G1Exp(proof.Response)
+	var blind bn254.G1Affine
+	blind.ScalarMultiplication(encryptedKey.First, proof.Challenge)
+	commitment.Sub(commitment, &blind)
+
+	challenge, err := capsuleChallenge(encryptedKey, commitment)
+	if err != nil {
+		return fmt.Errorf("%w: %v", types.ErrMalformedCapsule, err)
+	}
+	if challenge.Cmp(proof.Challenge) != 0 {
+		return fmt.Errorf("%w: capsule proof does not verify", types.ErrMalformedCapsule)
+	}
+	return nil
+}
+
+// proveCapsule proves knowledge of the scalar k of encryptedKey, whose First component is
+// g1^k. It commits to T = g1^w for a random w and responds s = w + c·k to the challenge c
+// derived from the key and T.
+func proveCapsule(params *types.PreparedParams, encryptedKey *types.SecondLevelSymmetricKey, scalar *big.Int) (*types.CapsuleProof, error) {
+	w, err := keys.RandomScalar(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	challenge, err := capsuleChallenge(encryptedKey, params.G1Exp(w))
+	if err != nil {
+		return nil, err
+	}
+
+	response := new(big.Int).Mul(challenge, scalar)
+	response.Add(response, w)
+	response.Mod(response, fr.Modulus())
+
+	return &types.CapsuleProof{Challenge: challenge, Response: response}, nil
+}
+
+// capsuleChallenge hashes the second-level key, its owner and context included, and the
+// commitment of the prover to a scalar
+func capsuleChallenge(encryptedKey *types.SecondLevelSymmetricKey, commitment *bn254.G1Affine) (*big.Int, error) {
+	firstBytes := encryptedKey.First.Bytes()
+	secondBytes := encryptedKey.Second.Bytes()
+	commitmentBytes := commitment.Bytes()
+
+	msg := make([]byte, 0, 2*bn254.SizeOfG1AffineCompressed+bn254.SizeOfGT+8+len(encryptedKey.Owner)+len(encryptedKey.Context))
+	msg = append(msg, firstBytes[:]...)
+	msg = append(msg, secondBytes[:]...)
+	msg = binary.BigEndian.AppendUint32(msg, uint32(len(encryptedKey.Owner))) // #nosec G115 -- fingerprint size
+	msg = append(msg, encryptedKey.Owner...)
+	msg = binary.BigEndian.AppendUint32(msg, uint32(len(encryptedKey.Context))) // #nosec G115 -- bounded by memory
+	msg = append(msg, encryptedKey.Context...)
+	msg = append(msg, commitmentBytes[:]...)
+
+	challenge, err := fr.Hash(msg, []byte(capsuleProofDST), 1)
+	if err != nil {
+		return nil, err
+	}
+	return challenge[0].BigInt(new(big.Int)), nil
+}
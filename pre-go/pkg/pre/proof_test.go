@@ -0,0 +1,260 @@
+package pre_test
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre/types"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/testutils"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyReEncryption(t *testing.T) {
+	scheme := pre.NewPreScheme()
+	keyPairAlice := testutils.GenerateRandomKeyPair(scheme.Params.G2, scheme.Params.Z)
+	keyPairBob := testutils.GenerateRandomKeyPair(scheme.Params.G2, scheme.Params.Z)
+	reKey := scheme.Client.GenerateReEncryptionKey(keyPairAlice.SecretKey, keyPairBob.PublicKey)
+
+	// alice publishes the commitment to the re-encryption key along with the delegation
+	commitment, err := pre.ReKeyCommitment(reKey)
+	require.NoError(t, err)
+
+	message := []byte("verifiable")
+	encryptedKey, encryptedMessage, err := scheme.Client.EncryptTo(keyPairAlice.PublicKey, message, nil)
+	require.NoError(t, err)
+
+	firstLevelKey, proof, err := scheme.Proxy.ReEncryptionWithProof(encryptedKey, reKey)
+	require.NoError(t, err)
+	require.NoError(t, pre.VerifyReEncryption(commitment, firstLevelKey, proof))
+	require.True(t, proof.Capsule.Equal(encryptedKey.First))
+
+	decrypted, err := scheme.Client.DecryptFirstLevelBytes(firstLevelKey, encryptedMessage, keyPairBob.SecretKey)
+	require.NoError(t, err)
+	require.Equal(t, message, decrypted)
+
+	t.Run("serialization", func(t *testing.T) {
+		data, err := proof.MarshalBinary()
+		require.NoError(t, err)
+		require.Len(t, data, types.ReEncryptionProofSize)
+
+		decoded := new(types.ReEncryptionProof)
+		require.NoError(t, decoded.UnmarshalBinary(data))
+		require.NoError(t, pre.VerifyReEncryption(commitment, firstLevelKey, decoded))
+
+		require.ErrorIs(t, decoded.UnmarshalBinary(data[1:]), types.ErrInvalidProof)
+		invalid := append([]byte(nil), data...)
+		for i := bn254.SizeOfG1AffineCompressed; i < bn254.SizeOfG1AffineCompressed+32; i++ {
+			invalid[i] = 0xff
+		}
+		require.ErrorIs(t, decoded.UnmarshalBinary(invalid), types.ErrInvalidProof)
+	})
+
+	t.Run("garbage first-level key", func(t *testing.T) {
+		garbage := *firstLevelKey
+		garbage.First = testutils.GenerateRandomGTElem()
+		require.ErrorIs(t, pre.VerifyReEncryption(commitment, &garbage, proof), types.ErrInvalidProof)
+	})
+
+	t.Run("other re-encryption key", func(t *testing.T) {
+		keyPairCarol := testutils.GenerateRandomKeyPair(scheme.Params.G2, scheme.Params.Z)
+		otherReKey := scheme.Client.GenerateReEncryptionKey(keyPairAlice.SecretKey, keyPairCarol.PublicKey)
+		otherKey, otherProof, err := scheme.Proxy.ReEncryptionWithProof(encryptedKey, otherReKey)
+		require.NoError(t, err)
+
+		// a valid proof for carol's key does not verify against bob's commitment
+		require.ErrorIs(t, pre.VerifyReEncryption(commitment, otherKey, otherProof), types.ErrInvalidProof)
+	})
+
+	t.Run("tampered proof", func(t *testing.T) {
+		tampered := *proof
+		tampered.Challenge = new(big.Int).Add(proof.Challenge, big.NewInt(1))
+		require.ErrorIs(t, pre.VerifyReEncryption(commitment, firstLevelKey, &tampered), types.ErrInvalidProof)
+
+		tampered = *proof
+		tampered.Capsule = testutils.GenerateRandomG1Elem()
+		require.ErrorIs(t, pre.VerifyReEncryption(commitment, firstLevelKey, &tampered), types.ErrInvalidProof)
+
+		require.ErrorIs(t, pre.VerifyReEncryption(commitment, firstLevelKey, nil), types.ErrInvalidProof)
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, _, err := scheme.Proxy.(types.ContextProxy).ReEncryptionWithProofContext(ctx, encryptedKey, reKey)
+		require.ErrorIs(t, err, context.Canceled)
+	})
+}
+
+func BenchmarkReEncryptionWithProof(b *testing.B) {
+	scheme := pre.NewPreScheme()
+	cipherText := testutils.GenerateMockSecondLevelCipherText(500)
+	reKey := testutils.GenerateRandomG2Elem()
+	commitment, err := pre.ReKeyCommitment(reKey)
+	if err != nil {
+		b.Fatal(err)
+	}
+	firstLevelKey, proof, err := scheme.Proxy.ReEncryptionWithProof(cipherText, reKey)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.Run("prove", func(b *testing.B) {
+		for n := 0; n < b.N; n++ {
+			if _, _, err := scheme.Proxy.ReEncryptionWithProof(cipherText, reKey); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("verify", func(b *testing.B) {
+		for n := 0; n < b.N; n++ {
+			if err := pre.VerifyReEncryption(commitment, firstLevelKey, proof); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestCheckCapsule(t *testing.T) {
+	scheme := pre.NewPreScheme()
+	keyPairAlice := testutils.GenerateRandomKeyPair(scheme.Params.G2, scheme.Params.Z)
+	keyPairBob := testutils.GenerateRandomKeyPair(scheme.Params.G2, scheme.Params.Z)
+
+	message := []byte("well formed")
+	opts := &types.EncryptOptions{Context: []byte("record-1"), Prove: true}
+	encryptedKey, encryptedMessage, err := scheme.Client.SecondLevelEncryptionBytes(keyPairAlice.SecretKey, message, testutils.GenerateRandomScalar(), opts)
+	require.NoError(t, err)
+	require.NotNil(t, encryptedKey.Proof)
+	require.NoError(t, pre.CheckCapsule(encryptedKey))
+
+	// the proof does not change decryption nor re-encryption
+	decrypted, err := scheme.Client.DecryptSecondLevelBytes(encryptedKey, encryptedMessage, keyPairAlice.SecretKey)
+	require.NoError(t, err)
+	require.Equal(t, message, decrypted)
+	reKey := scheme.Client.GenerateReEncryptionKey(keyPairAlice.SecretKey, keyPairBob.PublicKey)
+	decrypted, err = scheme.Client.DecryptFirstLevelBytes(scheme.Proxy.ReEncryption(encryptedKey, reKey), encryptedMessage, keyPairBob.SecretKey)
+	require.NoError(t, err)
+	require.Equal(t, message, decrypted)
+
+	t.Run("without proof", func(t *testing.T) {
+		unproven, _, err := scheme.Client.EncryptTo(keyPairAlice.PublicKey, message, nil)
+		require.NoError(t, err)
+		require.Nil(t, unproven.Proof)
+		require.NoError(t, pre.CheckCapsule(unproven))
+	})
+
+	t.Run("every encryption method", func(t *testing.T) {
+		proven, _, err := scheme.Client.EncryptTo(keyPairAlice.PublicKey, message, opts)
+		require.NoError(t, err)
+		require.NoError(t, pre.CheckCapsule(proven))
+
+		proven, _, err = scheme.Client.EncryptToPrepared(types.PreparePublicKey(keyPairAlice.PublicKey), message, opts)
+		require.NoError(t, err)
+		require.NoError(t, pre.CheckCapsule(proven))
+
+		envelope, err := scheme.Client.EncryptForRecipients(keyPairAlice.SecretKey, message, []*types.PublicKey{keyPairBob.PublicKey}, opts)
+		require.NoError(t, err)
+		require.NoError(t, pre.CheckCapsule(envelope.Capsule))
+	})
+
+	t.Run("envelope", func(t *testing.T) {
+		data, err := types.NewEnvelope(encryptedKey, encryptedMessage).Marshal()
+		require.NoError(t, err)
+		envelope := new(types.Envelope)
+		require.NoError(t, envelope.Unmarshal(data))
+		require.Equal(t, encryptedKey.Proof, envelope.Capsule.Proof)
+		require.NoError(t, pre.CheckCapsule(envelope.Capsule))
+	})
+
+	t.Run("malformed", func(t *testing.T) {
+		var infinity bn254.G1Affine
+		var offCurve bn254.G1Affine
+		offCurve.X.SetOne()
+		offCurve.Y.SetOne()
+
+		for name, capsule := range map[string]*types.SecondLevelSymmetricKey{
+			"nil":            nil,
+			"missing first":  {Second: encryptedKey.Second},
+			"missing second": {First: encryptedKey.First},
+			"infinity":       {First: &infinity, Second: encryptedKey.Second},
+			"off curve":      {First: &offCurve, Second: encryptedKey.Second},
+			"zero second":    {First: encryptedKey.First, Second: new(bn254.GT)},
+		} {
+			require.ErrorIs(t, pre.CheckCapsule(capsule), types.ErrMalformedCapsule, name)
+		}
+	})
+
+	t.Run("malleated", func(t *testing.T) {
+		// the masked key can be multiplied by any factor without the proof noticing the
+		// change, and the context changed to another record
+		second := *encryptedKey
+		second.Second = new(bn254.GT).Mul(encryptedKey.Second, testutils.GenerateRandomGTElem())
+
+		first := *encryptedKey
+		first.First = new(bn254.G1Affine).Add(encryptedKey.First, scheme.Params.G1)
+
+		context := *encryptedKey
+		context.Context = []byte("record-2")
+
+		owner := *encryptedKey
+		owner.Owner = keyPairBob.PublicKey.Fingerprint()
+
+		challenge := *encryptedKey
+		challenge.Proof = &types.CapsuleProof{
+			Challenge: new(big.Int).Add(encryptedKey.Proof.Challenge, big.NewInt(1)),
+			Response:  encryptedKey.Proof.Response,
+		}
+
+		outOfRange := *encryptedKey
+		outOfRange.Proof = &types.CapsuleProof{
+			Challenge: encryptedKey.Proof.Challenge,
+			Response:  new(big.Int).Add(encryptedKey.Proof.Response, fr.Modulus()),
+		}
+
+		for name, capsule := range map[string]*types.SecondLevelSymmetricKey{
+			"second":       &second,
+			"first":        &first,
+			"context":      &context,
+			"owner":        &owner,
+			"challenge":    &challenge,
+			"out of range": &outOfRange,
+		} {
+			require.ErrorIs(t, pre.CheckCapsule(capsule), types.ErrMalformedCapsule, name)
+		}
+	})
+
+	t.Run("serialization", func(t *testing.T) {
+		data, err := encryptedKey.Proof.MarshalBinary()
+		require.NoError(t, err)
+		require.Len(t, data, types.CapsuleProofSize)
+
+		recovered := new(types.CapsuleProof)
+		require.NoError(t, recovered.UnmarshalBinary(data))
+		require.Equal(t, encryptedKey.Proof, recovered)
+
+		require.ErrorIs(t, recovered.UnmarshalBinary(data[1:]), types.ErrMalformedCapsule)
+		for i := range 32 {
+			data[i] = 0xff
+		}
+		require.ErrorIs(t, recovered.UnmarshalBinary(data), types.ErrMalformedCapsule)
+	})
+}
+
+func BenchmarkCheckCapsule(b *testing.B) {
+	scheme := pre.NewPreScheme()
+	keyPair := testutils.GenerateRandomKeyPair(scheme.Params.G2, scheme.Params.Z)
+	encryptedKey, _, err := scheme.Client.EncryptTo(keyPair.PublicKey, []byte("benchmark"), &types.EncryptOptions{Prove: true})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		if err := pre.CheckCapsule(encryptedKey); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -1,32 +1,231 @@
 package pre
 
 import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+
 	"github.com/consensys/gnark-crypto/ecc/bn254"
 	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre/types"
 )
 
-type preProxy struct{}
+type preProxy struct {
+	workers int
+	fo      bool // only re-encrypt keys of the CCA-secure client, see NewCCAProxy
+}
 
-// NewProxy creates a new proxy
+var (
+	_ types.PreProxy      = (*preProxy)(nil)
+	_ types.ContextProxy  = (*preProxy)(nil)
+	_ types.FragmentProxy = (*preProxy)(nil)
+)
+
+// NewProxy creates a new proxy whose batch re-encryption uses one worker per CPU
 func NewProxy() types.PreProxy {
 	return &preProxy{}
 }
 
+// NewProxyWithWorkers creates a new proxy whose batch re-encryption runs on the given
+// number of workers, or one per CPU if workers is not positive
+func NewProxyWithWorkers(workers int) types.PreProxy {
+	return &preProxy{workers: workers}
+}
+
 // ReEncryption performs the re-encryption operation for the PRE scheme.
 // It re-encrypts the ciphertext under the re-encryption key.
 // It takes the second-level ciphertext and the re-encryption key as input.
 // It returns the re-encrypted(first-level) ciphertext.
 func (p *preProxy) ReEncryption(encryptedKey *types.SecondLevelSymmetricKey, reKey *bn254.G2Affine) *types.FirstLevelSymmetricKey {
-	// compute the re-encryption of the key
-	first, err := bn254.Pair([]bn254.G1Affine{*encryptedKey.First}, []bn254.G2Affine{*reKey})
+	newEncryptedKey, err := p.ReEncryptionContext(context.Background(), encryptedKey, reKey)
 	if err != nil {
 		panic("error in re-encryption")
 	}
 
-	newEncryptedKey := &types.FirstLevelSymmetricKey{
-		First:  &first,
-		Second: encryptedKey.Second,
+	return newEncryptedKey
+}
+
+// ReEncryptionContext is ReEncryption returning an error instead of panicking, or the error
+// of ctx if it is already done
+func (p *preProxy) ReEncryptionContext(ctx context.Context, encryptedKey *types.SecondLevelSymmetricKey, reKey *types.ReEncryptionKey) (*types.FirstLevelSymmetricKey, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := p.checkCapsule(encryptedKey); err != nil {
+		return nil, err
+	}
+	if reKey == nil {
+		return nil, fmt.Errorf("missing re-encryption key")
 	}
 
-	return newEncryptedKey
+	return reEncrypt(encryptedKey, reKey)
+}
+
+// ReEncryptionWithProof is ReEncryption along with a proof, checked by VerifyReEncryption
+// against ReKeyCommitment(reKey), that the result was computed with reKey
+func (p *preProxy) ReEncryptionWithProof(encryptedKey *types.SecondLevelSymmetricKey, reKey *types.ReEncryptionKey) (*types.FirstLevelSymmetricKey, *types.ReEncryptionProof, error) {
+	return p.ReEncryptionWithProofContext(context.Background(), encryptedKey, reKey)
+}
+
+// ReEncryptionWithProofContext is ReEncryptionWithProof returning the error of ctx if it is
+// done before the re-encryption or before the proof
+func (p *preProxy) ReEncryptionWithProofContext(ctx context.Context, encryptedKey *types.SecondLevelSymmetricKey, reKey *types.ReEncryptionKey) (*types.FirstLevelSymmetricKey, *types.ReEncryptionProof, error) {
+	firstLevelKey, err := p.ReEncryptionContext(ctx, encryptedKey, reKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	proof, err := proveReEncryption(encryptedKey, reKey, firstLevelKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error in re-encryption proof: %w", err)
+	}
+	return firstLevelKey, proof, nil
+}
+
+// ReEncryptBatch re-encrypts many ciphertexts under the same re-encryption key.
+// The lines of the Miller loop only depend on the re-encryption key, so they are computed
+// once for the whole batch, and the pairings are spread over the workers of the proxy.
+// It returns the first-level keys in the order of encryptedKeys, or the error of ctx if it
+// is done before all of them are re-encrypted.
+func (p *preProxy) ReEncryptBatch(ctx context.Context, encryptedKeys []*types.SecondLevelSymmetricKey, reKey *types.ReEncryptionKey) ([]*types.FirstLevelSymmetricKey, error) {
+	if reKey == nil {
+		return nil, fmt.Errorf("missing re-encryption key")
+	}
+	for i, encryptedKey := range encryptedKeys {
+		if err := p.checkCapsule(encryptedKey); err != nil {
+			return nil, fmt.Errorf("ciphertext %d: %w", i, err)
+		}
+	}
+
+	precomputed := bn254.PrecomputeLines(*reKey)
+	results := make([]*types.FirstLevelSymmetricKey, len(encryptedKeys))
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	indices := make(chan int)
+	var wg sync.WaitGroup
+	for range min(p.numWorkers(), len(encryptedKeys)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				// the Miller loop evaluates the lines in place, so every pairing gets a copy
+				lines := [][2][len(bn254.LoopCounter)]bn254.LineEvaluationAff{precomputed}
+				first, err := bn254.PairFixedQ([]bn254.G1Affine{*encryptedKeys[i].First}, lines)
+				if err != nil {
+					cancel(fmt.Errorf("error in re-encryption: %w", err))
+					continue
+				}
+				results[i] = &types.FirstLevelSymmetricKey{
+					First:   &first,
+					Second:  encryptedKeys[i].Second,
+					Capsule: encryptedKeys[i].First,
+
+					CapsuleAttributes: encryptedKeys[i].CapsuleAttributes,
+				}
+			}
+		}()
+	}
+
+feed:
+	for i := range encryptedKeys {
+		select {
+		case <-ctx.Done():
+			break feed
+		case indices <- i:
+		}
+	}
+	close(indices)
+	wg.Wait()
+
+	for _, result := range results {
+		if result == nil {
+			return nil, context.Cause(ctx)
+		}
+	}
+	return results, nil
+}
+
+// numWorkers returns the number of workers of a batch re-encryption
+func (p *preProxy) numWorkers() int {
+	if p.workers > 0 {
+		return p.workers
+	}
+	return runtime.GOMAXPROCS(0)
+}
+
+// AddRecipient re-encrypts the capsule of a multi-recipient envelope with the re-encryption
+// key of the delegatee with the given fingerprint and adds the result to the envelope,
+// replacing the previous capsule of that delegatee. The payload is left untouched.
+func (p *preProxy) AddRecipient(envelope *types.Envelope, recipient []byte, reKey *types.ReEncryptionKey) error {
+	return p.AddRecipientContext(context.Background(), envelope, recipient, reKey)
+}
+
+// AddRecipientContext is AddRecipient returning the error of ctx if it is already done
+func (p *preProxy) AddRecipientContext(ctx context.Context, envelope *types.Envelope, recipient []byte, reKey *types.ReEncryptionKey) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if envelope == nil {
+		return types.ErrMalformedCapsule
+	}
+	if err := p.checkCapsule(envelope.Capsule); err != nil {
+		return err
+	}
+	if reKey == nil {
+		return fmt.Errorf("missing re-encryption key")
+	}
+
+	newEncryptedKey, err := reEncrypt(envelope.Capsule, reKey)
+	if err != nil {
+		return err
+	}
+
+	return envelope.SetRecipient(recipient, newEncryptedKey)
+}
+
+// RemoveRecipient drops the capsule of the delegatee with the given fingerprint from a
+// multi-recipient envelope and reports whether there was one
+func (p *preProxy) RemoveRecipient(envelope *types.Envelope, recipient []byte) bool {
+	return envelope.RemoveRecipient(recipient)
+}
+
+// checkCapsule rejects the second-level keys the proxy does not re-encrypt: incomplete ones
+// and, for the CCA-secure proxy, those failing CheckCapsule or carrying no proof
+func (p *preProxy) checkCapsule(encryptedKey *types.SecondLevelSymmetricKey) error {
+	if encryptedKey == nil || encryptedKey.First == nil || encryptedKey.Second == nil {
+		return types.ErrMalformedCapsule
+	}
+	if !p.fo {
+		return nil
+	}
+
+	if err := CheckCapsule(encryptedKey); err != nil {
+		return err
+	}
+	if encryptedKey.Proof == nil {
+		return fmt.Errorf("%w: missing capsule proof", types.ErrMalformedCapsule)
+	}
+	return nil
+}
+
+// reEncrypt computes e(g1^k, reKey) and carries the other components of the key over
+func reEncrypt(encryptedKey *types.SecondLevelSymmetricKey, reKey *bn254.G2Affine) (*types.FirstLevelSymmetricKey, error) {
+	// compute the re-encryption of the key
+	first, err := bn254.Pair([]bn254.G1Affine{*encryptedKey.First}, []bn254.G2Affine{*reKey})
+	if err != nil {
+		return nil, fmt.Errorf("error in re-encryption: %w", err)
+	}
+
+	return &types.FirstLevelSymmetricKey{
+		First:   &first,
+		Second:  encryptedKey.Second,
+		Capsule: encryptedKey.First,
+
+		CapsuleAttributes: encryptedKey.CapsuleAttributes,
+	}, nil
 }
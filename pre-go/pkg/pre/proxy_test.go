@@ -1,12 +1,20 @@
 package pre_test
 
 import (
+	"context"
+	"fmt"
+	"runtime"
 	"testing"
 
 	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre/types"
 	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/testutils"
+	"github.com/stretchr/testify/require"
 )
 
+// batchSize is the number of ciphertexts of the batch benchmarks
+const batchSize = 256
+
 func BenchmarkReEncryption(b *testing.B) {
 	scheme := pre.NewPreScheme()
 	cipherText := testutils.GenerateMockSecondLevelCipherText(500)
@@ -15,3 +23,94 @@ func BenchmarkReEncryption(b *testing.B) {
 		scheme.Proxy.ReEncryption(cipherText, reKey)
 	}
 }
+
+func BenchmarkReEncryptionLoop(b *testing.B) {
+	scheme := pre.NewPreScheme()
+	cipherTexts := mockCipherTexts(batchSize)
+	reKey := testutils.GenerateRandomG2Elem()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for _, cipherText := range cipherTexts {
+			scheme.Proxy.ReEncryption(cipherText, reKey)
+		}
+	}
+}
+
+func BenchmarkReEncryptBatch(b *testing.B) {
+	cipherTexts := mockCipherTexts(batchSize)
+	reKey := testutils.GenerateRandomG2Elem()
+	workerCounts := []int{1}
+	if n := runtime.GOMAXPROCS(0); n > 1 {
+		workerCounts = append(workerCounts, n)
+	}
+	for _, workers := range workerCounts {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			proxy := pre.NewProxyWithWorkers(workers)
+			for n := 0; n < b.N; n++ {
+				if _, err := proxy.ReEncryptBatch(context.Background(), cipherTexts, reKey); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestReEncryptBatch(t *testing.T) {
+	scheme := pre.NewPreScheme()
+	alice := testutils.GenerateRandomKeyPair(scheme.Params.G2, scheme.Params.Z)
+	bob := testutils.GenerateRandomKeyPair(scheme.Params.G2, scheme.Params.Z)
+	reKey := scheme.Client.GenerateReEncryptionKey(alice.SecretKey, bob.PublicKey)
+
+	messages := make([][]byte, 10)
+	encryptedKeys := make([]*types.SecondLevelSymmetricKey, len(messages))
+	encryptedMessages := make([][]byte, len(messages))
+	for i := range messages {
+		messages[i] = []byte(fmt.Sprintf("record %d", i))
+		var err error
+		encryptedKeys[i], encryptedMessages[i], err = scheme.Client.EncryptTo(alice.PublicKey, messages[i], &types.EncryptOptions{Context: []byte{byte(i)}})
+		require.NoError(t, err)
+	}
+
+	for _, workers := range []int{0, 1, 3, 32} {
+		t.Run(fmt.Sprintf("workers=%d", workers), func(t *testing.T) {
+			firstLevelKeys, err := pre.NewProxyWithWorkers(workers).ReEncryptBatch(context.Background(), encryptedKeys, reKey)
+			require.NoError(t, err)
+			require.Len(t, firstLevelKeys, len(messages))
+
+			for i, firstLevelKey := range firstLevelKeys {
+				expected := scheme.Proxy.ReEncryption(encryptedKeys[i], reKey)
+				require.True(t, expected.First.Equal(firstLevelKey.First))
+
+				decrypted, err := scheme.Client.DecryptFirstLevelBytes(firstLevelKey, encryptedMessages[i], bob.SecretKey)
+				require.NoError(t, err)
+				require.Equal(t, messages[i], decrypted)
+			}
+		})
+	}
+
+	t.Run("empty", func(t *testing.T) {
+		firstLevelKeys, err := scheme.Proxy.ReEncryptBatch(context.Background(), nil, reKey)
+		require.NoError(t, err)
+		require.Empty(t, firstLevelKeys)
+	})
+
+	t.Run("malformed", func(t *testing.T) {
+		_, err := scheme.Proxy.ReEncryptBatch(context.Background(), []*types.SecondLevelSymmetricKey{encryptedKeys[0], {}}, reKey)
+		require.ErrorIs(t, err, types.ErrMalformedCapsule)
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := scheme.Proxy.ReEncryptBatch(ctx, mockCipherTexts(batchSize), reKey)
+		require.ErrorIs(t, err, context.Canceled)
+	})
+}
+
+func mockCipherTexts(n int) []*types.SecondLevelSymmetricKey {
+	cipherTexts := make([]*types.SecondLevelSymmetricKey, n)
+	for i := range cipherTexts {
+		cipherTexts[i] = testutils.GenerateMockSecondLevelCipherText(500)
+	}
+	return cipherTexts
+}
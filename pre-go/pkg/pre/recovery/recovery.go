@@ -0,0 +1,358 @@
+// Package recovery lets the owner of a key pair recover its secret key with the help of
+// guardians, when the device holding it is lost.
+//
+// NewKit splits both scalars of the secret key with Shamir's scheme over the scalar field
+// and encrypts the share of every guardian to the public key of the guardian, as an
+// envelope. The kit is kept by the proxy. To recover, the owner generates a new key pair and
+// asks the guardians for approval: every approving guardian hands the proxy the
+// re-encryption key from their key pair to the new one, and the proxy adds the new key pair
+// as a recipient of the envelope of that guardian. Once threshold guardians have approved,
+// Recover decrypts their shares with the new secret key, checks them against the Feldman
+// commitments of the kit and combines them into the lost secret key.
+//
+// Guardians only ever produce re-encryption keys, so neither they nor the proxy see the
+// shares in the clear. A guardian could still open its own envelope with its secret key,
+// but fewer than threshold shares reveal nothing about the secret key. Guardians must
+// check out of band that a recovery request comes from the owner before approving it.
+package recovery
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre/keys"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre/types"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/shamir"
+)
+
+// KitVersion is the serialization version written by Kit.MarshalBinary
+const KitVersion = 1
+
+const (
+	// kitHeaderSize is version (1) || threshold (2) || number of guardians (2)
+	kitHeaderSize = 5
+
+	// shareSize is the size of the plaintext of a guardian envelope: the shares of the
+	// First and Second scalars at the index of the guardian
+	shareSize = 2 * shamir.ScalarShareSize
+)
+
+// contextPrefix starts the context of the guardian envelopes, followed by the fingerprint
+// of the owner, so an envelope cannot be passed off as part of the kit of someone else
+const contextPrefix = "PRE_recovery_v1"
+
+var (
+	// ErrInvalidKit is returned when a kit is malformed or cannot be created
+	ErrInvalidKit = errors.New("invalid recovery kit")
+
+	// ErrNotEnoughShares is returned by Recover when fewer than threshold guardians
+	// approved the recovery, or when some of the approved shares are invalid
+	ErrNotEnoughShares = errors.New("not enough guardian shares")
+)
+
+// Kit holds what the proxy keeps to recover the secret key of Owner: the commitments to the
+// shares of both scalars and one envelope per guardian. The capsule of every envelope has
+// the fingerprint of the guardian as its Owner.
+type Kit struct {
+	Owner       *types.PublicKey     // Public key of the key pair to recover
+	Threshold   int                  // Number of guardians needed to recover
+	Commitments [2]shamir.Commitment // Commitments to the shares of the First and Second scalars
+	Guardians   []*types.Envelope    // Shares of the guardians, encrypted to them
+}
+
+// NewKit splits the secret key between the guardians, any threshold of which can help
+// recover it. The secret key must belong to a valid key pair of the scheme with params.
+func NewKit(params types.SystemParams, secretKey *types.SecretKey, guardians []*types.PublicKey, threshold int) (*Kit, error) {
+	owner, err := keys.SecretToPubkey(params, secretKey)
+	if err != nil {
+		return nil, err
+	}
+	if threshold < 1 || len(guardians) < threshold || len(guardians) > math.MaxUint16 {
+		return nil, fmt.Errorf("%w: cannot split between %d guardians with threshold %d", ErrInvalidKit, len(guardians), threshold)
+	}
+
+	fingerprints := make([][]byte, len(guardians))
+	for i, guardian := range guardians {
+		if guardian == nil || guardian.First == nil || guardian.Second == nil {
+			return nil, fmt.Errorf("%w: guardian %d has no public key", ErrInvalidKit, i)
+		}
+		fingerprints[i] = guardian.Fingerprint()
+		for j := range i {
+			if bytes.Equal(fingerprints[i], fingerprints[j]) {
+				return nil, fmt.Errorf("%w: guardian %d is also guardian %d", ErrInvalidKit, i, j)
+			}
+		}
+	}
+
+	firstShares, firstCommitment, err := shamir.SplitScalar(secretKey.First, threshold, len(guardians))
+	if err != nil {
+		return nil, err
+	}
+	secondShares, secondCommitment, err := shamir.SplitScalar(secretKey.Second, threshold, len(guardians))
+	if err != nil {
+		return nil, err
+	}
+
+	kit := &Kit{
+		Owner:       owner,
+		Threshold:   threshold,
+		Commitments: [2]shamir.Commitment{firstCommitment, secondCommitment},
+		Guardians:   make([]*types.Envelope, len(guardians)),
+	}
+
+	client := pre.NewClient(params)
+	opts := &types.EncryptOptions{Context: kit.context(), Prove: true}
+	for i, guardian := range guardians {
+		share, err := marshalShare(firstShares[i], secondShares[i])
+		if err != nil {
+			return nil, err
+		}
+		encryptedKey, encryptedShare, err := client.EncryptTo(guardian, share, opts)
+		clear(share)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encrypt the share of guardian %d: %w", i, err)
+		}
+		kit.Guardians[i] = types.NewEnvelopeFor(types.SchemeBN254, encryptedKey, encryptedShare)
+	}
+	return kit, nil
+}
+
+// Guardian returns the envelope of the guardian with the given public key fingerprint, or
+// nil if they are not a guardian of the kit
+func (k *Kit) Guardian(fingerprint []byte) *types.Envelope {
+	for _, envelope := range k.Guardians {
+		if bytes.Equal(envelope.Capsule.Owner, fingerprint) {
+			return envelope
+		}
+	}
+	return nil
+}
+
+// Approvals returns the number of guardians who approved the recovery for the key pair with
+// the given public key fingerprint
+func (k *Kit) Approvals(fingerprint []byte) int {
+	approvals := 0
+	for _, envelope := range k.Guardians {
+		if envelope.RecipientKey(fingerprint) != nil {
+			approvals++
+		}
+	}
+	return approvals
+}
+
+// Recover decrypts the shares the guardians re-encrypted for the key pair of secretKey and
+// combines them into the key pair of Owner. It fails with an error wrapping
+// ErrNotEnoughShares if fewer than threshold of them decrypt and match the commitments.
+//
+// The kit comes from the proxy, so callers must check that Owner is the public key they
+// expect before using the recovered key pair.
+func (k *Kit) Recover(params types.SystemParams, secretKey *types.SecretKey) (*types.KeyPair, error) {
+	if err := keys.ValidateSecretKey(secretKey); err != nil {
+		return nil, err
+	}
+	recoverer, err := keys.SecretToPubkey(params, secretKey)
+	if err != nil {
+		return nil, err
+	}
+	fingerprint := recoverer.Fingerprint()
+
+	client := pre.NewClient(params)
+	var firstShares, secondShares []*shamir.ScalarShare
+	approved := 0
+	for _, envelope := range k.Guardians {
+		if envelope.RecipientKey(fingerprint) == nil {
+			continue
+		}
+		approved++
+
+		// shares that do not decrypt or do not match the commitments are left out, the
+		// others may still be enough
+		share, err := client.DecryptEnvelopeAsRecipient(envelope, secretKey)
+		if err != nil || !bytes.Equal(envelope.Capsule.Context, k.context()) {
+			continue
+		}
+		first, second, err := unmarshalShare(share)
+		clear(share)
+		if err != nil || first.Index != second.Index {
+			continue
+		}
+		if k.Commitments[0].Verify(first) != nil || k.Commitments[1].Verify(second) != nil {
+			continue
+		}
+		firstShares = append(firstShares, first)
+		secondShares = append(secondShares, second)
+	}
+	if len(firstShares) < k.Threshold {
+		return nil, fmt.Errorf("%w: %d valid of %d approved, need %d", ErrNotEnoughShares, len(firstShares), approved, k.Threshold)
+	}
+
+	first, err := shamir.CombineScalars(firstShares[:k.Threshold])
+	if err != nil {
+		return nil, err
+	}
+	second, err := shamir.CombineScalars(secondShares[:k.Threshold])
+	if err != nil {
+		return nil, err
+	}
+
+	keyPair := &types.KeyPair{PublicKey: k.Owner, SecretKey: &types.SecretKey{First: first, Second: second}}
+	if err := keys.ValidateKeyPair(params, keyPair); err != nil {
+		return nil, err
+	}
+	return keyPair, nil
+}
+
+// MarshalBinary serializes the kit, integers big-endian:
+//
+//	version (1) || threshold (2) || number of guardians (2) || owner public key (512) ||
+//	commitment of First (32 per point) || commitment of Second (32 per point) ||
+//	per guardian: envelope length (4) || envelope
+//
+// Both commitments have threshold points. The envelopes keep their recipients, so the
+// approvals of a recovery are part of the kit.
+func (k *Kit) MarshalBinary() ([]byte, error) {
+	if k.Owner == nil || k.Threshold < 1 || len(k.Guardians) < k.Threshold || len(k.Guardians) > math.MaxUint16 {
+		return nil, fmt.Errorf("%w: incomplete kit", ErrInvalidKit)
+	}
+	for _, commitment := range k.Commitments {
+		if len(commitment) != k.Threshold {
+			return nil, fmt.Errorf("%w: commitment of %d points for threshold %d", ErrInvalidKit, len(commitment), k.Threshold)
+		}
+	}
+
+	data := []byte{KitVersion}
+	data = binary.BigEndian.AppendUint16(data, uint16(k.Threshold))      // #nosec G115 -- at most the number of guardians
+	data = binary.BigEndian.AppendUint16(data, uint16(len(k.Guardians))) // #nosec G115 -- checked above
+
+	owner, err := k.Owner.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	data = append(data, owner...)
+
+	for _, commitment := range k.Commitments {
+		points, err := commitment.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, points...)
+	}
+
+	for i, envelope := range k.Guardians {
+		encoded, err := envelope.Marshal()
+		if err != nil {
+			return nil, fmt.Errorf("guardian %d: %w", i, err)
+		}
+		data = binary.BigEndian.AppendUint32(data, uint32(len(encoded))) // #nosec G115 -- envelopes are far below 4 GiB
+		data = append(data, encoded...)
+	}
+	return data, nil
+}
+
+// UnmarshalBinary decodes a kit serialized by MarshalBinary. Every guardian envelope must
+// carry the fingerprint of a distinct guardian.
+func (k *Kit) UnmarshalBinary(data []byte) error {
+	if len(data) < kitHeaderSize+types.PublicKeySize {
+		return fmt.Errorf("%w: %d bytes", ErrInvalidKit, len(data))
+	}
+	if data[0] != KitVersion {
+		return fmt.Errorf("%w: version %d", ErrInvalidKit, data[0])
+	}
+	threshold := int(binary.BigEndian.Uint16(data[1:]))
+	guardians := int(binary.BigEndian.Uint16(data[3:]))
+	if threshold < 1 || guardians < threshold {
+		return fmt.Errorf("%w: %d guardians with threshold %d", ErrInvalidKit, guardians, threshold)
+	}
+	data = data[kitHeaderSize:]
+
+	owner := new(types.PublicKey)
+	if err := owner.UnmarshalBinary(data[:types.PublicKeySize]); err != nil {
+		return fmt.Errorf("%w: owner: %v", ErrInvalidKit, err)
+	}
+	data = data[types.PublicKeySize:]
+
+	var commitments [2]shamir.Commitment
+	commitmentSize := threshold * bn254.SizeOfG1AffineCompressed
+	for i := range commitments {
+		if len(data) < commitmentSize {
+			return fmt.Errorf("%w: truncated commitment", ErrInvalidKit)
+		}
+		if err := commitments[i].UnmarshalBinary(data[:commitmentSize]); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidKit, err)
+		}
+		data = data[commitmentSize:]
+	}
+
+	envelopes := make([]*types.Envelope, guardians)
+	for i := range envelopes {
+		if len(data) < 4 {
+			return fmt.Errorf("%w: truncated guardian %d", ErrInvalidKit, i)
+		}
+		size := binary.BigEndian.Uint32(data)
+		data = data[4:]
+		if uint64(len(data)) < uint64(size) {
+			return fmt.Errorf("%w: truncated guardian %d", ErrInvalidKit, i)
+		}
+
+		envelopes[i] = new(types.Envelope)
+		if err := envelopes[i].Unmarshal(data[:size]); err != nil {
+			return fmt.Errorf("%w: guardian %d: %v", ErrInvalidKit, i, err)
+		}
+		data = data[size:]
+
+		guardian := envelopes[i].Capsule.Owner
+		if len(guardian) == 0 {
+			return fmt.Errorf("%w: guardian %d has no fingerprint", ErrInvalidKit, i)
+		}
+		for j := range i {
+			if bytes.Equal(envelopes[j].Capsule.Owner, guardian) {
+				return fmt.Errorf("%w: guardian %d is also guardian %d", ErrInvalidKit, i, j)
+			}
+		}
+	}
+	if len(data) != 0 {
+		return fmt.Errorf("%w: %d trailing bytes", ErrInvalidKit, len(data))
+	}
+
+	k.Owner, k.Threshold, k.Commitments, k.Guardians = owner, threshold, commitments, envelopes
+	return nil
+}
+
+// context returns the context of the guardian envelopes of the kit
+func (k *Kit) context() []byte {
+	return append([]byte(contextPrefix), k.Owner.Fingerprint()...)
+}
+
+// marshalShare encodes the shares of both scalars of a guardian
+func marshalShare(first, second *shamir.ScalarShare) ([]byte, error) {
+	firstBytes, err := first.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	secondBytes, err := second.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return append(firstBytes, secondBytes...), nil
+}
+
+// unmarshalShare decodes the shares written by marshalShare
+func unmarshalShare(data []byte) (*shamir.ScalarShare, *shamir.ScalarShare, error) {
+	if len(data) != shareSize {
+		return nil, nil, fmt.Errorf("%w: share of %d bytes", shamir.ErrInvalidShare, len(data))
+	}
+
+	first, second := new(shamir.ScalarShare), new(shamir.ScalarShare)
+	if err := first.UnmarshalBinary(data[:shamir.ScalarShareSize]); err != nil {
+		return nil, nil, err
+	}
+	if err := second.UnmarshalBinary(data[shamir.ScalarShareSize:]); err != nil {
+		return nil, nil, err
+	}
+	return first, second, nil
+}
@@ -0,0 +1,138 @@
+package recovery_test
+
+import (
+	"testing"
+
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre/keys"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre/recovery"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre/types"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/testutils"
+	"github.com/stretchr/testify/require"
+)
+
+// approve adds the recipient to the envelope of the guardian like the proxy does, with the
+// re-encryption key the guardian hands it
+func approve(t *testing.T, scheme *types.PreScheme, kit *recovery.Kit, guardian *types.KeyPair, recipient *types.PublicKey) {
+	envelope := kit.Guardian(guardian.PublicKey.Fingerprint())
+	require.NotNil(t, envelope)
+
+	reKey := scheme.Client.GenerateReEncryptionKey(guardian.SecretKey, recipient)
+	require.NoError(t, scheme.Proxy.AddRecipient(envelope, recipient.Fingerprint(), reKey))
+}
+
+// roundTrip serializes the kit like the proxy stores it
+func roundTrip(t *testing.T, kit *recovery.Kit) *recovery.Kit {
+	data, err := kit.MarshalBinary()
+	require.NoError(t, err)
+
+	decoded := new(recovery.Kit)
+	require.NoError(t, decoded.UnmarshalBinary(data))
+	return decoded
+}
+
+func TestRecovery(t *testing.T) {
+	scheme := pre.NewPreScheme()
+	owner := testutils.GenerateRandomKeyPair(scheme.Params.G2, scheme.Params.Z)
+	guardians := make([]*types.KeyPair, 5)
+	publicKeys := make([]*types.PublicKey, len(guardians))
+	for i := range guardians {
+		guardians[i] = testutils.GenerateRandomKeyPair(scheme.Params.G2, scheme.Params.Z)
+		publicKeys[i] = guardians[i].PublicKey
+	}
+
+	kit, err := recovery.NewKit(scheme.Params, owner.SecretKey, publicKeys, 3)
+	require.NoError(t, err)
+	require.Len(t, kit.Guardians, 5)
+	kit = roundTrip(t, kit)
+
+	// the owner loses the device and generates a new key pair
+	device := testutils.GenerateRandomKeyPair(scheme.Params.G2, scheme.Params.Z)
+
+	approve(t, scheme, kit, guardians[4], device.PublicKey)
+	approve(t, scheme, kit, guardians[1], device.PublicKey)
+	require.Equal(t, 2, kit.Approvals(device.PublicKey.Fingerprint()))
+	_, err = kit.Recover(scheme.Params, device.SecretKey)
+	require.ErrorIs(t, err, recovery.ErrNotEnoughShares)
+
+	approve(t, scheme, kit, guardians[2], device.PublicKey)
+	kit = roundTrip(t, kit)
+	require.Equal(t, 3, kit.Approvals(device.PublicKey.Fingerprint()))
+
+	recovered, err := kit.Recover(scheme.Params, device.SecretKey)
+	require.NoError(t, err)
+	require.Equal(t, owner.SecretKey, recovered.SecretKey)
+	require.Equal(t, owner.PublicKey, recovered.PublicKey)
+
+	t.Run("other recoverer", func(t *testing.T) {
+		// approvals are bound to the key pair they were given for
+		other := testutils.GenerateRandomKeyPair(scheme.Params.G2, scheme.Params.Z)
+		require.Zero(t, kit.Approvals(other.PublicKey.Fingerprint()))
+		_, err := kit.Recover(scheme.Params, other.SecretKey)
+		require.ErrorIs(t, err, recovery.ErrNotEnoughShares)
+	})
+
+	t.Run("tampered share", func(t *testing.T) {
+		tampered := roundTrip(t, kit)
+		tampered.Guardians[4].Payload[len(tampered.Guardians[4].Payload)-1] ^= 1
+		_, err := tampered.Recover(scheme.Params, device.SecretKey)
+		require.ErrorIs(t, err, recovery.ErrNotEnoughShares)
+
+		// a fourth approval makes up for it
+		approve(t, scheme, tampered, guardians[0], device.PublicKey)
+		recovered, err := tampered.Recover(scheme.Params, device.SecretKey)
+		require.NoError(t, err)
+		require.Equal(t, owner.SecretKey, recovered.SecretKey)
+	})
+
+	t.Run("swapped owner", func(t *testing.T) {
+		swapped := roundTrip(t, kit)
+		swapped.Owner = guardians[0].PublicKey
+		_, err := swapped.Recover(scheme.Params, device.SecretKey)
+		require.Error(t, err)
+	})
+}
+
+func TestNewKitInvalid(t *testing.T) {
+	scheme := pre.NewPreScheme()
+	owner := testutils.GenerateRandomKeyPair(scheme.Params.G2, scheme.Params.Z)
+	guardian := testutils.GenerateRandomKeyPair(scheme.Params.G2, scheme.Params.Z)
+	other := testutils.GenerateRandomKeyPair(scheme.Params.G2, scheme.Params.Z)
+
+	for _, split := range []struct {
+		guardians []*types.PublicKey
+		threshold int
+	}{
+		{[]*types.PublicKey{guardian.PublicKey, other.PublicKey}, 0},
+		{[]*types.PublicKey{guardian.PublicKey, other.PublicKey}, 3},
+		{[]*types.PublicKey{guardian.PublicKey, guardian.PublicKey}, 2},
+		{[]*types.PublicKey{guardian.PublicKey, nil}, 1},
+	} {
+		_, err := recovery.NewKit(scheme.Params, owner.SecretKey, split.guardians, split.threshold)
+		require.ErrorIs(t, err, recovery.ErrInvalidKit)
+	}
+
+	_, err := recovery.NewKit(scheme.Params, &types.SecretKey{}, []*types.PublicKey{guardian.PublicKey}, 1)
+	require.ErrorIs(t, err, keys.ErrInvalidSecretKey)
+}
+
+func TestKitUnmarshalInvalid(t *testing.T) {
+	scheme := pre.NewPreScheme()
+	owner := testutils.GenerateRandomKeyPair(scheme.Params.G2, scheme.Params.Z)
+	guardian := testutils.GenerateRandomKeyPair(scheme.Params.G2, scheme.Params.Z)
+
+	kit, err := recovery.NewKit(scheme.Params, owner.SecretKey, []*types.PublicKey{guardian.PublicKey}, 1)
+	require.NoError(t, err)
+	data, err := kit.MarshalBinary()
+	require.NoError(t, err)
+
+	for name, invalid := range map[string][]byte{
+		"empty":     nil,
+		"version":   append([]byte{2}, data[1:]...),
+		"threshold": append([]byte{data[0], 0, 2}, data[3:]...),
+		"truncated": data[:len(data)-1],
+		"trailing":  append(append([]byte(nil), data...), 0),
+	} {
+		require.ErrorIs(t, new(recovery.Kit).UnmarshalBinary(invalid), recovery.ErrInvalidKit, name)
+	}
+}
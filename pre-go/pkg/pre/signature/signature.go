@@ -0,0 +1,253 @@
+// Package signature signs messages with PRE key pairs, so a service can check that a
+// request comes from the holder of a public key without a separate signing key.
+//
+// Signatures are BLS signatures over BN254 under a signing scalar s derived from the secret
+// key, never under a1 or a2 themselves: BLS signing hands out H(m)^x for messages of the
+// caller's choice, powers of the secret that the PRE scheme is not designed to withstand.
+// The signature sig = H(m)^s in G1 is verified against the verifying key V = g2^s with
+// e(sig, g2) = e(H(m), V). H is the hash-to-curve of RFC 9380 with a domain separation tag
+// of its own.
+//
+// V is bound to the PRE public key by a Schnorr proof of knowledge of both a1 behind
+// PublicKey.First = Z^a1 and a2 behind PublicKey.Second = g2^a2, whose challenge hashes V.
+// Proving a1 as well keeps anyone from pairing the Second component of a key with a First
+// component they picked, such as the one of another key, and signing for the result. Being
+// zero-knowledge, the proof reveals nothing about a1 or a2. Z is the generator of
+// utils.GenerateSystemParameters, like for the keys of the proxy. Every signature carries V
+// and the proof, so verifiers only need the PRE public key.
+package signature
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre/keys"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre/types"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre/utils"
+)
+
+// Size is the size of a signature: the compressed verifying key, the challenge and the two
+// responses of the proof binding it to the PRE public key, and the compressed G1 point
+const Size = bn254.SizeOfG2AffineCompressed + 3*fr.Bytes + bn254.SizeOfG1AffineCompressed
+
+// Domain separation tags of the hash to G1, of the derivation of the signing scalar and of
+// the challenge of the proof binding the verifying key
+var (
+	dst           = []byte("PRE_BN254_SIG_BLS_SIG_BN254G1_XMD:SHA-256_SVDW_RO_")
+	signingKeyDST = []byte("PRE_BN254_signing_key_v1")
+	bindingDST    = []byte("PRE_BN254_signing_key_binding_v2")
+)
+
+var (
+	// ErrInvalidSignature is returned when a signature is malformed or does not verify
+	ErrInvalidSignature = errors.New("invalid signature")
+
+	// ErrInvalidKey is returned for secret or public keys that cannot sign or verify
+	ErrInvalidKey = errors.New("invalid key")
+)
+
+// Sign signs message with the signing key derived from the key pair and returns the
+// signature, verifying key and binding proof included
+func Sign(keyPair *types.KeyPair, message []byte) ([]byte, error) {
+	if keyPair == nil || keyPair.SecretKey == nil || keyPair.PublicKey == nil || keyPair.PublicKey.First == nil || keyPair.PublicKey.Second == nil ||
+		!isScalar(keyPair.SecretKey.First) || !isScalar(keyPair.SecretKey.Second) {
+		return nil, ErrInvalidKey
+	}
+
+	s, err := signingScalar(keyPair.SecretKey)
+	if err != nil {
+		return nil, err
+	}
+	_, _, _, g2 := bn254.Generators()
+	verifyingKey := new(bn254.G2Affine).ScalarMultiplication(&g2, s)
+
+	// Schnorr proof of knowledge of a1 and a2: T1 = Z^w1, T2 = g2^w2,
+	// response1 = w1 + c·a1 and response2 = w2 + c·a2
+	w1, err := keys.RandomScalar(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	w2, err := keys.RandomScalar(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	commitment1 := utils.PreparedSystemParameters().ZExp(w1)
+	commitment2 := new(bn254.G2Affine).ScalarMultiplication(&g2, w2)
+	challenge, err := bindingChallenge(keyPair.PublicKey, verifyingKey, commitment1, commitment2)
+	if err != nil {
+		return nil, err
+	}
+	response1 := schnorrResponse(w1, challenge, keyPair.SecretKey.First)
+	response2 := schnorrResponse(w2, challenge, keyPair.SecretKey.Second)
+
+	h, err := bn254.HashToG1(message, dst)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash message: %w", err)
+	}
+	sig := new(bn254.G1Affine).ScalarMultiplication(&h, s)
+
+	var challengeElement, response1Element, response2Element fr.Element
+	challengeElement.SetBigInt(challenge)
+	response1Element.SetBigInt(response1)
+	response2Element.SetBigInt(response2)
+	verifyingKeyBytes := verifyingKey.Bytes()
+	challengeBytes := challengeElement.Bytes()
+	response1Bytes := response1Element.Bytes()
+	response2Bytes := response2Element.Bytes()
+	sigBytes := sig.Bytes()
+
+	data := make([]byte, 0, Size)
+	data = append(data, verifyingKeyBytes[:]...)
+	data = append(data, challengeBytes[:]...)
+	data = append(data, response1Bytes[:]...)
+	data = append(data, response2Bytes[:]...)
+	data = append(data, sigBytes[:]...)
+	return data, nil
+}
+
+// Verify checks that sig is a signature of message by the holder of the public key.
+// It returns nil on success and an error wrapping ErrInvalidSignature otherwise.
+func Verify(publicKey *types.PublicKey, message, sig []byte) error {
+	if publicKey == nil || publicKey.First == nil || publicKey.First.IsZero() || publicKey.Second == nil || publicKey.Second.IsInfinity() {
+		return ErrInvalidKey
+	}
+	if len(sig) != Size {
+		return fmt.Errorf("%w: expected %d bytes, got %d", ErrInvalidSignature, Size, len(sig))
+	}
+
+	// SetBytes checks that the points are on the curve and in their subgroups
+	verifyingKey := new(bn254.G2Affine)
+	if _, err := verifyingKey.SetBytes(sig[:bn254.SizeOfG2AffineCompressed]); err != nil {
+		return fmt.Errorf("%w: verifying key: %v", ErrInvalidSignature, err)
+	}
+	if verifyingKey.IsInfinity() {
+		return fmt.Errorf("%w: verifying key at infinity", ErrInvalidSignature)
+	}
+	sig = sig[bn254.SizeOfG2AffineCompressed:]
+
+	var challenge, response1, response2 fr.Element
+	if err := challenge.SetBytesCanonical(sig[:fr.Bytes]); err != nil {
+		return fmt.Errorf("%w: challenge: %v", ErrInvalidSignature, err)
+	}
+	if err := response1.SetBytesCanonical(sig[fr.Bytes : 2*fr.Bytes]); err != nil {
+		return fmt.Errorf("%w: response: %v", ErrInvalidSignature, err)
+	}
+	if err := response2.SetBytesCanonical(sig[2*fr.Bytes : 3*fr.Bytes]); err != nil {
+		return fmt.Errorf("%w: response: %v", ErrInvalidSignature, err)
+	}
+	sig = sig[3*fr.Bytes:]
+
+	var point bn254.G1Affine
+	if _, err := point.SetBytes(sig); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	if point.IsInfinity() {
+		return fmt.Errorf("%w: point at infinity", ErrInvalidSignature)
+	}
+
+	// T1 = Z^response1 / (Z^a1)^challenge and T2 = g2^response2 / (g2^a2)^challenge
+	_, _, _, g2 := bn254.Generators()
+	c := challenge.BigInt(new(big.Int))
+	var blind1 bn254.GT
+	commitment1 := utils.PreparedSystemParameters().ZExp(response1.BigInt(new(big.Int)))
+	commitment1.Mul(commitment1, blind1.Inverse(blind1.Exp(*publicKey.First, c)))
+	var commitment2, blind2 bn254.G2Affine
+	commitment2.ScalarMultiplication(&g2, response2.BigInt(new(big.Int)))
+	blind2.ScalarMultiplication(publicKey.Second, c)
+	commitment2.Sub(&commitment2, &blind2)
+	expected, err := bindingChallenge(publicKey, verifyingKey, commitment1, &commitment2)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	if expected.Cmp(c) != 0 {
+		return fmt.Errorf("%w: verifying key not bound to the public key", ErrInvalidSignature)
+	}
+
+	h, err := bn254.HashToG1(message, dst)
+	if err != nil {
+		return fmt.Errorf("failed to hash message: %w", err)
+	}
+
+	// e(sig, g2) * e(-H(m), V) == 1
+	var negH bn254.G1Affine
+	negH.Neg(&h)
+	ok, err := bn254.PairingCheck([]bn254.G1Affine{point, negH}, []bn254.G2Affine{g2, *verifyingKey})
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	if !ok {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
+
+// VerifyingKey returns the verifying key g2^s of the signing scalar s derived from the
+// secret key, the key Sign embeds in signatures
+func VerifyingKey(secretKey *types.SecretKey) (*bn254.G2Affine, error) {
+	if secretKey == nil || !isScalar(secretKey.First) || !isScalar(secretKey.Second) {
+		return nil, ErrInvalidKey
+	}
+	s, err := signingScalar(secretKey)
+	if err != nil {
+		return nil, err
+	}
+	_, _, _, g2 := bn254.Generators()
+	return new(bn254.G2Affine).ScalarMultiplication(&g2, s), nil
+}
+
+// signingScalar derives the signing scalar from both scalars of the secret key
+func signingScalar(secretKey *types.SecretKey) (*big.Int, error) {
+	var a1, a2 [fr.Bytes]byte
+	secretKey.First.FillBytes(a1[:])
+	secretKey.Second.FillBytes(a2[:])
+
+	scalar, err := fr.Hash(append(a1[:], a2[:]...), signingKeyDST, 1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive signing scalar: %v", err)
+	}
+	if scalar[0].IsZero() {
+		return nil, fmt.Errorf("failed to derive signing scalar: zero")
+	}
+	return scalar[0].BigInt(new(big.Int)), nil
+}
+
+// schnorrResponse returns w + c·x mod r
+func schnorrResponse(w, c, x *big.Int) *big.Int {
+	response := new(big.Int).Mul(c, x)
+	response.Add(response, w)
+	return response.Mod(response, fr.Modulus())
+}
+
+// bindingChallenge hashes the PRE public key, the verifying key and the commitments of the
+// prover to a1 and a2
+func bindingChallenge(publicKey *types.PublicKey, verifyingKey *bn254.G2Affine, commitment1 *bn254.GT, commitment2 *bn254.G2Affine) (*big.Int, error) {
+	publicKeyBytes, err := publicKey.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	verifyingKeyBytes := verifyingKey.Bytes()
+	commitment1Bytes := commitment1.Bytes()
+	commitment2Bytes := commitment2.Bytes()
+
+	msg := make([]byte, 0, len(publicKeyBytes)+2*bn254.SizeOfG2AffineCompressed+bn254.SizeOfGT)
+	msg = append(msg, publicKeyBytes...)
+	msg = append(msg, verifyingKeyBytes[:]...)
+	msg = append(msg, commitment1Bytes[:]...)
+	msg = append(msg, commitment2Bytes[:]...)
+
+	challenge, err := fr.Hash(msg, bindingDST, 1)
+	if err != nil {
+		return nil, err
+	}
+	return challenge[0].BigInt(new(big.Int)), nil
+}
+
+// isScalar reports whether x is a valid secret scalar, i.e. in [1, r-1]
+func isScalar(x *big.Int) bool {
+	return x != nil && x.Sign() > 0 && x.Cmp(bn254.ID.ScalarField()) < 0
+}
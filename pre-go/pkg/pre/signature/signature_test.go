@@ -0,0 +1,70 @@
+package signature_test
+
+import (
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre/signature"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre/types"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/testutils"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignVerify(t *testing.T) {
+	scheme := pre.NewPreScheme()
+	alice := testutils.GenerateRandomKeyPair(scheme.Params.G2, scheme.Params.Z)
+	bob := testutils.GenerateRandomKeyPair(scheme.Params.G2, scheme.Params.Z)
+	message := []byte("DELETE /delegations/42")
+
+	sig, err := signature.Sign(alice, message)
+	require.NoError(t, err)
+	require.Len(t, sig, signature.Size)
+	require.NoError(t, signature.Verify(alice.PublicKey, message, sig))
+
+	t.Run("other message", func(t *testing.T) {
+		require.ErrorIs(t, signature.Verify(alice.PublicKey, []byte("DELETE /delegations/43"), sig), signature.ErrInvalidSignature)
+	})
+
+	t.Run("other key", func(t *testing.T) {
+		require.ErrorIs(t, signature.Verify(bob.PublicKey, message, sig), signature.ErrInvalidSignature)
+	})
+
+	t.Run("signing key", func(t *testing.T) {
+		// the signature is under a key of its own rather than a2, published at its start
+		verifyingKey, err := signature.VerifyingKey(alice.SecretKey)
+		require.NoError(t, err)
+		verifyingKeyBytes := verifyingKey.Bytes()
+		require.Equal(t, verifyingKeyBytes[:], sig[:len(verifyingKeyBytes)])
+		require.False(t, verifyingKey.Equal(alice.PublicKey.Second))
+
+		// and it cannot be swapped for the key of someone else
+		bobSig, err := signature.Sign(bob, message)
+		require.NoError(t, err)
+		forged := append(append([]byte{}, bobSig[:len(verifyingKeyBytes)]...), sig[len(verifyingKeyBytes):len(sig)-bn254.SizeOfG1AffineCompressed]...)
+		forged = append(forged, bobSig[len(bobSig)-bn254.SizeOfG1AffineCompressed:]...)
+		require.ErrorIs(t, signature.Verify(alice.PublicKey, message, forged), signature.ErrInvalidSignature)
+	})
+
+	t.Run("public key of mixed halves", func(t *testing.T) {
+		// a2 alone cannot sign for a key whose First component was taken from someone else
+		mixed := &types.KeyPair{
+			PublicKey: &types.PublicKey{First: bob.PublicKey.First, Second: alice.PublicKey.Second},
+			SecretKey: alice.SecretKey,
+		}
+		mixedSig, err := signature.Sign(mixed, message)
+		require.NoError(t, err)
+		require.ErrorIs(t, signature.Verify(mixed.PublicKey, message, mixedSig), signature.ErrInvalidSignature)
+	})
+
+	t.Run("malformed signature", func(t *testing.T) {
+		require.ErrorIs(t, signature.Verify(alice.PublicKey, message, sig[1:]), signature.ErrInvalidSignature)
+		require.ErrorIs(t, signature.Verify(alice.PublicKey, message, make([]byte, signature.Size)), signature.ErrInvalidSignature)
+	})
+
+	t.Run("invalid keys", func(t *testing.T) {
+		_, err := signature.Sign(nil, message)
+		require.ErrorIs(t, err, signature.ErrInvalidKey)
+		require.ErrorIs(t, signature.Verify(nil, message, sig), signature.ErrInvalidKey)
+	})
+}
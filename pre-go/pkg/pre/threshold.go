@@ -0,0 +1,217 @@
+package pre
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"math"
+	"math/big"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre/keys"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre/types"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/shamir"
+)
+
+// GenerateReKeyFragments splits the re-encryption key A->B into shares fragments, one per
+// proxy, any threshold of which are needed to re-encrypt a key for B. The scalar a1 of A is
+// shared with Shamir's scheme over the scalar field: fragment i is (g2^b2)^f(i) for a random
+// polynomial f of degree threshold-1 with f(0) = a1. Fewer than threshold proxies, even with
+// the help of B, learn nothing about the re-encryption key.
+func (p *preClient) GenerateReKeyFragments(secretA *types.SecretKey, publicB *types.PublicKey, threshold, shares int) ([]*types.ReKeyFragment, error) {
+	return p.GenerateReKeyFragmentsContext(context.Background(), secretA, publicB, threshold, shares)
+}
+
+// GenerateReKeyFragmentsContext is GenerateReKeyFragments returning the error of ctx if it is
+// done before all the fragments are computed
+func (p *preClient) GenerateReKeyFragmentsContext(ctx context.Context, secretA *types.SecretKey, publicB *types.PublicKey, threshold, shares int) ([]*types.ReKeyFragment, error) {
+	if threshold < 1 || shares < threshold || shares > math.MaxUint16 {
+		return nil, fmt.Errorf("%w: cannot split into %d fragments with threshold %d", types.ErrInvalidFragment, shares, threshold)
+	}
+	if secretA == nil || !isValidScalar(secretA.First) || publicB == nil || publicB.Second == nil {
+		return nil, types.ErrInvalidKey
+	}
+
+	// f(x) = a1 + c1·x + ... + c(t-1)·x^(t-1)
+	coefficients := make([]fr.Element, threshold)
+	coefficients[0].SetBigInt(secretA.First)
+	for i := 1; i < threshold; i++ {
+		c, err := keys.RandomScalar(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		coefficients[i].SetBigInt(c)
+	}
+
+	fragments := make([]*types.ReKeyFragment, shares)
+	for i := range fragments {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		index := uint16(i + 1) // #nosec G115 -- shares is checked above
+		share := shamir.EvaluatePolynomial(coefficients, index)
+		if share.IsZero() {
+			return nil, fmt.Errorf("%w: zero share", types.ErrInvalidFragment)
+		}
+
+		fragments[i] = &types.ReKeyFragment{
+			Index:     index,
+			Threshold: uint16(threshold), // #nosec G115 -- at most shares
+			Key:       new(bn254.G2Affine).ScalarMultiplication(publicB.Second, share.BigInt(new(big.Int))),
+		}
+	}
+	return fragments, nil
+}
+
+// ReEncryptFragment re-encrypts a second-level key with one fragment of a re-encryption key.
+// The result only carries a share of the First component of the first-level key; the
+// delegatee combines the fragments of threshold proxies with CombineFragments.
+func (p *preProxy) ReEncryptFragment(encryptedKey *types.SecondLevelSymmetricKey, fragment *types.ReKeyFragment) (*types.FirstLevelKeyFragment, error) {
+	return p.ReEncryptFragmentContext(context.Background(), encryptedKey, fragment)
+}
+
+// ReEncryptFragmentContext is ReEncryptFragment returning the error of ctx if it is already done
+func (p *preProxy) ReEncryptFragmentContext(ctx context.Context, encryptedKey *types.SecondLevelSymmetricKey, fragment *types.ReKeyFragment) (*types.FirstLevelKeyFragment, error) {
+	if err := checkReKeyFragment(fragment); err != nil {
+		return nil, err
+	}
+
+	key, err := p.ReEncryptionContext(ctx, encryptedKey, fragment.Key)
+	if err != nil {
+		return nil, err
+	}
+	return &types.FirstLevelKeyFragment{
+		Index:     fragment.Index,
+		Threshold: fragment.Threshold,
+		Key:       key,
+	}, nil
+}
+
+// ReEncryptFragmentWithProof is ReEncryptFragment along with a proof, checked by
+// VerifyFragment, that the result was computed with the fragment
+func (p *preProxy) ReEncryptFragmentWithProof(encryptedKey *types.SecondLevelSymmetricKey, fragment *types.ReKeyFragment) (*types.FirstLevelKeyFragment, *types.ReEncryptionProof, error) {
+	return p.ReEncryptFragmentWithProofContext(context.Background(), encryptedKey, fragment)
+}
+
+// ReEncryptFragmentWithProofContext is ReEncryptFragmentWithProof returning the error of ctx
+// if it is done before the re-encryption or before the proof
+func (p *preProxy) ReEncryptFragmentWithProofContext(ctx context.Context, encryptedKey *types.SecondLevelSymmetricKey, fragment *types.ReKeyFragment) (*types.FirstLevelKeyFragment, *types.ReEncryptionProof, error) {
+	if err := checkReKeyFragment(fragment); err != nil {
+		return nil, nil, err
+	}
+
+	key, proof, err := p.ReEncryptionWithProofContext(ctx, encryptedKey, fragment.Key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &types.FirstLevelKeyFragment{
+		Index:     fragment.Index,
+		Threshold: fragment.Threshold,
+		Key:       key,
+	}, proof, nil
+}
+
+// checkReKeyFragment checks that a re-encryption key fragment is complete
+func checkReKeyFragment(fragment *types.ReKeyFragment) error {
+	if fragment == nil || fragment.Index == 0 || fragment.Threshold == 0 || fragment.Key == nil {
+		return fmt.Errorf("%w: incomplete re-encryption key fragment", types.ErrInvalidFragment)
+	}
+	return nil
+}
+
+// VerifyFragment checks the proof that a first-level key fragment was re-encrypted with the
+// re-encryption key fragment of the same index, commitment being ReKeyCommitment of that
+// fragment. The delegator computes the commitments of the fragments when splitting the
+// re-encryption key and publishes them, so that delegatees can tell which proxies
+// misbehaved. If the fragment carries the capsule of the second-level key, it must be the
+// capsule of the proof. An error wrapping types.ErrInvalidProof is returned if the proof does
+// not verify.
+func VerifyFragment(commitment *bn254.GT, fragment *types.FirstLevelKeyFragment, proof *types.ReEncryptionProof) error {
+	if fragment == nil || fragment.Key == nil {
+		return fmt.Errorf("%w: incomplete statement", types.ErrInvalidProof)
+	}
+	if proof != nil && proof.Capsule != nil && fragment.Key.Capsule != nil && !proof.Capsule.Equal(fragment.Key.Capsule) {
+		return fmt.Errorf("%w: proof of another capsule", types.ErrInvalidProof)
+	}
+	return VerifyReEncryption(commitment, fragment.Key, proof)
+}
+
+// CombineFragments combines the first-level key fragments of at least threshold distinct
+// proxies into the first-level key a single proxy holding the whole re-encryption key would
+// have produced. The threshold is the one the delegator split the re-encryption key with,
+// not the one carried by the fragments, which the proxies could lie about. The fragments
+// must come from the re-encryption of the same second-level key.
+//
+// The key is interpolated from the first threshold fragments, and every extra fragment must
+// lie on the same polynomial. Fragments that do not are reported as inconsistent; the
+// delegatee then finds the proxies that misbehaved with VerifyFragment and combines the
+// fragments that verify. Errors wrap types.ErrInvalidFragment.
+func CombineFragments(fragments []*types.FirstLevelKeyFragment, threshold int) (*types.FirstLevelSymmetricKey, error) {
+	if threshold < 1 || threshold > math.MaxUint16 || len(fragments) < threshold {
+		return nil, fmt.Errorf("%w: %d fragments for threshold %d", types.ErrInvalidFragment, len(fragments), threshold)
+	}
+
+	indices := make([]uint16, len(fragments))
+	seen := make(map[uint16]bool, len(fragments))
+	for i, fragment := range fragments {
+		if fragment == nil || fragment.Key == nil || fragment.Key.First == nil || fragment.Key.Second == nil {
+			return nil, fmt.Errorf("%w: fragment %d is incomplete", types.ErrInvalidFragment, i)
+		}
+		if int(fragment.Threshold) != threshold {
+			return nil, fmt.Errorf("%w: fragment %d has threshold %d instead of %d", types.ErrInvalidFragment, i, fragment.Threshold, threshold)
+		}
+		if !fragment.Key.Second.Equal(fragments[0].Key.Second) {
+			return nil, fmt.Errorf("%w: fragment %d is not a re-encryption of the same key", types.ErrInvalidFragment, i)
+		}
+		if fragment.Index == 0 || seen[fragment.Index] {
+			return nil, fmt.Errorf("%w: fragment %d has a duplicate or zero index %d", types.ErrInvalidFragment, i, fragment.Index)
+		}
+		seen[fragment.Index] = true
+		indices[i] = fragment.Index
+	}
+
+	// First = Π First_i^λi with the Lagrange coefficients at 0 of the indices
+	first, err := interpolateFragments(fragments[:threshold], indices[:threshold], 0)
+	if err != nil {
+		return nil, err
+	}
+
+	// First_j = Π First_i^λi with the Lagrange coefficients at j for every extra fragment j
+	for i := threshold; i < len(fragments); i++ {
+		expected, err := interpolateFragments(fragments[:threshold], indices[:threshold], indices[i])
+		if err != nil {
+			return nil, err
+		}
+		if !expected.Equal(fragments[i].Key.First) {
+			return nil, fmt.Errorf("%w: fragments are inconsistent, check them with VerifyFragment", types.ErrInvalidFragment)
+		}
+	}
+
+	reference := fragments[0]
+	return &types.FirstLevelSymmetricKey{
+		First:   first,
+		Second:  reference.Key.Second,
+		Capsule: reference.Key.Capsule,
+
+		CapsuleAttributes: reference.Key.CapsuleAttributes,
+	}, nil
+}
+
+// interpolateFragments interpolates at x the First components of the fragments, known at
+// the given indices
+func interpolateFragments(fragments []*types.FirstLevelKeyFragment, indices []uint16, x uint16) (*bn254.GT, error) {
+	lambdas, err := shamir.LagrangeCoefficientsAt(indices, x)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", types.ErrInvalidFragment, err)
+	}
+
+	result := new(bn254.GT).SetOne()
+	var share bn254.GT
+	for i, fragment := range fragments {
+		share.Exp(*fragment.Key.First, lambdas[i].BigInt(new(big.Int)))
+		result.Mul(result, &share)
+	}
+	return result, nil
+}
@@ -0,0 +1,258 @@
+package pre_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre/types"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/testutils"
+	"github.com/stretchr/testify/require"
+)
+
+// thresholdProxy is a proxy node holding one fragment of a re-encryption key, which only
+// sees serialized fragments like a remote node would
+type thresholdProxy struct {
+	proxy    types.FragmentProxy
+	fragment []byte
+}
+
+// reEncrypt re-encrypts the key with the fragment of the node and returns the serialized result
+func (n *thresholdProxy) reEncrypt(encryptedKey *types.SecondLevelSymmetricKey) ([]byte, error) {
+	fragment := new(types.ReKeyFragment)
+	if err := fragment.UnmarshalBinary(n.fragment); err != nil {
+		return nil, err
+	}
+
+	keyFragment, err := n.proxy.ReEncryptFragment(encryptedKey, fragment)
+	if err != nil {
+		return nil, err
+	}
+	return keyFragment.MarshalBinary()
+}
+
+// newThresholdProxies distributes the serialized fragments of the re-encryption key A->B to n proxies
+func newThresholdProxies(t *testing.T, scheme *types.PreScheme, alice, bob *types.KeyPair, threshold, n int) []*thresholdProxy {
+	fragments, err := scheme.Client.(types.FragmentClient).GenerateReKeyFragments(alice.SecretKey, bob.PublicKey, threshold, n)
+	require.NoError(t, err)
+	require.Len(t, fragments, n)
+
+	proxies := make([]*thresholdProxy, n)
+	for i, fragment := range fragments {
+		data, err := fragment.MarshalBinary()
+		require.NoError(t, err)
+		require.Len(t, data, types.ReKeyFragmentSize)
+		proxies[i] = &thresholdProxy{proxy: pre.NewProxy().(types.FragmentProxy), fragment: data}
+	}
+	return proxies
+}
+
+// decodeKeyFragments parses serialized first-level key fragments and attaches the attributes
+// of the second-level key, which travel alongside them
+func decodeKeyFragments(t *testing.T, encryptedKey *types.SecondLevelSymmetricKey, data [][]byte) []*types.FirstLevelKeyFragment {
+	fragments := make([]*types.FirstLevelKeyFragment, len(data))
+	for i := range data {
+		fragments[i] = new(types.FirstLevelKeyFragment)
+		require.NoError(t, fragments[i].UnmarshalBinary(data[i]))
+		fragments[i].Key.Capsule = encryptedKey.First
+		fragments[i].Key.CapsuleAttributes = encryptedKey.CapsuleAttributes
+	}
+	return fragments
+}
+
+func TestThresholdReEncryption(t *testing.T) {
+	scheme := pre.NewPreScheme()
+	alice := testutils.GenerateRandomKeyPair(scheme.Params.G2, scheme.Params.Z)
+	bob := testutils.GenerateRandomKeyPair(scheme.Params.G2, scheme.Params.Z)
+	reKey := scheme.Client.GenerateReEncryptionKey(alice.SecretKey, bob.PublicKey)
+
+	message := []byte("three of five")
+	encryptedKey, encryptedMessage, err := scheme.Client.EncryptTo(alice.PublicKey, message, &types.EncryptOptions{Context: []byte("record-1")})
+	require.NoError(t, err)
+
+	// every proxy re-encrypts concurrently
+	proxies := newThresholdProxies(t, scheme, alice, bob, 3, 5)
+	results := make([][]byte, len(proxies))
+	errs := make([]error, len(proxies))
+	var wg sync.WaitGroup
+	for i, proxy := range proxies {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = proxy.reEncrypt(encryptedKey)
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		require.NoError(t, err)
+	}
+	fragments := decodeKeyFragments(t, encryptedKey, results)
+
+	expected := scheme.Proxy.ReEncryption(encryptedKey, reKey)
+	for _, subset := range [][]int{{0, 1, 2}, {4, 2, 0}, {1, 3, 4}, {0, 1, 2, 3, 4}} {
+		selected := make([]*types.FirstLevelKeyFragment, len(subset))
+		for i, j := range subset {
+			selected[i] = fragments[j]
+		}
+
+		firstLevelKey, err := pre.CombineFragments(selected, 3)
+		require.NoError(t, err)
+		require.True(t, expected.First.Equal(firstLevelKey.First), "subset %v", subset)
+
+		decrypted, err := scheme.Client.DecryptFirstLevelBytes(firstLevelKey, encryptedMessage, bob.SecretKey)
+		require.NoError(t, err)
+		require.Equal(t, message, decrypted)
+	}
+
+	t.Run("below threshold", func(t *testing.T) {
+		_, err := pre.CombineFragments(fragments[:2], 3)
+		require.ErrorIs(t, err, types.ErrInvalidFragment)
+
+		// the threshold comes from the delegator, proxies cannot lower it
+		forged := []*types.FirstLevelKeyFragment{
+			{Index: fragments[0].Index, Threshold: 2, Key: fragments[0].Key},
+			{Index: fragments[1].Index, Threshold: 2, Key: fragments[1].Key},
+		}
+		_, err = pre.CombineFragments(forged, 3)
+		require.ErrorIs(t, err, types.ErrInvalidFragment)
+	})
+
+	t.Run("invalid fragments", func(t *testing.T) {
+		_, err := pre.CombineFragments(nil, 3)
+		require.ErrorIs(t, err, types.ErrInvalidFragment)
+
+		_, err = pre.CombineFragments([]*types.FirstLevelKeyFragment{fragments[0], fragments[0], fragments[1]}, 3)
+		require.ErrorIs(t, err, types.ErrInvalidFragment)
+
+		mixed := []*types.FirstLevelKeyFragment{fragments[0], fragments[1], {Index: 3, Threshold: 2, Key: fragments[2].Key}}
+		_, err = pre.CombineFragments(mixed, 3)
+		require.ErrorIs(t, err, types.ErrInvalidFragment)
+
+		otherKey, _, err := scheme.Client.EncryptTo(alice.PublicKey, message, nil)
+		require.NoError(t, err)
+		data, err := proxies[2].reEncrypt(otherKey)
+		require.NoError(t, err)
+		other := decodeKeyFragments(t, otherKey, [][]byte{data})
+		_, err = pre.CombineFragments([]*types.FirstLevelKeyFragment{fragments[0], fragments[1], other[0]}, 3)
+		require.ErrorIs(t, err, types.ErrInvalidFragment)
+
+		_, err = scheme.Proxy.(types.FragmentProxy).ReEncryptFragment(encryptedKey, &types.ReKeyFragment{Index: 1, Threshold: 1})
+		require.ErrorIs(t, err, types.ErrInvalidFragment)
+	})
+
+	t.Run("invalid split", func(t *testing.T) {
+		for _, split := range [][2]int{{0, 3}, {4, 3}, {2, 1 << 16}} {
+			_, err := scheme.Client.(types.FragmentClient).GenerateReKeyFragments(alice.SecretKey, bob.PublicKey, split[0], split[1])
+			require.ErrorIs(t, err, types.ErrInvalidFragment)
+		}
+		_, err := scheme.Client.(types.FragmentClient).GenerateReKeyFragments(nil, bob.PublicKey, 2, 3)
+		require.ErrorIs(t, err, types.ErrInvalidKey)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err = scheme.Client.(types.FragmentClient).GenerateReKeyFragmentsContext(ctx, alice.SecretKey, bob.PublicKey, 2, 3)
+		require.ErrorIs(t, err, context.Canceled)
+	})
+
+	t.Run("serialization", func(t *testing.T) {
+		data := results[0]
+		require.Len(t, data, types.FirstLevelKeyFragmentSize)
+
+		zeroIndex := append([]byte(nil), data...)
+		zeroIndex[0], zeroIndex[1] = 0, 0
+		require.ErrorIs(t, new(types.FirstLevelKeyFragment).UnmarshalBinary(zeroIndex), types.ErrInvalidFragment)
+		require.ErrorIs(t, new(types.FirstLevelKeyFragment).UnmarshalBinary(data[1:]), types.ErrInvalidFragment)
+
+		reKeyFragment := append([]byte(nil), proxies[0].fragment...)
+		require.ErrorIs(t, new(types.ReKeyFragment).UnmarshalBinary(reKeyFragment[:10]), types.ErrInvalidFragment)
+		reKeyFragment[2], reKeyFragment[3] = 0, 0
+		require.ErrorIs(t, new(types.ReKeyFragment).UnmarshalBinary(reKeyFragment), types.ErrInvalidFragment)
+	})
+}
+
+func TestThresholdReEncryptionCCA(t *testing.T) {
+	scheme := pre.NewPreScheme(pre.WithCCA())
+	alice := testutils.GenerateRandomKeyPair(scheme.Params.G2, scheme.Params.Z)
+	bob := testutils.GenerateRandomKeyPair(scheme.Params.G2, scheme.Params.Z)
+
+	message := []byte("two of two")
+	encryptedKey, encryptedMessage, err := scheme.Client.EncryptTo(alice.PublicKey, message, nil)
+	require.NoError(t, err)
+
+	fragments, err := scheme.Client.(types.FragmentClient).GenerateReKeyFragments(alice.SecretKey, bob.PublicKey, 2, 2)
+	require.NoError(t, err)
+	keyFragments := make([]*types.FirstLevelKeyFragment, len(fragments))
+	for i, fragment := range fragments {
+		keyFragments[i], err = scheme.Proxy.(types.FragmentProxy).ReEncryptFragment(encryptedKey, fragment)
+		require.NoError(t, err)
+	}
+
+	// the attributes of the second-level key are carried over, so the decryption checks pass
+	firstLevelKey, err := pre.CombineFragments(keyFragments, 2)
+	require.NoError(t, err)
+	decrypted, err := scheme.Client.DecryptFirstLevelBytes(firstLevelKey, encryptedMessage, bob.SecretKey)
+	require.NoError(t, err)
+	require.Equal(t, message, decrypted)
+}
+
+func TestThresholdReEncryptionProofs(t *testing.T) {
+	scheme := pre.NewPreScheme()
+	client := scheme.Client.(types.FragmentClient)
+	proxy := scheme.Proxy.(types.FragmentProxy)
+	alice := testutils.GenerateRandomKeyPair(scheme.Params.G2, scheme.Params.Z)
+	bob := testutils.GenerateRandomKeyPair(scheme.Params.G2, scheme.Params.Z)
+
+	message := []byte("two of four")
+	encryptedKey, encryptedMessage, err := scheme.Client.EncryptTo(alice.PublicKey, message, nil)
+	require.NoError(t, err)
+
+	// the delegator publishes the threshold and the commitments along with the fragments
+	reKeyFragments, err := client.GenerateReKeyFragments(alice.SecretKey, bob.PublicKey, 2, 4)
+	require.NoError(t, err)
+	commitments := make(map[uint16]*bn254.GT, len(reKeyFragments))
+	for _, fragment := range reKeyFragments {
+		commitments[fragment.Index], err = pre.ReKeyCommitment(fragment.Key)
+		require.NoError(t, err)
+	}
+
+	fragments := make([]*types.FirstLevelKeyFragment, len(reKeyFragments))
+	proofs := make([]*types.ReEncryptionProof, len(reKeyFragments))
+	for i, fragment := range reKeyFragments {
+		fragments[i], proofs[i], err = proxy.ReEncryptFragmentWithProof(encryptedKey, fragment)
+		require.NoError(t, err)
+		require.NoError(t, pre.VerifyFragment(commitments[fragments[i].Index], fragments[i], proofs[i]))
+	}
+
+	// the third proxy misbehaves
+	fragments[2] = &types.FirstLevelKeyFragment{
+		Index:     fragments[2].Index,
+		Threshold: fragments[2].Threshold,
+		Key:       &types.FirstLevelSymmetricKey{First: testutils.GenerateRandomGTElem(), Second: encryptedKey.Second, Capsule: encryptedKey.First},
+	}
+	_, err = pre.CombineFragments(fragments, 2)
+	require.ErrorIs(t, err, types.ErrInvalidFragment)
+
+	var verified []*types.FirstLevelKeyFragment
+	for i, fragment := range fragments {
+		if err := pre.VerifyFragment(commitments[fragment.Index], fragment, proofs[i]); err != nil {
+			require.ErrorIs(t, err, types.ErrInvalidProof)
+			require.Equal(t, 2, i)
+			continue
+		}
+		verified = append(verified, fragment)
+	}
+	require.Len(t, verified, 3)
+
+	firstLevelKey, err := pre.CombineFragments(verified, 2)
+	require.NoError(t, err)
+	decrypted, err := scheme.Client.DecryptFirstLevelBytes(firstLevelKey, encryptedMessage, bob.SecretKey)
+	require.NoError(t, err)
+	require.Equal(t, message, decrypted)
+
+	t.Run("proof of another fragment", func(t *testing.T) {
+		require.ErrorIs(t, pre.VerifyFragment(commitments[fragments[1].Index], fragments[0], proofs[0]), types.ErrInvalidProof)
+		require.ErrorIs(t, pre.VerifyFragment(commitments[fragments[0].Index], fragments[0], proofs[1]), types.ErrInvalidProof)
+	})
+}
@@ -0,0 +1,123 @@
+package types
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// Attribute types of the encoding of CapsuleAttributes
+const (
+	attrOwner   byte = 1
+	attrContext byte = 2
+	attrProof   byte = 3
+	attrTag     byte = 4
+	attrEpoch   byte = 5
+)
+
+// CapsuleAttributes are the attributes of an encrypted key besides its group elements.
+// They are set at encryption and carried over unchanged by re-encryption:
+//
+//   - Owner is checked against the key of the decryptor of second-level keys
+//   - Context is authenticated together with the encrypted message
+//   - Tag and Epoch are needed by the owner to decrypt a conditional key, see
+//     EncryptOptions
+//   - Proof is checked by pre.CheckCapsule
+//
+// The bare encoding of keys (ToBytes, UnmarshalBinary and the layout of pre-ts) only holds
+// the group elements. Attributes are encoded along with the key by an Envelope, whose
+// recipients hold first-level keys as well; MarshalBinary refuses keys with attributes
+// rather than drop them, and keys decoded from the bare encoding have none.
+type CapsuleAttributes struct {
+	Owner   []byte        `json:"owner,omitempty"`   // Fingerprint of the public key of the data owner
+	Context []byte        `json:"context,omitempty"` // Caller-supplied context authenticated with the message
+	Tag     []byte        `json:"tag,omitempty"`     // Condition of the re-encryption keys that re-encrypt the key, optional
+	Epoch   []byte        `json:"epoch,omitempty"`   // Epoch of the re-encryption keys that re-encrypt the key, optional
+	Proof   *CapsuleProof `json:"proof,omitempty"`   // Proof of knowledge of the scalar behind the capsule, optional
+}
+
+// IsZero reports whether no attribute is set
+func (a *CapsuleAttributes) IsZero() bool {
+	return a == nil || len(a.Owner) == 0 && len(a.Context) == 0 && len(a.Tag) == 0 && len(a.Epoch) == 0 && a.Proof == nil
+}
+
+// MarshalBinary encodes the attributes that are set as entries of type (1) || length (2) ||
+// value, in the order of their types
+func (a *CapsuleAttributes) MarshalBinary() ([]byte, error) {
+	var proof []byte
+	if a.Proof != nil {
+		var err error
+		if proof, err = a.Proof.MarshalBinary(); err != nil {
+			return nil, err
+		}
+	}
+
+	var data []byte
+	for _, attr := range []struct {
+		kind  byte
+		value []byte
+	}{
+		{attrOwner, a.Owner},
+		{attrContext, a.Context},
+		{attrProof, proof},
+		{attrTag, a.Tag},
+		{attrEpoch, a.Epoch},
+	} {
+		if len(attr.value) == 0 {
+			continue
+		}
+		if len(attr.value) > math.MaxUint16 {
+			return nil, fmt.Errorf("%w: attribute %d is too long", ErrMalformedCapsule, attr.kind)
+		}
+		data = append(data, attr.kind)
+		data = binary.BigEndian.AppendUint16(data, uint16(len(attr.value))) // #nosec G115 -- checked above
+		data = append(data, attr.value...)
+	}
+	return data, nil
+}
+
+// UnmarshalBinary decodes the entries written by MarshalBinary. Every attribute changes how
+// the key is decrypted or checked, so entries of unknown types are rejected rather than
+// skipped, as are repeated ones.
+func (a *CapsuleAttributes) UnmarshalBinary(data []byte) error {
+	var decoded CapsuleAttributes
+	seen := make(map[byte]bool)
+	for len(data) > 0 {
+		if len(data) < 3 {
+			return fmt.Errorf("%w: attribute truncated", ErrMalformedCapsule)
+		}
+		kind := data[0]
+		length := int(binary.BigEndian.Uint16(data[1:3]))
+		if len(data)-3 < length {
+			return fmt.Errorf("%w: attribute truncated", ErrMalformedCapsule)
+		}
+		value := append([]byte(nil), data[3:3+length]...)
+		data = data[3+length:]
+		if seen[kind] {
+			return fmt.Errorf("%w: attribute %d repeated", ErrMalformedCapsule, kind)
+		}
+		seen[kind] = true
+
+		switch kind {
+		case attrOwner:
+			decoded.Owner = value
+		case attrContext:
+			decoded.Context = value
+		case attrProof:
+			proof := new(CapsuleProof)
+			if err := proof.UnmarshalBinary(value); err != nil {
+				return err
+			}
+			decoded.Proof = proof
+		case attrTag:
+			decoded.Tag = value
+		case attrEpoch:
+			decoded.Epoch = value
+		default:
+			return fmt.Errorf("%w: unknown attribute %d", ErrMalformedCapsule, kind)
+		}
+	}
+
+	*a = decoded
+	return nil
+}
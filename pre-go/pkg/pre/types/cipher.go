@@ -8,14 +8,34 @@ import (
 	"github.com/consensys/gnark-crypto/ecc/bn254"
 )
 
+const (
+	// FirstLevelSymmetricKeySize is the size of FirstLevelSymmetricKey.ToBytes: two GT elements
+	FirstLevelSymmetricKeySize = 2 * bn254.SizeOfGT
+	// SecondLevelSymmetricKeySize is the size of SecondLevelSymmetricKey.ToBytes: a compressed
+	// G1 point followed by a GT element
+	SecondLevelSymmetricKeySize = bn254.SizeOfG1AffineCompressed + bn254.SizeOfGT
+)
+
+// FirstLevelSymmetricKey is a re-encrypted symmetric key, decryptable by the delegatee.
+// Capsule and the attributes are those of the second-level key it was re-encrypted from;
+// like the attributes, Capsule is only encoded by an Envelope, as the capsule of the
+// envelope its recipients were re-encrypted from.
 type FirstLevelSymmetricKey struct {
 	First  *bn254.GT `json:"first"`  // First component of the key in GT group
 	Second *bn254.GT `json:"second"` // Second component of the key in GT group
+
+	Capsule *bn254.G1Affine `json:"capsule,omitempty"` // First component of the second-level key, checked by the CCA-secure client
+
+	CapsuleAttributes
 }
 
+// SecondLevelSymmetricKey is a symmetric key encrypted under the key of the data owner,
+// along with its attributes
 type SecondLevelSymmetricKey struct {
 	First  *bn254.G1Affine `json:"first"`  // First component of the key in G1 group
 	Second *bn254.GT       `json:"second"` // Second component of the key in GT group
+
+	CapsuleAttributes
 }
 
 // ToBytes serializes FirstLevelSymmetricKey to bytes
@@ -36,27 +56,51 @@ func (k *FirstLevelSymmetricKey) ToBytes() []byte {
 	return buf.Bytes()
 }
 
-func (k *FirstLevelSymmetricKey) FromBytes(data []byte) *FirstLevelSymmetricKey {
-	if k == nil {
-		return nil
+// MarshalBinary is ToBytes for use with encoding.BinaryMarshaler. It returns
+// ErrAttributesNeedEnvelope for keys with a Capsule or attributes, which ToBytes drops.
+func (k *FirstLevelSymmetricKey) MarshalBinary() ([]byte, error) {
+	if k == nil || k.First == nil || k.Second == nil {
+		return nil, fmt.Errorf("%w: missing group element", ErrMalformedCapsule)
+	}
+	if k.Capsule != nil || !k.CapsuleAttributes.IsZero() {
+		return nil, ErrAttributesNeedEnvelope
 	}
+	return k.ToBytes(), nil
+}
 
-	if len(data) == 0 {
-		return nil
+// UnmarshalBinary parses the 768-byte output of ToBytes. First must be in the subgroup of
+// order r and must not be the identity; Second must be invertible, see decodeMaskedKey.
+// Capsule and the attributes are left untouched.
+func (k *FirstLevelSymmetricKey) UnmarshalBinary(data []byte) error {
+	if k == nil {
+		return fmt.Errorf("nil receiver")
+	}
+	if len(data) != FirstLevelSymmetricKeySize {
+		return fmt.Errorf("%w: invalid data length for FirstLevelSymmetricKey: expected %d, got %d",
+			ErrMalformedCapsule, FirstLevelSymmetricKeySize, len(data))
 	}
 
-	k.First = new(bn254.GT)
-	err := k.First.SetBytes(data[:384])
+	first, err := decodeCapsuleGT(data[:bn254.SizeOfGT])
 	if err != nil {
-		panic(err)
+		return err
 	}
-
-	k.Second = new(bn254.GT)
-	err = k.Second.SetBytes(data[384:])
+	second, err := decodeMaskedKey(data[bn254.SizeOfGT:])
 	if err != nil {
-		panic(err)
+		return err
 	}
 
+	k.First, k.Second = first, second
+	return nil
+}
+
+// FromBytes parses the output of ToBytes into k and returns k, or nil if data is not a
+// valid key.
+//
+// Deprecated: FromBytes cannot report why decoding failed; use UnmarshalBinary.
+func (k *FirstLevelSymmetricKey) FromBytes(data []byte) *FirstLevelSymmetricKey {
+	if k == nil || k.UnmarshalBinary(data) != nil {
+		return nil
+	}
 	return k
 }
 
@@ -78,30 +122,96 @@ func (k *SecondLevelSymmetricKey) ToBytes() []byte {
 	return buf.Bytes()
 }
 
-func (k *SecondLevelSymmetricKey) FromBytes(data []byte) *SecondLevelSymmetricKey {
+// MarshalBinary is ToBytes for use with encoding.BinaryMarshaler. It returns
+// ErrAttributesNeedEnvelope for keys with attributes, which ToBytes drops.
+func (k *SecondLevelSymmetricKey) MarshalBinary() ([]byte, error) {
+	if k == nil || k.First == nil || k.Second == nil {
+		return nil, fmt.Errorf("%w: missing group element", ErrMalformedCapsule)
+	}
+	if !k.CapsuleAttributes.IsZero() {
+		return nil, ErrAttributesNeedEnvelope
+	}
+	return k.ToBytes(), nil
+}
+
+// UnmarshalBinary parses a G1 point followed by a GT element. The point may be compressed
+// (416 bytes in total, the output of ToBytes) or uncompressed (448 bytes, the layout of
+// pre-ts). The point must be in G1 and not at infinity, and the GT element must be
+// invertible, see decodeMaskedKey. The attributes are left untouched.
+func (k *SecondLevelSymmetricKey) UnmarshalBinary(data []byte) error {
 	if k == nil {
-		return nil
+		return fmt.Errorf("nil receiver")
 	}
 
-	if len(data) == 0 {
-		return nil
+	var pointSize int
+	switch len(data) {
+	case SecondLevelSymmetricKeySize:
+		pointSize = bn254.SizeOfG1AffineCompressed
+	case bn254.SizeOfG1AffineUncompressed + bn254.SizeOfGT:
+		pointSize = bn254.SizeOfG1AffineUncompressed
+	default:
+		return fmt.Errorf("%w: invalid data length for SecondLevelSymmetricKey: expected %d or %d, got %d",
+			ErrMalformedCapsule, SecondLevelSymmetricKeySize, bn254.SizeOfG1AffineUncompressed+bn254.SizeOfGT, len(data))
 	}
 
-	k.First = new(bn254.G1Affine)
-	_, err := k.First.SetBytes(data[:32])
-	if err != nil {
-		panic(err)
+	// SetBytes checks that the point is on the curve and in the subgroup
+	first := new(bn254.G1Affine)
+	if _, err := first.SetBytes(data[:pointSize]); err != nil {
+		return fmt.Errorf("%w: invalid G1 point: %v", ErrMalformedCapsule, err)
+	}
+	if first.IsInfinity() {
+		return fmt.Errorf("%w: G1 point at infinity", ErrMalformedCapsule)
 	}
 
-	k.Second = new(bn254.GT)
-	err = k.Second.SetBytes(data[32:])
+	second, err := decodeMaskedKey(data[pointSize:])
 	if err != nil {
-		panic(err)
+		return err
 	}
 
+	k.First, k.Second = first, second
+	return nil
+}
+
+// FromBytes parses the output of ToBytes into k and returns k, or nil if data is not a
+// valid key.
+//
+// Deprecated: FromBytes cannot report why decoding failed; use UnmarshalBinary.
+func (k *SecondLevelSymmetricKey) FromBytes(data []byte) *SecondLevelSymmetricKey {
+	if k == nil || k.UnmarshalBinary(data) != nil {
+		return nil
+	}
 	return k
 }
 
+// decodeCapsuleGT parses a GT element of an encrypted key
+func decodeCapsuleGT(data []byte) (*bn254.GT, error) {
+	gt := new(bn254.GT)
+	if err := gt.SetBytes(data); err != nil {
+		return nil, fmt.Errorf("%w: invalid GT element: %v", ErrMalformedCapsule, err)
+	}
+	if !gt.IsInSubGroup() {
+		return nil, fmt.Errorf("%w: GT element is not in the subgroup", ErrMalformedCapsule)
+	}
+	if gt.IsOne() {
+		return nil, fmt.Errorf("%w: GT element is the identity", ErrMalformedCapsule)
+	}
+	return gt, nil
+}
+
+// decodeMaskedKey parses the GT component that carries the masked symmetric key. The
+// symmetric key is a random element of Fp12 rather than of the subgroup, here and in
+// pre-ts, so the product is only required to be a canonical, invertible field element.
+func decodeMaskedKey(data []byte) (*bn254.GT, error) {
+	gt := new(bn254.GT)
+	if err := gt.SetBytes(data); err != nil {
+		return nil, fmt.Errorf("%w: invalid GT element: %v", ErrMalformedCapsule, err)
+	}
+	if gt.IsZero() {
+		return nil, fmt.Errorf("%w: GT element is zero", ErrMalformedCapsule)
+	}
+	return gt, nil
+}
+
 // String returns hex encoded string representation
 func (k *FirstLevelSymmetricKey) String() string {
 	if k == nil {
@@ -124,12 +234,7 @@ func (k *FirstLevelSymmetricKey) FromString(s string) error {
 		return fmt.Errorf("failed to decode hex string: %w", err)
 	}
 
-	if len(data) != 768 { // 384 bytes for each GT element
-		return fmt.Errorf("invalid data length for FirstLevelSymmetricKey: expected 768, got %d", len(data))
-	}
-
-	k.FromBytes(data)
-	return nil
+	return k.UnmarshalBinary(data)
 }
 
 // String returns hex encoded string representation
@@ -154,10 +259,5 @@ func (k *SecondLevelSymmetricKey) FromString(s string) error {
 		return fmt.Errorf("failed to decode hex string: %w", err)
 	}
 
-	if len(data) != 416 {
-		return fmt.Errorf("invalid data length for SecondLevelSymmetricKey: expected 416, got %d", len(data))
-	}
-
-	k.FromBytes(data)
-	return nil
+	return k.UnmarshalBinary(data)
 }
@@ -1,8 +1,12 @@
 package types_test
 
 import (
+	"encoding/base64"
+	"os"
+	"strings"
 	"testing"
 
+	"github.com/consensys/gnark-crypto/ecc/bn254"
 	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre/types"
 	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/testutils"
 	"github.com/stretchr/testify/require"
@@ -61,3 +65,127 @@ func TestCipherErrors(t *testing.T) {
 		require.Contains(t, err.Error(), "invalid data length")
 	})
 }
+
+func TestUnmarshalBinary(t *testing.T) {
+	secondLevel := &types.SecondLevelSymmetricKey{
+		First:  testutils.GenerateRandomG1Elem(),
+		Second: testutils.GenerateRandomGTElem(),
+	}
+	firstLevel := &types.FirstLevelSymmetricKey{
+		First:  testutils.GenerateRandomGTElem(),
+		Second: testutils.GenerateRandomGTElem(),
+	}
+
+	t.Run("compressed second-level key", func(t *testing.T) {
+		decoded := new(types.SecondLevelSymmetricKey)
+		require.NoError(t, decoded.UnmarshalBinary(secondLevel.ToBytes()))
+		require.Equal(t, secondLevel, decoded)
+	})
+
+	t.Run("uncompressed second-level key written by pre-ts", func(t *testing.T) {
+		first, err := os.ReadFile("../../../../testdata/second_encrypted_key_first.txt")
+		require.NoError(t, err)
+		second, err := os.ReadFile("../../../../testdata/second_encrypted_key_second.txt")
+		require.NoError(t, err)
+		firstBytes, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(first)))
+		require.NoError(t, err)
+		secondBytes, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(second)))
+		require.NoError(t, err)
+
+		decoded := new(types.SecondLevelSymmetricKey)
+		require.NoError(t, decoded.UnmarshalBinary(append(firstBytes, secondBytes...)))
+		raw := decoded.First.RawBytes()
+		require.Equal(t, firstBytes, raw[:])
+	})
+
+	t.Run("first-level key", func(t *testing.T) {
+		decoded := new(types.FirstLevelSymmetricKey)
+		require.NoError(t, decoded.UnmarshalBinary(firstLevel.ToBytes()))
+		require.Equal(t, firstLevel, decoded)
+	})
+
+	t.Run("G1 point at infinity", func(t *testing.T) {
+		infinity := &types.SecondLevelSymmetricKey{First: new(bn254.G1Affine), Second: secondLevel.Second}
+		err := new(types.SecondLevelSymmetricKey).UnmarshalBinary(infinity.ToBytes())
+		require.ErrorIs(t, err, types.ErrMalformedCapsule)
+	})
+
+	t.Run("GT identity", func(t *testing.T) {
+		var one bn254.GT
+		one.SetOne()
+		identity := &types.FirstLevelSymmetricKey{First: &one, Second: firstLevel.Second}
+		err := new(types.FirstLevelSymmetricKey).UnmarshalBinary(identity.ToBytes())
+		require.ErrorIs(t, err, types.ErrMalformedCapsule)
+	})
+
+	t.Run("GT element not in the subgroup", func(t *testing.T) {
+		data := firstLevel.ToBytes()
+		data[100] ^= 0x01
+		err := new(types.FirstLevelSymmetricKey).UnmarshalBinary(data)
+		require.ErrorIs(t, err, types.ErrMalformedCapsule)
+	})
+
+	t.Run("masked key is zero", func(t *testing.T) {
+		zero := &types.SecondLevelSymmetricKey{First: secondLevel.First, Second: new(bn254.GT)}
+		err := new(types.SecondLevelSymmetricKey).UnmarshalBinary(zero.ToBytes())
+		require.ErrorIs(t, err, types.ErrMalformedCapsule)
+	})
+
+	t.Run("invalid length", func(t *testing.T) {
+		require.ErrorIs(t, new(types.FirstLevelSymmetricKey).UnmarshalBinary(nil), types.ErrMalformedCapsule)
+		require.ErrorIs(t, new(types.SecondLevelSymmetricKey).UnmarshalBinary(make([]byte, 100)), types.ErrMalformedCapsule)
+		require.Nil(t, new(types.FirstLevelSymmetricKey).FromBytes(make([]byte, 100)))
+		require.Nil(t, new(types.SecondLevelSymmetricKey).FromBytes(make([]byte, 100)))
+	})
+}
+
+func FuzzFirstLevelSymmetricKeyUnmarshalBinary(f *testing.F) {
+	valid := (&types.FirstLevelSymmetricKey{
+		First:  testutils.GenerateRandomGTElem(),
+		Second: testutils.GenerateRandomGTElem(),
+	}).ToBytes()
+	f.Add(valid)
+	f.Add(valid[:384])
+	f.Add(make([]byte, 768))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		key := new(types.FirstLevelSymmetricKey)
+		if err := key.UnmarshalBinary(data); err != nil {
+			require.ErrorIs(t, err, types.ErrMalformedCapsule)
+			require.Nil(t, new(types.FirstLevelSymmetricKey).FromBytes(data))
+			return
+		}
+		require.True(t, key.First.IsInSubGroup() && !key.First.IsOne())
+		require.False(t, key.Second.IsZero())
+		require.Equal(t, data, key.ToBytes())
+	})
+}
+
+func FuzzSecondLevelSymmetricKeyUnmarshalBinary(f *testing.F) {
+	key := &types.SecondLevelSymmetricKey{
+		First:  testutils.GenerateRandomG1Elem(),
+		Second: testutils.GenerateRandomGTElem(),
+	}
+	raw := key.First.RawBytes()
+	second := key.Second.Bytes()
+	f.Add(key.ToBytes())
+	f.Add(append(raw[:], second[:]...))
+	f.Add(make([]byte, 416))
+	f.Add(make([]byte, 448))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		key := new(types.SecondLevelSymmetricKey)
+		if err := key.UnmarshalBinary(data); err != nil {
+			require.ErrorIs(t, err, types.ErrMalformedCapsule)
+			require.Nil(t, new(types.SecondLevelSymmetricKey).FromBytes(data))
+			return
+		}
+		require.True(t, key.First.IsInSubGroup() && !key.First.IsInfinity())
+		require.False(t, key.Second.IsZero())
+
+		// decoding the canonical encoding gives the same key back
+		decoded := new(types.SecondLevelSymmetricKey)
+		require.NoError(t, decoded.UnmarshalBinary(key.ToBytes()))
+		require.Equal(t, key, decoded)
+	})
+}
@@ -0,0 +1,494 @@
+package types
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+)
+
+// Canonical binary encodings of the key types. They are byte-for-byte identical to the
+// toBytes methods of pre-ts, so keys can be exchanged between the two SDKs.
+//
+//	PublicKey:       GT element (384) || G2 point, uncompressed (128)          = 512 bytes
+//	SecretKey:       First (32, big-endian) || Second (32, big-endian)          =  64 bytes
+//	KeyPair:         PublicKey (512) || SecretKey (64)                          = 576 bytes
+//	ReEncryptionKey: G2 point, uncompressed (128)                               = 128 bytes
+//
+// The GT element is the 12 Fp coefficients (C0.B0.A0 first) of 32 bytes each and the G2 point
+// is X.A1 || X.A0 || Y.A1 || Y.A0, as written by gnark-crypto's Bytes and RawBytes.
+// Decoding accepts the 64-byte compressed form of G2 points as well.
+const (
+	PublicKeySize       = bn254.SizeOfGT + bn254.SizeOfG2AffineUncompressed
+	SecretKeySize       = 2 * fr.Bytes
+	KeyPairSize         = PublicKeySize + SecretKeySize
+	ReEncryptionKeySize = bn254.SizeOfG2AffineUncompressed
+)
+
+// PEM block types of the armored text format
+const (
+	PEMTypePublicKey       = "PRE PUBLIC KEY"
+	PEMTypeSecretKey       = "PRE SECRET KEY"
+	PEMTypeKeyPair         = "PRE KEY PAIR"
+	PEMTypeReEncryptionKey = "PRE RE-ENCRYPTION KEY"
+)
+
+// publicKeyJSON is the JSON form of a PublicKey: both components base64 encoded
+type publicKeyJSON struct {
+	First  string `json:"First"`
+	Second string `json:"Second"`
+}
+
+// secretKeyJSON is the JSON form of a SecretKey: both scalars hex encoded
+type secretKeyJSON struct {
+	First  string `json:"First"`
+	Second string `json:"Second"`
+}
+
+// keyPairJSON is the JSON form of a KeyPair. It has no methods, so encoding/json does not
+// fall back to KeyPair.MarshalText.
+type keyPairJSON struct {
+	PublicKey *PublicKey `json:"PublicKey"`
+	SecretKey *SecretKey `json:"SecretKey"`
+}
+
+// MarshalBinary encodes the public key in its canonical 512-byte layout
+func (pk *PublicKey) MarshalBinary() ([]byte, error) {
+	if pk == nil || pk.First == nil || pk.Second == nil {
+		return nil, fmt.Errorf("%w: incomplete public key", ErrInvalidKey)
+	}
+
+	first := pk.First.Bytes()
+	second := pk.Second.RawBytes()
+
+	data := make([]byte, 0, PublicKeySize)
+	data = append(data, first[:]...)
+	return append(data, second[:]...), nil
+}
+
+// UnmarshalBinary decodes a public key written by MarshalBinary. The GT element must be
+// in the subgroup of order r and must not be the identity; the G2 point must be on the curve
+// and in the subgroup.
+func (pk *PublicKey) UnmarshalBinary(data []byte) error {
+	if pk == nil {
+		return fmt.Errorf("nil receiver")
+	}
+	if len(data) != PublicKeySize && len(data) != bn254.SizeOfGT+bn254.SizeOfG2AffineCompressed {
+		return fmt.Errorf("%w: public key must be %d bytes, got %d", ErrInvalidKey, PublicKeySize, len(data))
+	}
+
+	first, err := decodeGT(data[:bn254.SizeOfGT])
+	if err != nil {
+		return err
+	}
+	if first.IsOne() {
+		return fmt.Errorf("%w: public key is the identity", ErrInvalidKey)
+	}
+
+	second, err := decodeG2(data[bn254.SizeOfGT:])
+	if err != nil {
+		return err
+	}
+
+	pk.First, pk.Second = first, second
+	return nil
+}
+
+// MarshalText encodes the public key as standard base64 of its binary form
+func (pk *PublicKey) MarshalText() ([]byte, error) {
+	return marshalBase64(pk.MarshalBinary())
+}
+
+// UnmarshalText decodes a public key written by MarshalText
+func (pk *PublicKey) UnmarshalText(text []byte) error {
+	data, err := unmarshalBase64(text)
+	if err != nil {
+		return err
+	}
+	return pk.UnmarshalBinary(data)
+}
+
+// MarshalJSON encodes the public key as {"First": base64 GT, "Second": base64 G2},
+// the format of the keypair files in testdata
+func (pk *PublicKey) MarshalJSON() ([]byte, error) {
+	data, err := pk.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(publicKeyJSON{
+		First:  base64.StdEncoding.EncodeToString(data[:bn254.SizeOfGT]),
+		Second: base64.StdEncoding.EncodeToString(data[bn254.SizeOfGT:]),
+	})
+}
+
+// UnmarshalJSON decodes a public key written by MarshalJSON
+func (pk *PublicKey) UnmarshalJSON(data []byte) error {
+	var encoded publicKeyJSON
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return err
+	}
+
+	first, err := base64.StdEncoding.DecodeString(encoded.First)
+	if err != nil {
+		return fmt.Errorf("%w: invalid base64 GT element: %v", ErrInvalidKey, err)
+	}
+	second, err := base64.StdEncoding.DecodeString(encoded.Second)
+	if err != nil {
+		return fmt.Errorf("%w: invalid base64 G2 point: %v", ErrInvalidKey, err)
+	}
+	if len(first) != bn254.SizeOfGT {
+		return fmt.Errorf("%w: GT element must be %d bytes, got %d", ErrInvalidKey, bn254.SizeOfGT, len(first))
+	}
+
+	return pk.UnmarshalBinary(append(first, second...))
+}
+
+// MarshalPEM encodes the public key as a PEM block of type PEMTypePublicKey
+func (pk *PublicKey) MarshalPEM() ([]byte, error) {
+	data, err := pk.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return marshalPEM(PEMTypePublicKey, data), nil
+}
+
+// UnmarshalPEM decodes a public key written by MarshalPEM
+func (pk *PublicKey) UnmarshalPEM(data []byte) error {
+	block, err := unmarshalPEM(PEMTypePublicKey, data)
+	if err != nil {
+		return err
+	}
+	return pk.UnmarshalBinary(block)
+}
+
+// MarshalBinary encodes the secret key in its canonical 64-byte layout
+func (sk *SecretKey) MarshalBinary() ([]byte, error) {
+	if sk == nil || sk.First == nil || sk.Second == nil {
+		return nil, fmt.Errorf("%w: incomplete secret key", ErrInvalidKey)
+	}
+	if !isScalar(sk.First) || !isScalar(sk.Second) {
+		return nil, fmt.Errorf("%w: secret key is out of range", ErrInvalidKey)
+	}
+
+	data := make([]byte, SecretKeySize)
+	sk.First.FillBytes(data[:fr.Bytes])
+	sk.Second.FillBytes(data[fr.Bytes:])
+	return data, nil
+}
+
+// UnmarshalBinary decodes a secret key written by MarshalBinary. Both scalars must be
+// in [1, r-1].
+func (sk *SecretKey) UnmarshalBinary(data []byte) error {
+	if sk == nil {
+		return fmt.Errorf("nil receiver")
+	}
+	if len(data) != SecretKeySize {
+		return fmt.Errorf("%w: secret key must be %d bytes, got %d", ErrInvalidKey, SecretKeySize, len(data))
+	}
+
+	first := new(big.Int).SetBytes(data[:fr.Bytes])
+	second := new(big.Int).SetBytes(data[fr.Bytes:])
+	if !isScalar(first) || !isScalar(second) {
+		return fmt.Errorf("%w: secret key is out of range", ErrInvalidKey)
+	}
+
+	sk.First, sk.Second = first, second
+	return nil
+}
+
+// MarshalText encodes the secret key as standard base64 of its binary form
+func (sk *SecretKey) MarshalText() ([]byte, error) {
+	return marshalBase64(sk.MarshalBinary())
+}
+
+// UnmarshalText decodes a secret key written by MarshalText
+func (sk *SecretKey) UnmarshalText(text []byte) error {
+	data, err := unmarshalBase64(text)
+	if err != nil {
+		return err
+	}
+	return sk.UnmarshalBinary(data)
+}
+
+// MarshalJSON encodes the secret key as {"First": hex, "Second": hex}, each scalar
+// zero-padded to 64 hex digits
+func (sk *SecretKey) MarshalJSON() ([]byte, error) {
+	data, err := sk.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(secretKeyJSON{
+		First:  hex.EncodeToString(data[:fr.Bytes]),
+		Second: hex.EncodeToString(data[fr.Bytes:]),
+	})
+}
+
+// UnmarshalJSON decodes a secret key written by MarshalJSON. Scalars without zero
+// padding, as written by older versions of the SDK, are accepted.
+func (sk *SecretKey) UnmarshalJSON(data []byte) error {
+	if sk == nil {
+		return fmt.Errorf("nil receiver")
+	}
+
+	var encoded secretKeyJSON
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return err
+	}
+
+	first, ok := new(big.Int).SetString(encoded.First, 16)
+	if !ok {
+		return fmt.Errorf("%w: invalid hex scalar", ErrInvalidKey)
+	}
+	second, ok := new(big.Int).SetString(encoded.Second, 16)
+	if !ok {
+		return fmt.Errorf("%w: invalid hex scalar", ErrInvalidKey)
+	}
+	if !isScalar(first) || !isScalar(second) {
+		return fmt.Errorf("%w: secret key is out of range", ErrInvalidKey)
+	}
+
+	sk.First, sk.Second = first, second
+	return nil
+}
+
+// MarshalPEM encodes the secret key as a PEM block of type PEMTypeSecretKey
+func (sk *SecretKey) MarshalPEM() ([]byte, error) {
+	data, err := sk.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return marshalPEM(PEMTypeSecretKey, data), nil
+}
+
+// UnmarshalPEM decodes a secret key written by MarshalPEM
+func (sk *SecretKey) UnmarshalPEM(data []byte) error {
+	block, err := unmarshalPEM(PEMTypeSecretKey, data)
+	if err != nil {
+		return err
+	}
+	return sk.UnmarshalBinary(block)
+}
+
+// MarshalBinary encodes the key pair as the public key followed by the secret key
+func (kp *KeyPair) MarshalBinary() ([]byte, error) {
+	if kp == nil {
+		return nil, fmt.Errorf("%w: incomplete key pair", ErrInvalidKey)
+	}
+	public, err := kp.PublicKey.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	secret, err := kp.SecretKey.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return append(public, secret...), nil
+}
+
+// UnmarshalBinary decodes a key pair written by MarshalBinary. It does not check that
+// the public key belongs to the secret key; use keys.ValidateKeyPair for that.
+func (kp *KeyPair) UnmarshalBinary(data []byte) error {
+	if kp == nil {
+		return fmt.Errorf("nil receiver")
+	}
+	if len(data) != KeyPairSize {
+		return fmt.Errorf("%w: key pair must be %d bytes, got %d", ErrInvalidKey, KeyPairSize, len(data))
+	}
+
+	public := new(PublicKey)
+	if err := public.UnmarshalBinary(data[:PublicKeySize]); err != nil {
+		return err
+	}
+	secret := new(SecretKey)
+	if err := secret.UnmarshalBinary(data[PublicKeySize:]); err != nil {
+		return err
+	}
+
+	kp.PublicKey, kp.SecretKey = public, secret
+	return nil
+}
+
+// MarshalJSON encodes the key pair as {"PublicKey": ..., "SecretKey": ...}, the format
+// of the keypair files in testdata that pre-ts loads as well
+func (kp *KeyPair) MarshalJSON() ([]byte, error) {
+	if kp == nil {
+		return nil, fmt.Errorf("%w: incomplete key pair", ErrInvalidKey)
+	}
+	return json.Marshal(keyPairJSON{PublicKey: kp.PublicKey, SecretKey: kp.SecretKey})
+}
+
+// UnmarshalJSON decodes a key pair written by MarshalJSON
+func (kp *KeyPair) UnmarshalJSON(data []byte) error {
+	if kp == nil {
+		return fmt.Errorf("nil receiver")
+	}
+
+	var encoded keyPairJSON
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return err
+	}
+	if encoded.PublicKey == nil || encoded.SecretKey == nil {
+		return fmt.Errorf("%w: incomplete key pair", ErrInvalidKey)
+	}
+
+	kp.PublicKey, kp.SecretKey = encoded.PublicKey, encoded.SecretKey
+	return nil
+}
+
+// MarshalText encodes the key pair as standard base64 of its binary form
+func (kp *KeyPair) MarshalText() ([]byte, error) {
+	return marshalBase64(kp.MarshalBinary())
+}
+
+// UnmarshalText decodes a key pair written by MarshalText
+func (kp *KeyPair) UnmarshalText(text []byte) error {
+	data, err := unmarshalBase64(text)
+	if err != nil {
+		return err
+	}
+	return kp.UnmarshalBinary(data)
+}
+
+// MarshalPEM encodes the key pair as a PEM block of type PEMTypeKeyPair
+func (kp *KeyPair) MarshalPEM() ([]byte, error) {
+	data, err := kp.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return marshalPEM(PEMTypeKeyPair, data), nil
+}
+
+// UnmarshalPEM decodes a key pair written by MarshalPEM
+func (kp *KeyPair) UnmarshalPEM(data []byte) error {
+	block, err := unmarshalPEM(PEMTypeKeyPair, data)
+	if err != nil {
+		return err
+	}
+	return kp.UnmarshalBinary(block)
+}
+
+// ReEncryptionKey is an alias of bn254.G2Affine and cannot carry methods, so its codecs
+// are package-level functions. JSON and text use the base64 string of the binary form.
+
+// MarshalReEncryptionKey encodes the re-encryption key as an uncompressed G2 point (128 bytes)
+func MarshalReEncryptionKey(reKey *ReEncryptionKey) ([]byte, error) {
+	if reKey == nil {
+		return nil, fmt.Errorf("%w: missing re-encryption key", ErrInvalidKey)
+	}
+	data := reKey.RawBytes()
+	return data[:], nil
+}
+
+// UnmarshalReEncryptionKey decodes a re-encryption key from its uncompressed (128 bytes)
+// or compressed (64 bytes) form. The point must be in G2 and must not be the identity.
+func UnmarshalReEncryptionKey(data []byte) (*ReEncryptionKey, error) {
+	reKey, err := decodeG2(data)
+	if err != nil {
+		return nil, err
+	}
+	if reKey.IsInfinity() {
+		return nil, fmt.Errorf("%w: re-encryption key is the identity", ErrInvalidKey)
+	}
+	return reKey, nil
+}
+
+// MarshalReEncryptionKeyText encodes the re-encryption key as standard base64 of its binary form
+func MarshalReEncryptionKeyText(reKey *ReEncryptionKey) ([]byte, error) {
+	return marshalBase64(MarshalReEncryptionKey(reKey))
+}
+
+// UnmarshalReEncryptionKeyText decodes a re-encryption key written by MarshalReEncryptionKeyText
+func UnmarshalReEncryptionKeyText(text []byte) (*ReEncryptionKey, error) {
+	data, err := unmarshalBase64(text)
+	if err != nil {
+		return nil, err
+	}
+	return UnmarshalReEncryptionKey(data)
+}
+
+// MarshalReEncryptionKeyPEM encodes the re-encryption key as a PEM block of type
+// PEMTypeReEncryptionKey
+func MarshalReEncryptionKeyPEM(reKey *ReEncryptionKey) ([]byte, error) {
+	data, err := MarshalReEncryptionKey(reKey)
+	if err != nil {
+		return nil, err
+	}
+	return marshalPEM(PEMTypeReEncryptionKey, data), nil
+}
+
+// UnmarshalReEncryptionKeyPEM decodes a re-encryption key written by MarshalReEncryptionKeyPEM
+func UnmarshalReEncryptionKeyPEM(data []byte) (*ReEncryptionKey, error) {
+	block, err := unmarshalPEM(PEMTypeReEncryptionKey, data)
+	if err != nil {
+		return nil, err
+	}
+	return UnmarshalReEncryptionKey(block)
+}
+
+func decodeGT(data []byte) (*bn254.GT, error) {
+	gt := new(bn254.GT)
+	if err := gt.SetBytes(data); err != nil {
+		return nil, fmt.Errorf("%w: invalid GT element: %v", ErrInvalidKey, err)
+	}
+	if !gt.IsInSubGroup() {
+		return nil, fmt.Errorf("%w: GT element is not in the subgroup", ErrInvalidKey)
+	}
+	return gt, nil
+}
+
+func decodeG2(data []byte) (*bn254.G2Affine, error) {
+	if len(data) != bn254.SizeOfG2AffineUncompressed && len(data) != bn254.SizeOfG2AffineCompressed {
+		return nil, fmt.Errorf("%w: G2 point must be %d or %d bytes, got %d", ErrInvalidKey,
+			bn254.SizeOfG2AffineUncompressed, bn254.SizeOfG2AffineCompressed, len(data))
+	}
+
+	// SetBytes checks that the point is on the curve and in the subgroup
+	point := new(bn254.G2Affine)
+	if _, err := point.SetBytes(data); err != nil {
+		return nil, fmt.Errorf("%w: invalid G2 point: %v", ErrInvalidKey, err)
+	}
+	return point, nil
+}
+
+// isScalar reports whether x is a valid secret scalar, i.e. in [1, r-1]
+func isScalar(x *big.Int) bool {
+	return x.Sign() > 0 && x.Cmp(fr.Modulus()) < 0
+}
+
+func marshalBase64(data []byte, err error) ([]byte, error) {
+	if err != nil {
+		return nil, err
+	}
+	text := make([]byte, base64.StdEncoding.EncodedLen(len(data)))
+	base64.StdEncoding.Encode(text, data)
+	return text, nil
+}
+
+func unmarshalBase64(text []byte) ([]byte, error) {
+	data := make([]byte, base64.StdEncoding.DecodedLen(len(text)))
+	n, err := base64.StdEncoding.Decode(data, text)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid base64: %v", ErrInvalidKey, err)
+	}
+	return data[:n], nil
+}
+
+func marshalPEM(blockType string, data []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: data})
+}
+
+func unmarshalPEM(blockType string, data []byte) ([]byte, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%w: no PEM block found", ErrInvalidKey)
+	}
+	if block.Type != blockType {
+		return nil, fmt.Errorf("%w: expected PEM block %q, got %q", ErrInvalidKey, blockType, block.Type)
+	}
+	return block.Bytes, nil
+}
@@ -0,0 +1,195 @@
+package types_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre/types"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/testutils"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyCodecs(t *testing.T) {
+	keyPair := loadAliceKeyPair(t)
+
+	t.Run("PublicKey", func(t *testing.T) {
+		data, err := keyPair.PublicKey.MarshalBinary()
+		require.NoError(t, err)
+		require.Len(t, data, types.PublicKeySize)
+
+		decoded := new(types.PublicKey)
+		require.NoError(t, decoded.UnmarshalBinary(data))
+		require.Equal(t, keyPair.PublicKey, decoded)
+
+		text, err := keyPair.PublicKey.MarshalText()
+		require.NoError(t, err)
+		decoded = new(types.PublicKey)
+		require.NoError(t, decoded.UnmarshalText(text))
+		require.Equal(t, keyPair.PublicKey, decoded)
+
+		armored, err := keyPair.PublicKey.MarshalPEM()
+		require.NoError(t, err)
+		require.Contains(t, string(armored), "-----BEGIN PRE PUBLIC KEY-----")
+		decoded = new(types.PublicKey)
+		require.NoError(t, decoded.UnmarshalPEM(armored))
+		require.Equal(t, keyPair.PublicKey, decoded)
+	})
+
+	t.Run("SecretKey", func(t *testing.T) {
+		data, err := keyPair.SecretKey.MarshalBinary()
+		require.NoError(t, err)
+		require.Len(t, data, types.SecretKeySize)
+
+		decoded := new(types.SecretKey)
+		require.NoError(t, decoded.UnmarshalBinary(data))
+		require.Equal(t, keyPair.SecretKey, decoded)
+
+		text, err := keyPair.SecretKey.MarshalText()
+		require.NoError(t, err)
+		decoded = new(types.SecretKey)
+		require.NoError(t, decoded.UnmarshalText(text))
+		require.Equal(t, keyPair.SecretKey, decoded)
+
+		armored, err := keyPair.SecretKey.MarshalPEM()
+		require.NoError(t, err)
+		decoded = new(types.SecretKey)
+		require.NoError(t, decoded.UnmarshalPEM(armored))
+		require.Equal(t, keyPair.SecretKey, decoded)
+	})
+
+	t.Run("KeyPair", func(t *testing.T) {
+		data, err := keyPair.MarshalBinary()
+		require.NoError(t, err)
+		require.Len(t, data, types.KeyPairSize)
+
+		decoded := new(types.KeyPair)
+		require.NoError(t, decoded.UnmarshalBinary(data))
+		require.Equal(t, keyPair, decoded)
+
+		text, err := keyPair.MarshalText()
+		require.NoError(t, err)
+		decoded = new(types.KeyPair)
+		require.NoError(t, decoded.UnmarshalText(text))
+		require.Equal(t, keyPair, decoded)
+
+		armored, err := keyPair.MarshalPEM()
+		require.NoError(t, err)
+		decoded = new(types.KeyPair)
+		require.NoError(t, decoded.UnmarshalPEM(armored))
+		require.Equal(t, keyPair, decoded)
+
+		encoded, err := json.Marshal(keyPair)
+		require.NoError(t, err)
+		decoded = new(types.KeyPair)
+		require.NoError(t, json.Unmarshal(encoded, decoded))
+		require.Equal(t, keyPair, decoded)
+	})
+
+	t.Run("ReEncryptionKey", func(t *testing.T) {
+		reKey := testutils.GenerateRandomG2Elem()
+
+		data, err := types.MarshalReEncryptionKey(reKey)
+		require.NoError(t, err)
+		require.Len(t, data, types.ReEncryptionKeySize)
+
+		decoded, err := types.UnmarshalReEncryptionKey(data)
+		require.NoError(t, err)
+		require.True(t, reKey.Equal(decoded))
+
+		compressed := reKey.Bytes()
+		decoded, err = types.UnmarshalReEncryptionKey(compressed[:])
+		require.NoError(t, err)
+		require.True(t, reKey.Equal(decoded))
+
+		text, err := types.MarshalReEncryptionKeyText(reKey)
+		require.NoError(t, err)
+		decoded, err = types.UnmarshalReEncryptionKeyText(text)
+		require.NoError(t, err)
+		require.True(t, reKey.Equal(decoded))
+
+		armored, err := types.MarshalReEncryptionKeyPEM(reKey)
+		require.NoError(t, err)
+		decoded, err = types.UnmarshalReEncryptionKeyPEM(armored)
+		require.NoError(t, err)
+		require.True(t, reKey.Equal(decoded))
+	})
+}
+
+// TestKeyCodecsMatchTypeScript checks the encodings against the files in testdata,
+// which the pre-ts tests decode and compare with PublicKey.toBytes and SecretKey.toBytes.
+func TestKeyCodecsMatchTypeScript(t *testing.T) {
+	keyPair := loadAliceKeyPair(t)
+
+	publicKey, err := keyPair.PublicKey.MarshalBinary()
+	require.NoError(t, err)
+	secretKey, err := keyPair.SecretKey.MarshalBinary()
+	require.NoError(t, err)
+
+	require.NoError(t, testutils.WriteAsBase64IfNotExists("../../../../testdata/alice_public_key.txt", publicKey))
+	require.NoError(t, testutils.WriteAsBase64IfNotExists("../../../../testdata/alice_secret_key.txt", secretKey))
+
+	for file, expected := range map[string][]byte{
+		"../../../../testdata/alice_public_key.txt": publicKey,
+		"../../../../testdata/alice_secret_key.txt": secretKey,
+	} {
+		content, err := os.ReadFile(file)
+		require.NoError(t, err)
+		vector, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(content)))
+		require.NoError(t, err)
+		require.Equal(t, expected, vector, file)
+	}
+
+	// the JSON keypair files written by older versions (unpadded hex scalars) still decode
+	content, err := os.ReadFile("../../../../testdata/alice_keypair.json")
+	require.NoError(t, err)
+	decoded := new(types.KeyPair)
+	require.NoError(t, json.Unmarshal(content, decoded))
+	require.Equal(t, keyPair, decoded)
+}
+
+func TestKeyCodecErrors(t *testing.T) {
+	keyPair := loadAliceKeyPair(t)
+	publicKey, err := keyPair.PublicKey.MarshalBinary()
+	require.NoError(t, err)
+
+	t.Run("truncated public key", func(t *testing.T) {
+		err := new(types.PublicKey).UnmarshalBinary(publicKey[:100])
+		require.ErrorIs(t, err, types.ErrInvalidKey)
+	})
+
+	t.Run("public key not in the subgroup", func(t *testing.T) {
+		tampered := append([]byte(nil), publicKey...)
+		tampered[10] ^= 0x01
+		err := new(types.PublicKey).UnmarshalBinary(tampered)
+		require.ErrorIs(t, err, types.ErrInvalidKey)
+	})
+
+	t.Run("secret key out of range", func(t *testing.T) {
+		err := new(types.SecretKey).UnmarshalBinary(bytes.Repeat([]byte{0xff}, types.SecretKeySize))
+		require.ErrorIs(t, err, types.ErrInvalidKey)
+
+		err = new(types.SecretKey).UnmarshalBinary(make([]byte, types.SecretKeySize))
+		require.ErrorIs(t, err, types.ErrInvalidKey)
+	})
+
+	t.Run("wrong PEM block type", func(t *testing.T) {
+		armored, err := keyPair.PublicKey.MarshalPEM()
+		require.NoError(t, err)
+		err = new(types.SecretKey).UnmarshalPEM(armored)
+		require.ErrorIs(t, err, types.ErrInvalidKey)
+	})
+
+	t.Run("identity re-encryption key", func(t *testing.T) {
+		_, err := types.UnmarshalReEncryptionKey(make([]byte, types.ReEncryptionKeySize))
+		require.ErrorIs(t, err, types.ErrInvalidKey)
+	})
+}
+
+func loadAliceKeyPair(t *testing.T) *types.KeyPair {
+	keyPair, err := testutils.LoadKeyPairFromFile("../../../../testdata/alice_keypair.json")
+	require.NoError(t, err)
+	return keyPair
+}
@@ -0,0 +1,397 @@
+package types
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254"
+)
+
+// SchemeID identifies the curve and PRE construction a capsule was produced with
+type SchemeID byte
+
+// KDFID identifies how the symmetric key is derived from the GT element of a capsule
+type KDFID byte
+
+const (
+	// SchemeBN254 is the AFGH-style scheme of this package over the BN254 curve
+	SchemeBN254 SchemeID = 1
+	// SchemeBN254FO is SchemeBN254 with the Fujisaki-Okamoto transform of pre.NewCCAClient.
+	// Its capsules are SchemeBN254 capsules whose scalar is derived from the symmetric key.
+	SchemeBN254FO SchemeID = 2
+
+	// KDFHKDFSHA256 is HKDF-SHA256 with salt "PRE_derive_key" and info "PRE_symmetric_key",
+	// applied to the 384-byte encoding of the GT element
+	KDFHKDFSHA256 KDFID = 1
+
+	// SymmetricKeySize is the size in bytes of the AES key of both schemes
+	SymmetricKeySize = 32
+)
+
+const (
+	// EnvelopeVersion1 is the first envelope version
+	EnvelopeVersion1 byte = 1
+	// EnvelopeVersion2 adds the attributes of the capsule (owner fingerprint, context, ...)
+	// and the recipients of multi-recipient envelopes
+	EnvelopeVersion2 byte = 2
+
+	// CurrentEnvelopeVersion is the version written by NewEnvelope and Upgrade
+	CurrentEnvelopeVersion = EnvelopeVersion2
+
+	// envelopeHeaderSize is magic (4) || version || scheme || kdf || key size || capsule length (2)
+	envelopeHeaderSize = 10
+)
+
+// envelopeMagic prefixes every serialized envelope
+var envelopeMagic = [4]byte{'L', 'P', 'R', 'E'}
+
+var (
+	// ErrInvalidEnvelope is returned when serialized envelope bytes cannot be parsed
+	ErrInvalidEnvelope = errors.New("invalid envelope")
+
+	// ErrUnsupportedEnvelope is returned for envelopes written with a version, scheme
+	// or KDF this build does not know about
+	ErrUnsupportedEnvelope = errors.New("unsupported envelope")
+
+	// ErrNotRecipient is returned when an envelope holds no capsule for the given delegatee
+	ErrNotRecipient = errors.New("not a recipient of the envelope")
+)
+
+// Recipient is a delegatee of a multi-recipient envelope. Every recipient capsule is the
+// re-encryption of the capsule of the envelope, so it only differs from it in the first
+// component; see Envelope.RecipientKey.
+type Recipient struct {
+	Fingerprint []byte    // PublicKey.Fingerprint of the delegatee
+	First       *bn254.GT // First component of the first-level key of the delegatee
+}
+
+// Envelope is a self-describing ciphertext: the second-level encrypted key (capsule), the
+// AES-GCM encrypted payload, and the identifiers needed to decrypt them.
+// Records stored as envelopes stay decryptable when the defaults of the scheme change.
+//
+// Serialized layout, multi-byte integers are big-endian:
+//
+//	magic "LPRE" (4) || version (1) || scheme ID (1) || KDF ID (1) || key size (1) ||
+//	capsule length (2) || capsule || attributes || payload
+//
+// The attributes and recipients sections only exist from version 2 on. The attributes section
+// is its length (4) followed by the CapsuleAttributes of the capsule, see
+// CapsuleAttributes.MarshalBinary. The recipients section is the number of recipients (2)
+// followed by entries of fingerprint length (1) || fingerprint || GT element (384).
+// Recipients share the payload, so adding or removing one never touches the payload bytes.
+type Envelope struct {
+	Version byte     // Serialization version
+	Scheme  SchemeID // Curve and PRE construction of the capsule
+	KDF     KDFID    // Derivation of the symmetric key from the capsule
+	KeySize uint8    // Size of the derived AES key in bytes, SymmetricKeySize
+
+	Capsule    *SecondLevelSymmetricKey // Encrypted symmetric key
+	Recipients []Recipient              // Delegatees the capsule was re-encrypted for, if any
+	Payload    []byte                   // Nonce-prefixed AES-GCM ciphertext of the message
+}
+
+// NewEnvelope wraps a second-level encrypted key and the encrypted message returned by
+// PreClient.SecondLevelEncryption in an envelope of the current version and of scheme
+// SchemeBN254, the scheme of pre.NewClient.
+// Records produced before envelopes existed used the same scheme, KDF and key size,
+// so they can be wrapped with NewEnvelope as well.
+func NewEnvelope(capsule *SecondLevelSymmetricKey, payload []byte) *Envelope {
+	return NewEnvelopeFor(SchemeBN254, capsule, payload)
+}
+
+// NewEnvelopeFor is NewEnvelope for a capsule of the given scheme, e.g. SchemeBN254FO for
+// the keys of pre.NewCCAClient
+func NewEnvelopeFor(scheme SchemeID, capsule *SecondLevelSymmetricKey, payload []byte) *Envelope {
+	return &Envelope{
+		Version: CurrentEnvelopeVersion,
+		Scheme:  scheme,
+		KDF:     KDFHKDFSHA256,
+		KeySize: SymmetricKeySize,
+		Capsule: capsule,
+		Payload: payload,
+	}
+}
+
+// Marshal serializes the envelope using the layout of its version
+func (e *Envelope) Marshal() ([]byte, error) {
+	if e == nil {
+		return nil, fmt.Errorf("nil receiver")
+	}
+	if e.Version == 0 || e.Version > CurrentEnvelopeVersion {
+		return nil, fmt.Errorf("%w: version %d", ErrUnsupportedEnvelope, e.Version)
+	}
+	if e.Capsule == nil || e.Capsule.First == nil || e.Capsule.Second == nil {
+		return nil, fmt.Errorf("%w: missing capsule", ErrInvalidEnvelope)
+	}
+
+	capsule := e.Capsule.ToBytes()
+
+	var attributes, recipients []byte
+	if e.Version >= EnvelopeVersion2 {
+		var err error
+		if attributes, err = marshalCapsuleAttributes(e.Capsule); err != nil {
+			return nil, err
+		}
+		if recipients, err = marshalRecipients(e.Recipients); err != nil {
+			return nil, err
+		}
+	} else if !e.Capsule.CapsuleAttributes.IsZero() || len(e.Recipients) > 0 {
+		return nil, fmt.Errorf("%w: version %d cannot hold capsule attributes or recipients", ErrUnsupportedEnvelope, e.Version)
+	}
+
+	var buf bytes.Buffer
+	buf.Grow(envelopeHeaderSize + len(capsule) + len(attributes) + len(recipients) + len(e.Payload))
+	buf.Write(envelopeMagic[:])
+	buf.WriteByte(e.Version)
+	buf.WriteByte(byte(e.Scheme))
+	buf.WriteByte(byte(e.KDF))
+	buf.WriteByte(e.KeySize)
+	_ = binary.Write(&buf, binary.BigEndian, uint16(len(capsule))) // #nosec G115 -- capsule is 416 bytes
+	buf.Write(capsule)
+	buf.Write(attributes)
+	buf.Write(recipients)
+	buf.Write(e.Payload)
+
+	return buf.Bytes(), nil
+}
+
+// Unmarshal parses an envelope of any known version. The envelope keeps the version it
+// was written with; call Upgrade to bring it to CurrentEnvelopeVersion.
+func (e *Envelope) Unmarshal(data []byte) error {
+	if e == nil {
+		return fmt.Errorf("nil receiver")
+	}
+	if len(data) < envelopeHeaderSize || !bytes.Equal(data[:4], envelopeMagic[:]) {
+		return fmt.Errorf("%w: missing magic number", ErrInvalidEnvelope)
+	}
+
+	version := data[4]
+	if version == 0 || version > CurrentEnvelopeVersion {
+		return fmt.Errorf("%w: version %d", ErrUnsupportedEnvelope, version)
+	}
+
+	capsuleLen := int(binary.BigEndian.Uint16(data[8:10]))
+	rest := data[envelopeHeaderSize:]
+	if len(rest) < capsuleLen {
+		return fmt.Errorf("%w: capsule truncated", ErrInvalidEnvelope)
+	}
+
+	capsule := new(SecondLevelSymmetricKey)
+	if err := capsule.UnmarshalBinary(rest[:capsuleLen]); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidEnvelope, err)
+	}
+	rest = rest[capsuleLen:]
+
+	var recipients []Recipient
+	if version >= EnvelopeVersion2 {
+		n, err := unmarshalCapsuleAttributes(capsule, rest)
+		if err != nil {
+			return err
+		}
+		rest = rest[n:]
+
+		if recipients, n, err = unmarshalRecipients(rest); err != nil {
+			return err
+		}
+		rest = rest[n:]
+	}
+
+	*e = Envelope{
+		Version:    version,
+		Scheme:     SchemeID(data[5]),
+		KDF:        KDFID(data[6]),
+		KeySize:    data[7],
+		Capsule:    capsule,
+		Recipients: recipients,
+		Payload:    append([]byte(nil), rest...),
+	}
+
+	return nil
+}
+
+// Upgrade converts the envelope to CurrentEnvelopeVersion in place. The capsule and
+// payload are left untouched; only fields introduced by newer versions are filled in,
+// so the envelope decrypts exactly as before.
+func (e *Envelope) Upgrade() error {
+	if e == nil {
+		return fmt.Errorf("nil receiver")
+	}
+
+	switch e.Version {
+	case EnvelopeVersion1:
+		// version 1 capsules carry no attributes and have no recipients, which decrypts
+		// exactly like before
+		e.Version = EnvelopeVersion2
+		return nil
+	case EnvelopeVersion2:
+		return nil
+	default:
+		return fmt.Errorf("%w: version %d", ErrUnsupportedEnvelope, e.Version)
+	}
+}
+
+// RecipientKey returns the first-level encrypted key of the delegatee with the given
+// fingerprint, or nil if the envelope has no capsule for them
+func (e *Envelope) RecipientKey(fingerprint []byte) *FirstLevelSymmetricKey {
+	if e == nil || e.Capsule == nil {
+		return nil
+	}
+
+	i := e.recipientIndex(fingerprint)
+	if i < 0 {
+		return nil
+	}
+
+	return &FirstLevelSymmetricKey{
+		First:   e.Recipients[i].First,
+		Second:  e.Capsule.Second,
+		Capsule: e.Capsule.First,
+
+		CapsuleAttributes: e.Capsule.CapsuleAttributes,
+	}
+}
+
+// SetRecipient adds the first-level encrypted key of the delegatee with the given
+// fingerprint, replacing their previous one. The key must be a re-encryption of the
+// capsule of the envelope.
+func (e *Envelope) SetRecipient(fingerprint []byte, key *FirstLevelSymmetricKey) error {
+	if e == nil {
+		return fmt.Errorf("nil receiver")
+	}
+	if len(fingerprint) == 0 || len(fingerprint) > math.MaxUint8 {
+		return fmt.Errorf("%w: invalid recipient fingerprint length %d", ErrInvalidEnvelope, len(fingerprint))
+	}
+	if e.Capsule == nil || e.Capsule.Second == nil || key == nil || key.First == nil || key.Second == nil {
+		return ErrMalformedCapsule
+	}
+	if !key.Second.Equal(e.Capsule.Second) {
+		return fmt.Errorf("%w: key is not a re-encryption of the envelope capsule", ErrMalformedCapsule)
+	}
+
+	recipient := Recipient{Fingerprint: append([]byte(nil), fingerprint...), First: key.First}
+	if i := e.recipientIndex(fingerprint); i >= 0 {
+		e.Recipients[i] = recipient
+	} else {
+		e.Recipients = append(e.Recipients, recipient)
+	}
+	return nil
+}
+
+// RemoveRecipient drops the capsule of the delegatee with the given fingerprint and
+// reports whether there was one
+func (e *Envelope) RemoveRecipient(fingerprint []byte) bool {
+	if e == nil {
+		return false
+	}
+
+	i := e.recipientIndex(fingerprint)
+	if i < 0 {
+		return false
+	}
+
+	e.Recipients = append(e.Recipients[:i], e.Recipients[i+1:]...)
+	if len(e.Recipients) == 0 {
+		e.Recipients = nil
+	}
+	return true
+}
+
+// recipientIndex returns the index of the recipient with the given fingerprint, or -1
+func (e *Envelope) recipientIndex(fingerprint []byte) int {
+	for i := range e.Recipients {
+		if bytes.Equal(e.Recipients[i].Fingerprint, fingerprint) {
+			return i
+		}
+	}
+	return -1
+}
+
+// marshalRecipients encodes the recipients section
+func marshalRecipients(recipients []Recipient) ([]byte, error) {
+	if len(recipients) > math.MaxUint16 {
+		return nil, fmt.Errorf("%w: too many recipients", ErrInvalidEnvelope)
+	}
+
+	section := binary.BigEndian.AppendUint16(nil, uint16(len(recipients))) // #nosec G115 -- checked above
+	for _, recipient := range recipients {
+		if len(recipient.Fingerprint) == 0 || len(recipient.Fingerprint) > math.MaxUint8 {
+			return nil, fmt.Errorf("%w: invalid recipient fingerprint length %d", ErrInvalidEnvelope, len(recipient.Fingerprint))
+		}
+		if recipient.First == nil {
+			return nil, fmt.Errorf("%w: missing recipient capsule", ErrInvalidEnvelope)
+		}
+		first := recipient.First.Bytes()
+		section = append(section, byte(len(recipient.Fingerprint)))
+		section = append(section, recipient.Fingerprint...)
+		section = append(section, first[:]...)
+	}
+
+	return section, nil
+}
+
+// unmarshalRecipients decodes the recipients section at the start of data and returns
+// the number of bytes it occupies
+func unmarshalRecipients(data []byte) ([]Recipient, int, error) {
+	if len(data) < 2 {
+		return nil, 0, fmt.Errorf("%w: recipients truncated", ErrInvalidEnvelope)
+	}
+	count := int(binary.BigEndian.Uint16(data))
+
+	var recipients []Recipient
+	offset := 2
+	for i := 0; i < count; i++ {
+		if len(data)-offset < 1 {
+			return nil, 0, fmt.Errorf("%w: recipient truncated", ErrInvalidEnvelope)
+		}
+		length := int(data[offset])
+		if length == 0 {
+			return nil, 0, fmt.Errorf("%w: empty recipient fingerprint", ErrInvalidEnvelope)
+		}
+		if len(data)-offset-1 < length+bn254.SizeOfGT {
+			return nil, 0, fmt.Errorf("%w: recipient truncated", ErrInvalidEnvelope)
+		}
+		fingerprint := append([]byte(nil), data[offset+1:offset+1+length]...)
+		offset += 1 + length
+
+		first, err := decodeCapsuleGT(data[offset : offset+bn254.SizeOfGT])
+		if err != nil {
+			return nil, 0, fmt.Errorf("%w: %v", ErrInvalidEnvelope, err)
+		}
+		offset += bn254.SizeOfGT
+
+		recipients = append(recipients, Recipient{Fingerprint: fingerprint, First: first})
+	}
+
+	return recipients, offset, nil
+}
+
+// marshalCapsuleAttributes encodes the attribute section for the capsule
+func marshalCapsuleAttributes(capsule *SecondLevelSymmetricKey) ([]byte, error) {
+	attributes, err := capsule.CapsuleAttributes.MarshalBinary()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidEnvelope, err)
+	}
+
+	section := binary.BigEndian.AppendUint32(nil, uint32(len(attributes))) // #nosec G115 -- at most five attributes
+	return append(section, attributes...), nil
+}
+
+// unmarshalCapsuleAttributes decodes the attribute section at the start of data into the capsule
+// and returns the number of bytes it occupies
+func unmarshalCapsuleAttributes(capsule *SecondLevelSymmetricKey, data []byte) (int, error) {
+	if len(data) < 4 {
+		return 0, fmt.Errorf("%w: attributes truncated", ErrInvalidEnvelope)
+	}
+	size := binary.BigEndian.Uint32(data)
+	if uint64(len(data)-4) < uint64(size) {
+		return 0, fmt.Errorf("%w: attributes truncated", ErrInvalidEnvelope)
+	}
+
+	if err := capsule.CapsuleAttributes.UnmarshalBinary(data[4 : 4+int(size)]); err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidEnvelope, err)
+	}
+	return 4 + int(size), nil
+}
@@ -0,0 +1,189 @@
+package types_test
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre/types"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/testutils"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvelopeMarshalUnmarshal(t *testing.T) {
+	envelope := types.NewEnvelope(testutils.GenerateMockSecondLevelCipherText(0), []byte("encrypted payload"))
+
+	data, err := envelope.Marshal()
+	require.NoError(t, err)
+	require.Equal(t, []byte("LPRE"), data[:4])
+
+	recovered := new(types.Envelope)
+	require.NoError(t, recovered.Unmarshal(data))
+	require.Equal(t, envelope, recovered)
+
+	require.NoError(t, recovered.Upgrade())
+	require.Equal(t, types.CurrentEnvelopeVersion, recovered.Version)
+}
+
+func TestEnvelopeAttributes(t *testing.T) {
+	capsule := testutils.GenerateMockSecondLevelCipherText(0)
+	capsule.Owner = []byte("owner fingerprint")
+	capsule.Context = []byte("record-42")
+	capsule.Proof = &types.CapsuleProof{Challenge: big.NewInt(42), Response: big.NewInt(7)}
+	envelope := types.NewEnvelope(capsule, []byte("encrypted payload"))
+
+	data, err := envelope.Marshal()
+	require.NoError(t, err)
+
+	recovered := new(types.Envelope)
+	require.NoError(t, recovered.Unmarshal(data))
+	require.Equal(t, envelope, recovered)
+
+	t.Run("version 1 cannot hold attributes", func(t *testing.T) {
+		legacy := *envelope
+		legacy.Version = types.EnvelopeVersion1
+		_, err := legacy.Marshal()
+		require.ErrorIs(t, err, types.ErrUnsupportedEnvelope)
+	})
+
+	t.Run("bare encoding", func(t *testing.T) {
+		_, err := capsule.MarshalBinary()
+		require.ErrorIs(t, err, types.ErrAttributesNeedEnvelope)
+
+		bare := new(types.SecondLevelSymmetricKey)
+		require.NoError(t, bare.UnmarshalBinary(capsule.ToBytes()))
+		require.True(t, bare.CapsuleAttributes.IsZero())
+		_, err = bare.MarshalBinary()
+		require.NoError(t, err)
+	})
+
+	t.Run("unknown attributes", func(t *testing.T) {
+		data, err := capsule.CapsuleAttributes.MarshalBinary()
+		require.NoError(t, err)
+
+		var decoded types.CapsuleAttributes
+		require.NoError(t, decoded.UnmarshalBinary(data))
+		require.Equal(t, capsule.CapsuleAttributes, decoded)
+		require.ErrorIs(t, decoded.UnmarshalBinary(append(data, 0xff, 0, 2, 'h', 'i')), types.ErrMalformedCapsule)
+		require.ErrorIs(t, decoded.UnmarshalBinary(append(data, 0xff, 0, 3, 'h', 'i')), types.ErrMalformedCapsule)
+	})
+
+	t.Run("repeated attributes", func(t *testing.T) {
+		data, err := capsule.CapsuleAttributes.MarshalBinary()
+		require.NoError(t, err)
+
+		var decoded types.CapsuleAttributes
+		require.ErrorIs(t, decoded.UnmarshalBinary(append(data, 2, 0, 2, 'h', 'i')), types.ErrMalformedCapsule)
+	})
+}
+
+func TestEnvelopeUpgrade(t *testing.T) {
+	legacy := types.NewEnvelope(testutils.GenerateMockSecondLevelCipherText(0), []byte("encrypted payload"))
+	legacy.Version = types.EnvelopeVersion1
+
+	data, err := legacy.Marshal()
+	require.NoError(t, err)
+
+	recovered := new(types.Envelope)
+	require.NoError(t, recovered.Unmarshal(data))
+	require.Equal(t, types.EnvelopeVersion1, recovered.Version)
+	require.Equal(t, legacy.Payload, recovered.Payload)
+
+	require.NoError(t, recovered.Upgrade())
+	require.Equal(t, types.CurrentEnvelopeVersion, recovered.Version)
+
+	upgraded, err := recovered.Marshal()
+	require.NoError(t, err)
+	require.NoError(t, recovered.Unmarshal(upgraded))
+	require.Equal(t, legacy.Capsule, recovered.Capsule)
+	require.Equal(t, legacy.Payload, recovered.Payload)
+}
+
+func TestEnvelopeErrors(t *testing.T) {
+	envelope := types.NewEnvelope(testutils.GenerateMockSecondLevelCipherText(0), []byte("encrypted payload"))
+	data, err := envelope.Marshal()
+	require.NoError(t, err)
+
+	t.Run("missing magic", func(t *testing.T) {
+		err := new(types.Envelope).Unmarshal(data[4:])
+		require.ErrorIs(t, err, types.ErrInvalidEnvelope)
+	})
+
+	t.Run("unknown version", func(t *testing.T) {
+		future := append([]byte(nil), data...)
+		future[4] = types.CurrentEnvelopeVersion + 1
+		err := new(types.Envelope).Unmarshal(future)
+		require.ErrorIs(t, err, types.ErrUnsupportedEnvelope)
+	})
+
+	t.Run("truncated capsule", func(t *testing.T) {
+		err := new(types.Envelope).Unmarshal(data[:100])
+		require.ErrorIs(t, err, types.ErrInvalidEnvelope)
+	})
+
+	t.Run("invalid capsule", func(t *testing.T) {
+		corrupted := append([]byte(nil), data...)
+		for i := 10; i < 42; i++ {
+			corrupted[i] = 0xff
+		}
+		err := new(types.Envelope).Unmarshal(corrupted)
+		require.ErrorIs(t, err, types.ErrInvalidEnvelope)
+	})
+
+	t.Run("missing capsule", func(t *testing.T) {
+		_, err := types.NewEnvelope(nil, nil).Marshal()
+		require.ErrorIs(t, err, types.ErrInvalidEnvelope)
+	})
+}
+
+func TestEnvelopeRecipients(t *testing.T) {
+	capsule := testutils.GenerateMockSecondLevelCipherText(0)
+	envelope := types.NewEnvelope(capsule, []byte("encrypted payload"))
+
+	recipientKey := &types.FirstLevelSymmetricKey{First: testutils.GenerateRandomGTElem(), Second: capsule.Second, Capsule: capsule.First}
+	require.NoError(t, envelope.SetRecipient([]byte("doctor-1"), recipientKey))
+	require.NoError(t, envelope.SetRecipient([]byte("doctor-2"), recipientKey))
+	require.Equal(t, recipientKey, envelope.RecipientKey([]byte("doctor-1")))
+	require.Nil(t, envelope.RecipientKey([]byte("doctor-3")))
+
+	data, err := envelope.Marshal()
+	require.NoError(t, err)
+
+	recovered := new(types.Envelope)
+	require.NoError(t, recovered.Unmarshal(data))
+	require.Equal(t, envelope, recovered)
+
+	require.True(t, recovered.RemoveRecipient([]byte("doctor-1")))
+	require.Len(t, recovered.Recipients, 1)
+	require.Equal(t, envelope.Payload, recovered.Payload)
+
+	t.Run("bare encoding", func(t *testing.T) {
+		// the capsule of a first-level key is only encoded as the capsule of its envelope
+		_, err := recipientKey.MarshalBinary()
+		require.ErrorIs(t, err, types.ErrAttributesNeedEnvelope)
+		require.Equal(t, capsule.First, recovered.RecipientKey([]byte("doctor-2")).Capsule)
+
+		bare := *recipientKey
+		bare.Capsule = nil
+		data, err := bare.MarshalBinary()
+		require.NoError(t, err)
+		require.Equal(t, recipientKey.ToBytes(), data)
+	})
+
+	t.Run("key of another capsule", func(t *testing.T) {
+		other := &types.FirstLevelSymmetricKey{First: testutils.GenerateRandomGTElem(), Second: testutils.GenerateRandomGTElem()}
+		require.ErrorIs(t, envelope.SetRecipient([]byte("doctor-3"), other), types.ErrMalformedCapsule)
+	})
+
+	t.Run("version 1 cannot hold recipients", func(t *testing.T) {
+		legacy := *envelope
+		legacy.Version = types.EnvelopeVersion1
+		legacy.Capsule = testutils.GenerateMockSecondLevelCipherText(0)
+		_, err := legacy.Marshal()
+		require.ErrorIs(t, err, types.ErrUnsupportedEnvelope)
+	})
+
+	t.Run("truncated recipients", func(t *testing.T) {
+		truncated := data[:len(data)-len(envelope.Payload)-1]
+		require.ErrorIs(t, new(types.Envelope).Unmarshal(truncated), types.ErrInvalidEnvelope)
+	})
+}
@@ -0,0 +1,34 @@
+package types
+
+import "errors"
+
+// Sentinel errors returned by PreClient decryption methods.
+// Implementations wrap them, so callers should match with errors.Is.
+var (
+	// ErrInvalidKey is returned when the secret key is missing or one of its
+	// scalars cannot be used by the scheme (zero, out of range or not invertible).
+	ErrInvalidKey = errors.New("invalid secret key")
+
+	// ErrAuthenticationFailed is returned when the encrypted message does not
+	// authenticate under the symmetric key recovered from the capsule.
+	// AES-GCM cannot tell a tampered message apart from a capsule opened with
+	// the wrong (but well-formed) secret key, so both end up here, as do the
+	// capsules rejected by the decryption checks of the CCA-secure client.
+	ErrAuthenticationFailed = errors.New("message authentication failed")
+
+	// ErrMalformedCapsule is returned when the encrypted symmetric key is nil,
+	// is missing one of its group elements, or its bytes do not decode to valid ones.
+	ErrMalformedCapsule = errors.New("malformed capsule")
+)
+
+// ErrInvalidProof is returned when a re-encryption proof is malformed or does not show that
+// the first-level key was computed with the committed re-encryption key.
+var ErrInvalidProof = errors.New("invalid re-encryption proof")
+
+// ErrInvalidFragment is returned when a fragment of a re-encryption key or of a first-level
+// key is malformed, or when fragments cannot be combined.
+var ErrInvalidFragment = errors.New("invalid fragment")
+
+// ErrAttributesNeedEnvelope is returned by the bare encoding of keys for keys with attributes,
+// which only an Envelope encodes, see CapsuleAttributes.
+var ErrAttributesNeedEnvelope = errors.New("key attributes need an envelope")
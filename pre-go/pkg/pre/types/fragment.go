@@ -0,0 +1,134 @@
+package types
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254"
+)
+
+const (
+	// fragmentHeaderSize is the size of the index and threshold of a serialized fragment
+	fragmentHeaderSize = 4
+
+	// ReKeyFragmentSize is the size of ReKeyFragment.MarshalBinary: the index and threshold
+	// followed by a compressed G2 point
+	ReKeyFragmentSize = fragmentHeaderSize + bn254.SizeOfG2AffineCompressed
+	// FirstLevelKeyFragmentSize is the size of FirstLevelKeyFragment.MarshalBinary: the index
+	// and threshold followed by the 768 bytes of FirstLevelSymmetricKey.ToBytes
+	FirstLevelKeyFragmentSize = fragmentHeaderSize + FirstLevelSymmetricKeySize
+)
+
+// ReKeyFragment is one of the n shares of a re-encryption key split between n proxies, any
+// Threshold of which are needed to re-encrypt a key. The delegator shares its scalar a1 with
+// a polynomial f of degree Threshold-1 such that f(0) = a1, and fragment i is the
+// re-encryption key computed with f(i) instead of a1.
+type ReKeyFragment struct {
+	Index     uint16          // Point at which the polynomial was evaluated, from 1 to n
+	Threshold uint16          // Number of fragments needed to re-encrypt
+	Key       *bn254.G2Affine // (g2^b2)^f(Index)
+}
+
+// FirstLevelKeyFragment is the share of a first-level key produced by the proxy holding the
+// re-encryption key fragment with the same index. Its Key is a first-level key whose First
+// component is only a share; the delegatee combines the fragments of as many proxies as the
+// threshold of the delegator into the first-level key with pre.CombineFragments. Threshold
+// is set by the proxy and only checked against it.
+type FirstLevelKeyFragment struct {
+	Index     uint16
+	Threshold uint16
+	Key       *FirstLevelSymmetricKey
+}
+
+// MarshalBinary serializes the fragment to ReKeyFragmentSize bytes:
+// index (2) || threshold (2) || compressed G2 point (64), integers big-endian
+func (f *ReKeyFragment) MarshalBinary() ([]byte, error) {
+	if err := checkFragmentHeader(f.Index, f.Threshold); err != nil {
+		return nil, err
+	}
+	if f.Key == nil {
+		return nil, fmt.Errorf("%w: missing key", ErrInvalidFragment)
+	}
+
+	key := f.Key.Bytes()
+	data := make([]byte, 0, ReKeyFragmentSize)
+	data = binary.BigEndian.AppendUint16(data, f.Index)
+	data = binary.BigEndian.AppendUint16(data, f.Threshold)
+	return append(data, key[:]...), nil
+}
+
+// UnmarshalBinary decodes a fragment serialized by MarshalBinary, checking that the point
+// is in G2 and not the identity
+func (f *ReKeyFragment) UnmarshalBinary(data []byte) error {
+	if len(data) != ReKeyFragmentSize {
+		return fmt.Errorf("%w: expected %d bytes, got %d", ErrInvalidFragment, ReKeyFragmentSize, len(data))
+	}
+	index := binary.BigEndian.Uint16(data)
+	threshold := binary.BigEndian.Uint16(data[2:])
+	if err := checkFragmentHeader(index, threshold); err != nil {
+		return err
+	}
+
+	key := new(bn254.G2Affine)
+	if _, err := key.SetBytes(data[fragmentHeaderSize:]); err != nil {
+		return fmt.Errorf("%w: invalid G2 point: %v", ErrInvalidFragment, err)
+	}
+	if key.IsInfinity() {
+		return fmt.Errorf("%w: G2 point at infinity", ErrInvalidFragment)
+	}
+
+	f.Index, f.Threshold, f.Key = index, threshold, key
+	return nil
+}
+
+// MarshalBinary serializes the fragment to FirstLevelKeyFragmentSize bytes:
+// index (2) || threshold (2) || FirstLevelSymmetricKey.ToBytes (768). It leaves out the
+// Capsule and attributes of the key, which are those of the second-level key the fragments
+// are combined for.
+func (f *FirstLevelKeyFragment) MarshalBinary() ([]byte, error) {
+	if err := checkFragmentHeader(f.Index, f.Threshold); err != nil {
+		return nil, err
+	}
+	if f.Key == nil || f.Key.First == nil || f.Key.Second == nil {
+		return nil, fmt.Errorf("%w: missing group element", ErrMalformedCapsule)
+	}
+	key := f.Key.ToBytes()
+
+	data := make([]byte, 0, FirstLevelKeyFragmentSize)
+	data = binary.BigEndian.AppendUint16(data, f.Index)
+	data = binary.BigEndian.AppendUint16(data, f.Threshold)
+	return append(data, key...), nil
+}
+
+// UnmarshalBinary decodes a fragment serialized by MarshalBinary, see
+// FirstLevelSymmetricKey.UnmarshalBinary for the checks of the key
+func (f *FirstLevelKeyFragment) UnmarshalBinary(data []byte) error {
+	if len(data) != FirstLevelKeyFragmentSize {
+		return fmt.Errorf("%w: expected %d bytes, got %d", ErrInvalidFragment, FirstLevelKeyFragmentSize, len(data))
+	}
+	index := binary.BigEndian.Uint16(data)
+	threshold := binary.BigEndian.Uint16(data[2:])
+	if err := checkFragmentHeader(index, threshold); err != nil {
+		return err
+	}
+
+	key := new(FirstLevelSymmetricKey)
+	if err := key.UnmarshalBinary(data[fragmentHeaderSize:]); err != nil {
+		return err
+	}
+
+	f.Index, f.Threshold, f.Key = index, threshold, key
+	return nil
+}
+
+// checkFragmentHeader rejects the index 0, at which the polynomial is the secret itself,
+// and the threshold 0
+func checkFragmentHeader(index, threshold uint16) error {
+	if index == 0 {
+		return fmt.Errorf("%w: index 0", ErrInvalidFragment)
+	}
+	if threshold == 0 {
+		return fmt.Errorf("%w: threshold 0", ErrInvalidFragment)
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package types
 
 import (
+	"crypto/sha256"
 	"math/big"
 
 	"github.com/consensys/gnark-crypto/ecc/bn254"
@@ -23,3 +24,34 @@ type SecretKey struct {
 	First  *big.Int // First component of the secret key, used for the first level encryption
 	Second *big.Int // Second component of the secret key, used for the second level encryption
 }
+
+// Fingerprint returns the SHA-256 digest of the public key, computed over the GT element
+// followed by the uncompressed G2 point, the same 512 bytes pre-ts PublicKey.toBytes produces.
+func (pk *PublicKey) Fingerprint() []byte {
+	first := pk.First.Bytes()
+	second := pk.Second.RawBytes()
+
+	h := sha256.New()
+	h.Write(first[:])
+	h.Write(second[:])
+	return h.Sum(nil)
+}
+
+// Zeroize overwrites the scalars of the secret key in memory and sets them to zero.
+// Call it once the key is no longer needed; the key is unusable afterwards.
+// Copies made elsewhere (e.g. by big.Int arithmetic) are not affected.
+func (sk *SecretKey) Zeroize() {
+	if sk == nil {
+		return
+	}
+	for _, scalar := range []*big.Int{sk.First, sk.Second} {
+		if scalar == nil {
+			continue
+		}
+		words := scalar.Bits()
+		for i := range words {
+			words[i] = 0
+		}
+		scalar.SetInt64(0)
+	}
+}
@@ -0,0 +1,86 @@
+package types
+
+import (
+	"math/big"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre/fixedbase"
+)
+
+// PreparedParams holds the system parameters along with fixed-base tables for g1, g2 and Z,
+// which never change and are raised to a fresh scalar by every key generation and encryption.
+// Preparing takes a few milliseconds, so the parameters should be prepared once and shared;
+// they are safe for concurrent use.
+type PreparedParams struct {
+	SystemParams
+
+	g1 *fixedbase.G1
+	g2 *fixedbase.G2
+	z  *fixedbase.GT
+}
+
+// PrepareParams precomputes the tables of the set components of params
+func PrepareParams(params SystemParams) *PreparedParams {
+	prepared := &PreparedParams{SystemParams: params}
+	if params.G1 != nil {
+		prepared.g1 = fixedbase.NewG1(params.G1)
+	}
+	if params.G2 != nil {
+		prepared.g2 = fixedbase.NewG2(params.G2)
+	}
+	if params.Z != nil {
+		prepared.z = fixedbase.NewGT(params.Z)
+	}
+	return prepared
+}
+
+// G1Exp returns g1^k
+func (p *PreparedParams) G1Exp(k *big.Int) *bn254.G1Affine {
+	return p.g1.ScalarMultiplication(k)
+}
+
+// G2Exp returns g2^k
+func (p *PreparedParams) G2Exp(k *big.Int) *bn254.G2Affine {
+	return p.g2.ScalarMultiplication(k)
+}
+
+// ZExp returns Z^k
+func (p *PreparedParams) ZExp(k *big.Int) *bn254.GT {
+	return p.z.Exp(k)
+}
+
+// SecretToPubkey computes the public key (Z^a1, g2^a2) of a secret key without validating it
+func (p *PreparedParams) SecretToPubkey(secret *SecretKey) *PublicKey {
+	return &PublicKey{
+		First:  p.ZExp(secret.First),
+		Second: p.G2Exp(secret.Second),
+	}
+}
+
+// PreparedPublicKey is a public key with a fixed-base table for Z^a1 and its fingerprint,
+// for callers that encrypt to the same owner many times. It is safe for concurrent use.
+type PreparedPublicKey struct {
+	*PublicKey
+
+	first       *fixedbase.GT
+	fingerprint []byte
+}
+
+// PreparePublicKey precomputes the table of the First component of pk
+func PreparePublicKey(pk *PublicKey) *PreparedPublicKey {
+	return &PreparedPublicKey{
+		PublicKey:   pk,
+		first:       fixedbase.NewGT(pk.First),
+		fingerprint: pk.Fingerprint(),
+	}
+}
+
+// FirstExp returns (Z^a1)^k
+func (pk *PreparedPublicKey) FirstExp(k *big.Int) *bn254.GT {
+	return pk.first.Exp(k)
+}
+
+// Fingerprint returns the fingerprint of the public key, computed when it was prepared
+func (pk *PreparedPublicKey) Fingerprint() []byte {
+	return append([]byte(nil), pk.fingerprint...)
+}
@@ -0,0 +1,124 @@
+package types
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+)
+
+// ReEncryptionProofSize is the size of ReEncryptionProof.MarshalBinary: a compressed G1 point,
+// a scalar and a compressed G2 point
+const ReEncryptionProofSize = bn254.SizeOfG1AffineCompressed + fr.Bytes + bn254.SizeOfG2AffineCompressed
+
+// ReEncryptionProof shows that the First component of a first-level key is e(Capsule, rk)
+// for the re-encryption key rk committed to by e(g1, rk), without revealing rk.
+// It is a Fiat-Shamir transformed proof of knowledge of rk: Response = R + Challenge·rk,
+// where R is a random point of G2.
+type ReEncryptionProof struct {
+	Capsule   *bn254.G1Affine // g1^k, the G1 component of the re-encrypted second-level key
+	Challenge *big.Int
+	Response  *bn254.G2Affine
+}
+
+// MarshalBinary serializes the proof to ReEncryptionProofSize bytes
+func (p *ReEncryptionProof) MarshalBinary() ([]byte, error) {
+	if p.Capsule == nil || p.Challenge == nil || p.Response == nil {
+		return nil, ErrInvalidProof
+	}
+
+	var challenge fr.Element
+	challenge.SetBigInt(p.Challenge)
+
+	capsule := p.Capsule.Bytes()
+	challengeBytes := challenge.Bytes()
+	response := p.Response.Bytes()
+
+	data := make([]byte, 0, ReEncryptionProofSize)
+	data = append(data, capsule[:]...)
+	data = append(data, challengeBytes[:]...)
+	data = append(data, response[:]...)
+	return data, nil
+}
+
+// UnmarshalBinary decodes a proof serialized by MarshalBinary, checking that the points are
+// in their prime-order subgroups and that the challenge is a canonical scalar
+func (p *ReEncryptionProof) UnmarshalBinary(data []byte) error {
+	if len(data) != ReEncryptionProofSize {
+		return fmt.Errorf("%w: expected %d bytes, got %d", ErrInvalidProof, ReEncryptionProofSize, len(data))
+	}
+
+	capsule := new(bn254.G1Affine)
+	if _, err := capsule.SetBytes(data[:bn254.SizeOfG1AffineCompressed]); err != nil {
+		return fmt.Errorf("%w: capsule: %v", ErrInvalidProof, err)
+	}
+	data = data[bn254.SizeOfG1AffineCompressed:]
+
+	var challenge fr.Element
+	if err := challenge.SetBytesCanonical(data[:fr.Bytes]); err != nil {
+		return fmt.Errorf("%w: challenge: %v", ErrInvalidProof, err)
+	}
+	data = data[fr.Bytes:]
+
+	response := new(bn254.G2Affine)
+	if _, err := response.SetBytes(data); err != nil {
+		return fmt.Errorf("%w: response: %v", ErrInvalidProof, err)
+	}
+
+	p.Capsule = capsule
+	p.Challenge = challenge.BigInt(new(big.Int))
+	p.Response = response
+	return nil
+}
+
+// CapsuleProofSize is the size of CapsuleProof.MarshalBinary: two scalars
+const CapsuleProofSize = 2 * fr.Bytes
+
+// CapsuleProof shows that the encryptor of a second-level key knows the scalar k behind
+// its First component g1^k. It is a Fiat-Shamir transformed Schnorr proof: with T = g1^w
+// for a random w, Response = w + Challenge·k, and the challenge also hashes the Second
+// component, the owner and the context, so none of them can be changed without the proof.
+type CapsuleProof struct {
+	Challenge *big.Int
+	Response  *big.Int
+}
+
+// MarshalBinary serializes the proof to CapsuleProofSize bytes
+func (p *CapsuleProof) MarshalBinary() ([]byte, error) {
+	if p.Challenge == nil || p.Response == nil {
+		return nil, fmt.Errorf("%w: incomplete capsule proof", ErrMalformedCapsule)
+	}
+
+	var challenge, response fr.Element
+	challenge.SetBigInt(p.Challenge)
+	response.SetBigInt(p.Response)
+
+	challengeBytes := challenge.Bytes()
+	responseBytes := response.Bytes()
+
+	data := make([]byte, 0, CapsuleProofSize)
+	data = append(data, challengeBytes[:]...)
+	data = append(data, responseBytes[:]...)
+	return data, nil
+}
+
+// UnmarshalBinary decodes a proof serialized by MarshalBinary, checking that both scalars
+// are canonical
+func (p *CapsuleProof) UnmarshalBinary(data []byte) error {
+	if len(data) != CapsuleProofSize {
+		return fmt.Errorf("%w: expected %d bytes of capsule proof, got %d", ErrMalformedCapsule, CapsuleProofSize, len(data))
+	}
+
+	var challenge, response fr.Element
+	if err := challenge.SetBytesCanonical(data[:fr.Bytes]); err != nil {
+		return fmt.Errorf("%w: capsule proof challenge: %v", ErrMalformedCapsule, err)
+	}
+	if err := response.SetBytesCanonical(data[fr.Bytes:]); err != nil {
+		return fmt.Errorf("%w: capsule proof response: %v", ErrMalformedCapsule, err)
+	}
+
+	p.Challenge = challenge.BigInt(new(big.Int))
+	p.Response = response.BigInt(new(big.Int))
+	return nil
+}
@@ -1,6 +1,8 @@
 package types
 
 import (
+	"context"
+	"io"
 	"math/big"
 
 	"github.com/consensys/gnark-crypto/ecc/bn254"
@@ -12,6 +14,33 @@ type SystemParams struct {
 	Z  *bn254.GT
 }
 
+// EncryptOptions holds the optional parameters of the PreClient encryption methods.
+// A nil *EncryptOptions is valid and means no options.
+type EncryptOptions struct {
+	// Context is authenticated together with the message but not encrypted,
+	// e.g. a record ID or a content type. It is attached to the encrypted key,
+	// survives re-encryption unchanged and is checked again on decryption.
+	// Like any additional data it must be known to decrypt, see CapsuleAttributes
+	// for how it is encoded.
+	Context []byte
+
+	// Prove attaches to the encrypted key a proof that the encryptor knows its scalar,
+	// so that a proxy can reject malformed or malleated keys with pre.CheckCapsule
+	// before re-encrypting them.
+	Prove bool
+
+	// Tag restricts re-encryption to the keys generated for the same tag with
+	// ConditionalClient.GenerateTaggedReEncryptionKey, e.g. a record category. It is attached
+	// to the encrypted key in the clear and needs the secret key of the owner, so
+	// EncryptTo, EncryptToPrepared and the CCA-secure client reject it.
+	Tag []byte
+
+	// Epoch restricts re-encryption to the keys generated for the same tag and epoch
+	// with ConditionalClient.GenerateEpochReEncryptionKey, e.g. pre.DailyEpoch(time.Now()),
+	// so that delegations lapse with their epochs. It is handled like Tag.
+	Epoch []byte
+}
+
 // PreScheme defines the interface for a proxy re-encryption scheme
 /*
 This flow demonstrates how Party A can send an encrypted message to Party B through a proxy
@@ -87,13 +116,35 @@ using proxy re-encryption. This is useful when:
 // 4. A's secret key remains secure even if proxy and B collude
 // 5. Re-encryption key is specific to A->B relationship
 
+// PreProxy re-encrypts ciphertexts for delegatees.
+// The proxies of package pre also implement ContextProxy.
 type PreProxy interface {
 	// ReEncryption transforms a second-level ciphertext to a first-level one
 	// Takes a second-level encrypted key and a re-encryption key
 	// Returns a first-level encrypted key
 	ReEncryption(encryptedKey *SecondLevelSymmetricKey, reKey *ReEncryptionKey) *FirstLevelSymmetricKey
+
+	// ReEncryptionWithProof is ReEncryption along with a proof that the re-encryption key
+	// committed to by ReKeyCommitment was used, which anyone can check with VerifyReEncryption
+	ReEncryptionWithProof(encryptedKey *SecondLevelSymmetricKey, reKey *ReEncryptionKey) (*FirstLevelSymmetricKey, *ReEncryptionProof, error)
+
+	// ReEncryptBatch transforms many second-level ciphertexts under the same re-encryption key
+	// Returns the first-level encrypted keys in the same order, or an error if a ciphertext
+	// is malformed or ctx is done before the batch is complete
+	ReEncryptBatch(ctx context.Context, encryptedKeys []*SecondLevelSymmetricKey, reKey *ReEncryptionKey) ([]*FirstLevelSymmetricKey, error)
+
+	// AddRecipient re-encrypts the capsule of an envelope for the delegatee with the given
+	// public key fingerprint and adds it to the recipients of the envelope
+	// The payload of the envelope is left untouched
+	AddRecipient(envelope *Envelope, recipient []byte, reKey *ReEncryptionKey) error
+
+	// RemoveRecipient drops the capsule of the delegatee with the given fingerprint from an envelope
+	// Returns whether the envelope had a capsule for them
+	RemoveRecipient(envelope *Envelope, recipient []byte) bool
 }
 
+// PreClient encrypts and decrypts for data owners and delegatees, and issues their
+// re-encryption keys. The clients of package pre also implement ContextClient.
 type PreClient interface {
 	// GenerateReEncryptionKey creates a re-encryption key for A->B transformation
 	// Takes a portion of secret key from A and a portion of public key from B
@@ -102,19 +153,155 @@ type PreClient interface {
 
 	// SecondLevelEncryption encrypts a message m under a public key
 	// Returns the encrypted symmetric key and the encrypted message
+	// The encrypted message authenticates the encrypted key and, if any, the context in EncryptOptions
 	SecondLevelEncryption(secretA *SecretKey, message string, scalar *big.Int) (*SecondLevelSymmetricKey, []byte, error)
 
+	// SecondLevelEncryptionBytes is SecondLevelEncryption for binary messages
+	// opts may carry a context that is authenticated along with the message
+	SecondLevelEncryptionBytes(secretA *SecretKey, message []byte, scalar *big.Int, opts *EncryptOptions) (*SecondLevelSymmetricKey, []byte, error)
+
+	// SecondLevelEncryptionStream encrypts everything read from src in chunks and writes it to dst
+	// Returns the encrypted symmetric key, which is re-encrypted like any other second-level key
+	SecondLevelEncryptionStream(secretA *SecretKey, dst io.Writer, src io.Reader, scalar *big.Int, opts *EncryptOptions) (*SecondLevelSymmetricKey, error)
+
+	// EncryptTo encrypts a message for the owner of publicA using only their public key
+	// Returns the same kind of encrypted symmetric key as SecondLevelEncryption, along with the encrypted message
+	EncryptTo(publicA *PublicKey, message []byte, opts *EncryptOptions) (*SecondLevelSymmetricKey, []byte, error)
+
+	// EncryptToPrepared is EncryptTo for a public key with a precomputed fixed-base table
+	// Cheaper than EncryptTo when the same public key is used for many messages
+	EncryptToPrepared(publicA *PreparedPublicKey, message []byte, opts *EncryptOptions) (*SecondLevelSymmetricKey, []byte, error)
+
+	// EncryptForRecipients encrypts a message once and shares it with several delegatees
+	// Returns an envelope holding the encrypted message, the second-level encrypted key and
+	// one first-level encrypted key per recipient
+	EncryptForRecipients(secretA *SecretKey, message []byte, recipients []*PublicKey, opts *EncryptOptions) (*Envelope, error)
+
+	// DecryptFirstLevelBytes decrypts message using a first-level encrypted key
+	// Takes an encrypted key, encrypted message, and a secret key
+	// Returns the decrypted message, or an error wrapping ErrInvalidKey,
+	// ErrAuthenticationFailed or ErrMalformedCapsule
+	DecryptFirstLevelBytes(encryptedKey *FirstLevelSymmetricKey, encryptedMessage []byte, secretKey *SecretKey) ([]byte, error)
+
+	// DecryptSecondLevelBytes decrypts message using a second-level encrypted key
+	// Takes an encrypted key, encrypted message, and a secret key
+	// Returns the decrypted message, or an error wrapping ErrInvalidKey,
+	// ErrAuthenticationFailed or ErrMalformedCapsule
+	DecryptSecondLevelBytes(encryptedKey *SecondLevelSymmetricKey, encryptedMessage []byte, secretKey *SecretKey) ([]byte, error)
+
+	// DecryptEnvelope decrypts the payload of an envelope using its second-level encrypted key
+	// Takes an envelope and the secret key of the data owner
+	// Returns the decrypted message, or an error like DecryptSecondLevelBytes
+	// or wrapping ErrUnsupportedEnvelope
+	DecryptEnvelope(envelope *Envelope, secretKey *SecretKey) ([]byte, error)
+
+	// DecryptEnvelopeAsRecipient decrypts the payload of an envelope using the first-level
+	// encrypted key of the delegatee holding secretKey
+	// Returns the decrypted message, or an error like DecryptEnvelope or wrapping ErrNotRecipient
+	DecryptEnvelopeAsRecipient(envelope *Envelope, secretKey *SecretKey) ([]byte, error)
+
+	// DecryptFirstLevelStream decrypts a stream produced by SecondLevelEncryptionStream
+	// using a first-level encrypted key and writes the message to dst
+	DecryptFirstLevelStream(encryptedKey *FirstLevelSymmetricKey, dst io.Writer, src io.Reader, secretKey *SecretKey) error
+
+	// DecryptSecondLevelStream decrypts a stream produced by SecondLevelEncryptionStream
+	// using a second-level encrypted key and writes the message to dst
+	DecryptSecondLevelStream(encryptedKey *SecondLevelSymmetricKey, dst io.Writer, src io.Reader, secretKey *SecretKey) error
+
 	// DecryptFirstLevel decrypts message using a first-level encrypted key
 	// Takes an encrypted key, encrypted message, and a secret key
 	// Returns the decrypted message as a string
+	//
+	// Deprecated: Use DecryptFirstLevelBytes, which reports failures as errors
+	// instead of panicking or returning an empty string.
 	DecryptFirstLevel(encryptedKey *FirstLevelSymmetricKey, encryptedMessage []byte, secretKey *SecretKey) string
 
 	// DecryptSecondLevel decrypts message using a second-level encrypted key
 	// Takes an encrypted key, encrypted message, and a secret key
 	// Returns the decrypted message as a string
+	//
+	// Deprecated: Use DecryptSecondLevelBytes, which reports failures as errors
+	// instead of panicking or returning an empty string.
 	DecryptSecondLevel(encryptedKey *SecondLevelSymmetricKey, encryptedMessage []byte, secretKey *SecretKey) string
 }
 
+// ContextProxy is implemented by the proxies of package pre, which take a context.Context in
+// the methods named with a Context suffix and return its error if it is done before they
+// finish; long operations check it between their steps. The methods of PreProxy behave like
+// their Context version with context.Background(). RemoveRecipient only edits the envelope and
+// has no Context version.
+type ContextProxy interface {
+	// ReEncryptionContext is ReEncryption reporting failures as errors instead of panicking
+	ReEncryptionContext(ctx context.Context, encryptedKey *SecondLevelSymmetricKey, reKey *ReEncryptionKey) (*FirstLevelSymmetricKey, error)
+
+	ReEncryptionWithProofContext(ctx context.Context, encryptedKey *SecondLevelSymmetricKey, reKey *ReEncryptionKey) (*FirstLevelSymmetricKey, *ReEncryptionProof, error)
+
+	AddRecipientContext(ctx context.Context, envelope *Envelope, recipient []byte, reKey *ReEncryptionKey) error
+}
+
+// ContextClient is implemented by the clients of package pre, with a Context version of
+// every method of PreClient but the string-based ones, see ContextProxy. Streams check the
+// context between chunks. Use SecondLevelEncryptionBytesContext and the
+// Decrypt*BytesContext methods instead of the string-based ones.
+type ContextClient interface {
+	// GenerateReEncryptionKeyContext is GenerateReEncryptionKey reporting incomplete keys as
+	// ErrInvalidKey instead of panicking
+	GenerateReEncryptionKeyContext(ctx context.Context, secretA *SecretKey, publicB *PublicKey) (*ReEncryptionKey, error)
+
+	SecondLevelEncryptionBytesContext(ctx context.Context, secretA *SecretKey, message []byte, scalar *big.Int, opts *EncryptOptions) (*SecondLevelSymmetricKey, []byte, error)
+	SecondLevelEncryptionStreamContext(ctx context.Context, secretA *SecretKey, dst io.Writer, src io.Reader, scalar *big.Int, opts *EncryptOptions) (*SecondLevelSymmetricKey, error)
+	EncryptToContext(ctx context.Context, publicA *PublicKey, message []byte, opts *EncryptOptions) (*SecondLevelSymmetricKey, []byte, error)
+	EncryptToPreparedContext(ctx context.Context, publicA *PreparedPublicKey, message []byte, opts *EncryptOptions) (*SecondLevelSymmetricKey, []byte, error)
+	EncryptForRecipientsContext(ctx context.Context, secretA *SecretKey, message []byte, recipients []*PublicKey, opts *EncryptOptions) (*Envelope, error)
+
+	DecryptFirstLevelBytesContext(ctx context.Context, encryptedKey *FirstLevelSymmetricKey, encryptedMessage []byte, secretKey *SecretKey) ([]byte, error)
+	DecryptSecondLevelBytesContext(ctx context.Context, encryptedKey *SecondLevelSymmetricKey, encryptedMessage []byte, secretKey *SecretKey) ([]byte, error)
+	DecryptEnvelopeContext(ctx context.Context, envelope *Envelope, secretKey *SecretKey) ([]byte, error)
+	DecryptEnvelopeAsRecipientContext(ctx context.Context, envelope *Envelope, secretKey *SecretKey) ([]byte, error)
+	DecryptFirstLevelStreamContext(ctx context.Context, encryptedKey *FirstLevelSymmetricKey, dst io.Writer, src io.Reader, secretKey *SecretKey) error
+	DecryptSecondLevelStreamContext(ctx context.Context, encryptedKey *SecondLevelSymmetricKey, dst io.Writer, src io.Reader, secretKey *SecretKey) error
+}
+
+// FragmentProxy is implemented by the proxies of package pre, which re-encrypt with the
+// fragments of a re-encryption key split between several proxies, see FragmentClient
+type FragmentProxy interface {
+	// ReEncryptFragment transforms a second-level ciphertext with one fragment of a
+	// re-encryption key split by GenerateReKeyFragments
+	// Returns a fragment of the first-level key, to be combined with pre.CombineFragments
+	ReEncryptFragment(encryptedKey *SecondLevelSymmetricKey, fragment *ReKeyFragment) (*FirstLevelKeyFragment, error)
+	ReEncryptFragmentContext(ctx context.Context, encryptedKey *SecondLevelSymmetricKey, fragment *ReKeyFragment) (*FirstLevelKeyFragment, error)
+
+	// ReEncryptFragmentWithProof is ReEncryptFragment along with a proof that the fragment
+	// committed to by ReKeyCommitment was used, which anyone can check with VerifyFragment
+	ReEncryptFragmentWithProof(encryptedKey *SecondLevelSymmetricKey, fragment *ReKeyFragment) (*FirstLevelKeyFragment, *ReEncryptionProof, error)
+	ReEncryptFragmentWithProofContext(ctx context.Context, encryptedKey *SecondLevelSymmetricKey, fragment *ReKeyFragment) (*FirstLevelKeyFragment, *ReEncryptionProof, error)
+}
+
+// FragmentClient is implemented by the clients of package pre, which split re-encryption
+// keys between several proxies, any threshold of which are needed to re-encrypt a key
+type FragmentClient interface {
+	// GenerateReKeyFragments splits the re-encryption key for A->B between shares proxies
+	// Any threshold of the returned fragments are needed to re-encrypt for B; the delegatee
+	// needs the threshold to combine them and the ReKeyCommitment of every fragment to verify them
+	GenerateReKeyFragments(secretA *SecretKey, publicB *PublicKey, threshold, shares int) ([]*ReKeyFragment, error)
+	GenerateReKeyFragmentsContext(ctx context.Context, secretA *SecretKey, publicB *PublicKey, threshold, shares int) ([]*ReKeyFragment, error)
+}
+
+// ConditionalClient is implemented by the clients of package pre, which issue re-encryption
+// keys that only re-encrypt the keys encrypted with the same conditions, see EncryptOptions
+type ConditionalClient interface {
+	// GenerateTaggedReEncryptionKey creates a re-encryption key for A->B that only re-encrypts
+	// keys encrypted with the same EncryptOptions.Tag; an empty tag gives GenerateReEncryptionKey
+	GenerateTaggedReEncryptionKey(secretA *SecretKey, publicB *PublicKey, tag []byte) (*ReEncryptionKey, error)
+	GenerateTaggedReEncryptionKeyContext(ctx context.Context, secretA *SecretKey, publicB *PublicKey, tag []byte) (*ReEncryptionKey, error)
+
+	// GenerateEpochReEncryptionKey is GenerateTaggedReEncryptionKey for the keys encrypted
+	// with the same EncryptOptions.Tag and EncryptOptions.Epoch; an empty epoch gives
+	// GenerateTaggedReEncryptionKey
+	GenerateEpochReEncryptionKey(secretA *SecretKey, publicB *PublicKey, tag, epoch []byte) (*ReEncryptionKey, error)
+	GenerateEpochReEncryptionKeyContext(ctx context.Context, secretA *SecretKey, publicB *PublicKey, tag, epoch []byte) (*ReEncryptionKey, error)
+}
+
 // preScheme implements the PreScheme interface
 type PreScheme struct {
 	Client PreClient
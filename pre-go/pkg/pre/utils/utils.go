@@ -4,6 +4,7 @@ import (
 	"crypto/sha256"
 	"fmt"
 	"io"
+	"sync"
 
 	"github.com/consensys/gnark-crypto/ecc/bn254"
 	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre/types"
@@ -26,7 +27,36 @@ func GenerateSystemParameters() (*bn254.G1Affine, *bn254.G2Affine, *bn254.GT) {
 	return &g1, &g2, &Z
 }
 
+// standardParams lazily prepares the system parameters returned by GenerateSystemParameters
+var standardParams = sync.OnceValue(func() *types.PreparedParams {
+	g1, g2, Z := GenerateSystemParameters()
+	return types.PrepareParams(types.SystemParams{G1: g1, G2: g2, Z: Z})
+})
+
+// PreparedSystemParameters returns the system parameters of GenerateSystemParameters along with
+// their fixed-base tables. The tables are computed on the first call and shared afterwards.
+func PreparedSystemParameters() *types.PreparedParams {
+	return standardParams()
+}
+
+// PrepareParams returns params along with their fixed-base tables, reusing the shared tables
+// if params are the ones of GenerateSystemParameters
+func PrepareParams(params types.SystemParams) *types.PreparedParams {
+	standard := standardParams()
+	if params.G1 != nil && params.G2 != nil && params.Z != nil &&
+		params.G1.Equal(standard.G1) && params.G2.Equal(standard.G2) && params.Z.Equal(standard.Z) {
+		return standard
+	}
+	return types.PrepareParams(params)
+}
+
+// SecretToPubkey computes the public key (Z^a1, g^a2) of a secret key, using the shared
+// fixed-base tables if g and Z are the generators of GenerateSystemParameters
 func SecretToPubkey(secret *types.SecretKey, g *bn254.G2Affine, Z *bn254.GT) *types.PublicKey {
+	if standard := standardParams(); g.Equal(standard.G2) && Z.Equal(standard.Z) {
+		return standard.SecretToPubkey(secret)
+	}
+
 	return &types.PublicKey{
 		First:  new(bn254.GT).Exp(*Z, secret.First),
 		Second: new(bn254.G2Affine).ScalarMultiplication(g, secret.Second),
@@ -0,0 +1,150 @@
+package shamir
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+)
+
+// Split shares secret between shares parties, any threshold of which can rebuild it with
+// Combine. Every byte of the secret is shared separately with a random polynomial over
+// GF(2^8) (the field of AES, x^8 + x^4 + x^3 + x + 1), evaluated at distinct random
+// non-zero points.
+//
+// A share is the values of the polynomials, one byte per byte of the secret, followed by
+// the point they were evaluated at, the layout of the shamir-secret-sharing package behind
+// splitSecret in pre-ts, so shares can be split by either SDK and combined by the other.
+func Split(secret []byte, threshold, shares int) ([][]byte, error) {
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("%w: empty secret", ErrInvalidSplit)
+	}
+	if threshold < 2 || shares < threshold || shares > 255 {
+		return nil, fmt.Errorf("%w: cannot split into %d shares with threshold %d", ErrInvalidSplit, shares, threshold)
+	}
+
+	xs, err := randomPoints(shares)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([][]byte, shares)
+	for i := range result {
+		result[i] = make([]byte, len(secret)+1)
+		result[i][len(secret)] = xs[i]
+	}
+
+	coefficients := make([]byte, threshold)
+	for j, b := range secret {
+		coefficients[0] = b
+		if _, err := rand.Read(coefficients[1:]); err != nil {
+			return nil, err
+		}
+		for i, x := range xs {
+			result[i][j] = gfEvaluate(coefficients, x)
+		}
+	}
+	clear(coefficients)
+
+	return result, nil
+}
+
+// Combine rebuilds a secret from shares produced by Split. Any threshold of the shares
+// rebuild the secret; fewer give an unrelated value, which Combine cannot detect. The shares
+// must have the same length and distinct points.
+func Combine(shares [][]byte) ([]byte, error) {
+	if len(shares) < 2 || len(shares) > 255 {
+		return nil, fmt.Errorf("%w: %d shares", ErrInvalidShare, len(shares))
+	}
+	size := len(shares[0])
+	if size < 2 {
+		return nil, fmt.Errorf("%w: share of %d bytes", ErrInvalidShare, size)
+	}
+
+	xs := make([]byte, len(shares))
+	seen := make(map[byte]bool, len(shares))
+	for i, share := range shares {
+		if len(share) != size {
+			return nil, fmt.Errorf("%w: shares of different lengths", ErrInvalidShare)
+		}
+		x := share[size-1]
+		if x == 0 || seen[x] {
+			return nil, fmt.Errorf("%w: duplicate or zero point %d", ErrInvalidShare, x)
+		}
+		seen[x] = true
+		xs[i] = x
+	}
+
+	// the Lagrange coefficients at 0 only depend on the points
+	lambdas := make([]byte, len(xs))
+	for i, xi := range xs {
+		numerator, denominator := byte(1), byte(1)
+		for j, xj := range xs {
+			if j == i {
+				continue
+			}
+			numerator = gfMul(numerator, xj)
+			denominator = gfMul(denominator, xj^xi)
+		}
+		lambdas[i] = gfMul(numerator, gfInverse(denominator))
+	}
+
+	secret := make([]byte, size-1)
+	for j := range secret {
+		var b byte
+		for i, share := range shares {
+			b ^= gfMul(share[j], lambdas[i])
+		}
+		secret[j] = b
+	}
+	return secret, nil
+}
+
+// randomPoints returns n distinct random points of GF(2^8) \ {0}, from a uniform shuffle
+// of 1..255
+func randomPoints(n int) ([]byte, error) {
+	points := make([]byte, 255)
+	for i := range points {
+		points[i] = byte(i + 1)
+	}
+	for i := len(points) - 1; i > 0; i-- {
+		j, err := rand.Int(rand.Reader, big.NewInt(int64(i+1)))
+		if err != nil {
+			return nil, err
+		}
+		points[i], points[j.Int64()] = points[j.Int64()], points[i]
+	}
+	return points[:n], nil
+}
+
+// gfEvaluate returns the value at x of the polynomial with the given coefficients, lowest
+// degree first
+func gfEvaluate(coefficients []byte, x byte) byte {
+	var result byte
+	for i := len(coefficients) - 1; i >= 0; i-- {
+		result = gfMul(result, x) ^ coefficients[i]
+	}
+	return result
+}
+
+// gfMul multiplies in GF(2^8) modulo x^8 + x^4 + x^3 + x + 1, without data-dependent branches
+func gfMul(a, b byte) byte {
+	var product byte
+	for range 8 {
+		product ^= -(b & 1) & a
+		a = (a << 1) ^ (-(a >> 7) & 0x1b)
+		b >>= 1
+	}
+	return product
+}
+
+// gfInverse returns a^254, the inverse of a non-zero element of GF(2^8)
+func gfInverse(a byte) byte {
+	// a^254 = a^(2+4+8+16+32+64+128)
+	result := byte(1)
+	square := a
+	for range 7 {
+		square = gfMul(square, square)
+		result = gfMul(result, square)
+	}
+	return result
+}
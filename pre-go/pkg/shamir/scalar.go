@@ -0,0 +1,236 @@
+package shamir
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/big"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+)
+
+// ScalarShareSize is the size of ScalarShare.MarshalBinary: the index followed by the value
+const ScalarShareSize = 2 + fr.Bytes
+
+// ScalarShare is a share of a scalar of the BN254 scalar field, such as one of the scalars of
+// a types.SecretKey: the value at Index of the polynomial of SplitScalar
+type ScalarShare struct {
+	Index uint16
+	Value *big.Int
+}
+
+// Commitment is the Feldman commitment to the polynomial of SplitScalar: g1^ai for every
+// coefficient ai, the first one committing to the secret. It lets share holders check their
+// share with Verify without learning anything about the secret beyond g1^secret.
+type Commitment []bn254.G1Affine
+
+// SplitScalar shares secret between shares parties, any threshold of which can rebuild it
+// with CombineScalars. Share i is f(i) for a random polynomial f of degree threshold-1 over
+// the scalar field with f(0) = secret; the returned commitment lets every party verify its share.
+func SplitScalar(secret *big.Int, threshold, shares int) ([]*ScalarShare, Commitment, error) {
+	if secret == nil || secret.Sign() < 0 || secret.Cmp(fr.Modulus()) >= 0 {
+		return nil, nil, fmt.Errorf("%w: secret is not a scalar", ErrInvalidSplit)
+	}
+	if threshold < 1 || shares < threshold || shares > math.MaxUint16 {
+		return nil, nil, fmt.Errorf("%w: cannot split into %d shares with threshold %d", ErrInvalidSplit, shares, threshold)
+	}
+
+	coefficients := make([]fr.Element, threshold)
+	coefficients[0].SetBigInt(secret)
+	for i := 1; i < threshold; i++ {
+		if _, err := coefficients[i].SetRandom(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	_, _, g1, _ := bn254.Generators()
+	commitment := make(Commitment, threshold)
+	for i := range coefficients {
+		commitment[i].ScalarMultiplication(&g1, coefficients[i].BigInt(new(big.Int)))
+	}
+
+	result := make([]*ScalarShare, shares)
+	for i := range result {
+		index := uint16(i + 1) // #nosec G115 -- shares is checked above
+		value := EvaluatePolynomial(coefficients, index)
+		result[i] = &ScalarShare{Index: index, Value: value.BigInt(new(big.Int))}
+	}
+	for i := range coefficients {
+		coefficients[i].SetZero()
+	}
+
+	return result, commitment, nil
+}
+
+// CombineScalars rebuilds a scalar from shares produced by SplitScalar. Any threshold of the
+// shares rebuild the secret; fewer give an unrelated scalar, which can be detected by
+// comparing g1^secret with the first point of the commitment.
+func CombineScalars(shares []*ScalarShare) (*big.Int, error) {
+	indices := make([]uint16, len(shares))
+	for i, share := range shares {
+		if share == nil || share.Value == nil || share.Value.Sign() < 0 || share.Value.Cmp(fr.Modulus()) >= 0 {
+			return nil, fmt.Errorf("%w: share %d is not a scalar", ErrInvalidShare, i)
+		}
+		indices[i] = share.Index
+	}
+	lambdas, err := LagrangeCoefficients(indices)
+	if err != nil {
+		return nil, err
+	}
+
+	var secret, term fr.Element
+	for i, share := range shares {
+		term.SetBigInt(share.Value)
+		term.Mul(&term, &lambdas[i])
+		secret.Add(&secret, &term)
+	}
+	return secret.BigInt(new(big.Int)), nil
+}
+
+// Verify checks a share against the commitment: g1^value must be Π Cj^(index^j).
+// It returns an error wrapping ErrInvalidShare if it does not.
+func (c Commitment) Verify(share *ScalarShare) error {
+	if len(c) == 0 {
+		return fmt.Errorf("%w: empty commitment", ErrInvalidShare)
+	}
+	if share == nil || share.Index == 0 || share.Value == nil || share.Value.Sign() < 0 || share.Value.Cmp(fr.Modulus()) >= 0 {
+		return fmt.Errorf("%w: incomplete share", ErrInvalidShare)
+	}
+
+	// Π Cj^(x^j), evaluated with Horner's rule in the exponent
+	x := new(big.Int).SetUint64(uint64(share.Index))
+	var expected bn254.G1Jac
+	for i := len(c) - 1; i >= 0; i-- {
+		var point bn254.G1Jac
+		point.FromAffine(&c[i])
+		expected.ScalarMultiplication(&expected, x)
+		expected.AddAssign(&point)
+	}
+
+	_, _, g1, _ := bn254.Generators()
+	var actual bn254.G1Affine
+	actual.ScalarMultiplication(&g1, share.Value)
+	if !new(bn254.G1Affine).FromJacobian(&expected).Equal(&actual) {
+		return fmt.Errorf("%w: share %d does not match the commitment", ErrInvalidShare, share.Index)
+	}
+	return nil
+}
+
+// MarshalBinary serializes the commitment as its compressed G1 points, 32 bytes each
+func (c Commitment) MarshalBinary() ([]byte, error) {
+	data := make([]byte, 0, len(c)*bn254.SizeOfG1AffineCompressed)
+	for i := range c {
+		point := c[i].Bytes()
+		data = append(data, point[:]...)
+	}
+	return data, nil
+}
+
+// UnmarshalBinary decodes a commitment serialized by MarshalBinary, checking that every
+// point is in G1
+func (c *Commitment) UnmarshalBinary(data []byte) error {
+	if len(data) == 0 || len(data)%bn254.SizeOfG1AffineCompressed != 0 {
+		return fmt.Errorf("%w: commitment of %d bytes", ErrInvalidShare, len(data))
+	}
+
+	commitment := make(Commitment, len(data)/bn254.SizeOfG1AffineCompressed)
+	for i := range commitment {
+		if _, err := commitment[i].SetBytes(data[i*bn254.SizeOfG1AffineCompressed : (i+1)*bn254.SizeOfG1AffineCompressed]); err != nil {
+			return fmt.Errorf("%w: commitment point %d: %v", ErrInvalidShare, i, err)
+		}
+	}
+	*c = commitment
+	return nil
+}
+
+// MarshalBinary serializes the share to ScalarShareSize bytes: index (2, big-endian) || value (32)
+func (s *ScalarShare) MarshalBinary() ([]byte, error) {
+	if s.Index == 0 || s.Value == nil || s.Value.Sign() < 0 || s.Value.Cmp(fr.Modulus()) >= 0 {
+		return nil, fmt.Errorf("%w: incomplete share", ErrInvalidShare)
+	}
+
+	var value fr.Element
+	value.SetBigInt(s.Value)
+	valueBytes := value.Bytes()
+
+	data := binary.BigEndian.AppendUint16(make([]byte, 0, ScalarShareSize), s.Index)
+	return append(data, valueBytes[:]...), nil
+}
+
+// UnmarshalBinary decodes a share serialized by MarshalBinary, requiring a non-zero index
+// and a canonical value
+func (s *ScalarShare) UnmarshalBinary(data []byte) error {
+	if len(data) != ScalarShareSize {
+		return fmt.Errorf("%w: expected %d bytes, got %d", ErrInvalidShare, ScalarShareSize, len(data))
+	}
+	index := binary.BigEndian.Uint16(data)
+	if index == 0 {
+		return fmt.Errorf("%w: index 0", ErrInvalidShare)
+	}
+
+	var value fr.Element
+	if err := value.SetBytesCanonical(data[2:]); err != nil {
+		return fmt.Errorf("%w: value: %v", ErrInvalidShare, err)
+	}
+
+	s.Index, s.Value = index, value.BigInt(new(big.Int))
+	return nil
+}
+
+// EvaluatePolynomial returns the value at x of the polynomial over the scalar field with the
+// given coefficients, lowest degree first
+func EvaluatePolynomial(coefficients []fr.Element, x uint16) fr.Element {
+	var point, result fr.Element
+	point.SetUint64(uint64(x))
+	for i := len(coefficients) - 1; i >= 0; i-- {
+		result.Mul(&result, &point)
+		result.Add(&result, &coefficients[i])
+	}
+	return result
+}
+
+// LagrangeCoefficients returns, for every index, Π xj / (xj - xi) over the other indices:
+// the coefficients interpolating at 0 a polynomial known at these indices. The indices must
+// be distinct and non-zero, or an error wrapping ErrInvalidShare is returned.
+func LagrangeCoefficients(indices []uint16) ([]fr.Element, error) {
+	return LagrangeCoefficientsAt(indices, 0)
+}
+
+// LagrangeCoefficientsAt returns, for every index, Π (x - xj) / (xi - xj) over the other
+// indices: the coefficients interpolating at x a polynomial known at these indices. The
+// indices must be distinct and non-zero, or an error wrapping ErrInvalidShare is returned.
+func LagrangeCoefficientsAt(indices []uint16, x uint16) ([]fr.Element, error) {
+	if len(indices) == 0 {
+		return nil, fmt.Errorf("%w: no shares", ErrInvalidShare)
+	}
+	seen := make(map[uint16]bool, len(indices))
+	for _, index := range indices {
+		if index == 0 || seen[index] {
+			return nil, fmt.Errorf("%w: duplicate or zero index %d", ErrInvalidShare, index)
+		}
+		seen[index] = true
+	}
+
+	lambdas := make([]fr.Element, len(indices))
+	var point, xi, xj, diff, denominator fr.Element
+	point.SetUint64(uint64(x))
+	for i := range indices {
+		lambdas[i].SetOne()
+		denominator.SetOne()
+		xi.SetUint64(uint64(indices[i]))
+		for j := range indices {
+			if j == i {
+				continue
+			}
+			xj.SetUint64(uint64(indices[j]))
+			diff.Sub(&point, &xj)
+			lambdas[i].Mul(&lambdas[i], &diff)
+			diff.Sub(&xi, &xj)
+			denominator.Mul(&denominator, &diff)
+		}
+		denominator.Inverse(&denominator)
+		lambdas[i].Mul(&lambdas[i], &denominator)
+	}
+	return lambdas, nil
+}
@@ -0,0 +1,15 @@
+// Package shamir implements Shamir's secret sharing, over GF(2^8) for byte strings, in the
+// format of the shamir module of pre-ts, and over the BN254 scalar field for the scalars of
+// secret keys, with Feldman commitments in G1 to verify shares.
+package shamir
+
+import "errors"
+
+var (
+	// ErrInvalidSplit is returned when a secret cannot be split with the given parameters
+	ErrInvalidSplit = errors.New("invalid split parameters")
+
+	// ErrInvalidShare is returned when shares are malformed, cannot be combined together or
+	// do not match their commitment
+	ErrInvalidShare = errors.New("invalid share")
+)
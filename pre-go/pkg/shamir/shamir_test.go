@@ -0,0 +1,259 @@
+package shamir_test
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"os"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/shamir"
+	"github.com/stretchr/testify/require"
+)
+
+// vectorsFile holds shares split by this package, which the shamir tests of pre-ts combine
+const vectorsFile = "../../../testdata/shamir_vectors.json"
+
+type byteVector struct {
+	Secret    string   `json:"secret"`
+	Threshold int      `json:"threshold"`
+	Shares    []string `json:"shares"`
+}
+
+type scalarVector struct {
+	Secret     string   `json:"secret"`
+	Threshold  int      `json:"threshold"`
+	Shares     []string `json:"shares"`
+	Commitment string   `json:"commitment"`
+}
+
+type vectors struct {
+	GF256  []byteVector   `json:"gf256"`
+	Scalar []scalarVector `json:"scalar"`
+}
+
+func decodeHex(t *testing.T, s string) []byte {
+	data, err := hex.DecodeString(s)
+	require.NoError(t, err)
+	return data
+}
+
+func TestSplitCombine(t *testing.T) {
+	secret := []byte("Hello, world!")
+	shares, err := shamir.Split(secret, 3, 5)
+	require.NoError(t, err)
+	require.Len(t, shares, 5)
+
+	for _, subset := range [][]int{{0, 1, 2}, {4, 3, 1}, {0, 1, 2, 3, 4}} {
+		selected := make([][]byte, len(subset))
+		for i, j := range subset {
+			selected[i] = shares[j]
+		}
+		combined, err := shamir.Combine(selected)
+		require.NoError(t, err)
+		require.Equal(t, secret, combined, "subset %v", subset)
+	}
+
+	// two shares give an unrelated value
+	combined, err := shamir.Combine(shares[:2])
+	require.NoError(t, err)
+	require.NotEqual(t, secret, combined)
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, split := range [][2]int{{1, 3}, {4, 3}, {2, 256}} {
+			_, err := shamir.Split(secret, split[0], split[1])
+			require.ErrorIs(t, err, shamir.ErrInvalidSplit)
+		}
+		_, err := shamir.Split(nil, 2, 3)
+		require.ErrorIs(t, err, shamir.ErrInvalidSplit)
+
+		for _, invalid := range [][][]byte{
+			shares[:1],
+			{shares[0], shares[0]},
+			{shares[0], shares[1][1:]},
+			{{1}, {2}},
+		} {
+			_, err := shamir.Combine(invalid)
+			require.ErrorIs(t, err, shamir.ErrInvalidShare)
+		}
+	})
+}
+
+func TestSplitScalar(t *testing.T) {
+	secret, err := rand.Int(rand.Reader, fr.Modulus())
+	require.NoError(t, err)
+
+	shares, commitment, err := shamir.SplitScalar(secret, 3, 5)
+	require.NoError(t, err)
+	require.Len(t, shares, 5)
+	require.Len(t, commitment, 3)
+
+	// the first point of the commitment is g1^secret
+	_, _, g1, _ := bn254.Generators()
+	require.True(t, new(bn254.G1Affine).ScalarMultiplication(&g1, secret).Equal(&commitment[0]))
+
+	for _, share := range shares {
+		require.NoError(t, commitment.Verify(share))
+
+		data, err := share.MarshalBinary()
+		require.NoError(t, err)
+		require.Len(t, data, shamir.ScalarShareSize)
+		decoded := new(shamir.ScalarShare)
+		require.NoError(t, decoded.UnmarshalBinary(data))
+		require.Equal(t, share, decoded)
+	}
+
+	combined, err := shamir.CombineScalars([]*shamir.ScalarShare{shares[4], shares[0], shares[2]})
+	require.NoError(t, err)
+	require.Equal(t, secret, combined)
+
+	t.Run("interpolation at a share", func(t *testing.T) {
+		indices := []uint16{shares[4].Index, shares[0].Index, shares[2].Index}
+		lambdas, err := shamir.LagrangeCoefficientsAt(indices, shares[1].Index)
+		require.NoError(t, err)
+
+		var value, term fr.Element
+		for i, share := range []*shamir.ScalarShare{shares[4], shares[0], shares[2]} {
+			term.SetBigInt(share.Value)
+			term.Mul(&term, &lambdas[i])
+			value.Add(&value, &term)
+		}
+		require.Equal(t, shares[1].Value, value.BigInt(new(big.Int)))
+	})
+
+	t.Run("commitment", func(t *testing.T) {
+		data, err := commitment.MarshalBinary()
+		require.NoError(t, err)
+		var decoded shamir.Commitment
+		require.NoError(t, decoded.UnmarshalBinary(data))
+		require.Equal(t, commitment, decoded)
+
+		require.ErrorIs(t, decoded.UnmarshalBinary(data[1:]), shamir.ErrInvalidShare)
+	})
+
+	t.Run("forged share", func(t *testing.T) {
+		forged := &shamir.ScalarShare{Index: shares[1].Index, Value: new(big.Int).Add(shares[1].Value, big.NewInt(1))}
+		require.ErrorIs(t, commitment.Verify(forged), shamir.ErrInvalidShare)
+
+		moved := &shamir.ScalarShare{Index: shares[2].Index, Value: shares[1].Value}
+		require.ErrorIs(t, commitment.Verify(moved), shamir.ErrInvalidShare)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, _, err := shamir.SplitScalar(fr.Modulus(), 2, 3)
+		require.ErrorIs(t, err, shamir.ErrInvalidSplit)
+		_, _, err = shamir.SplitScalar(secret, 0, 3)
+		require.ErrorIs(t, err, shamir.ErrInvalidSplit)
+
+		_, err = shamir.CombineScalars([]*shamir.ScalarShare{shares[0], shares[0]})
+		require.ErrorIs(t, err, shamir.ErrInvalidShare)
+		_, err = shamir.CombineScalars(nil)
+		require.ErrorIs(t, err, shamir.ErrInvalidShare)
+
+		data, err := shares[0].MarshalBinary()
+		require.NoError(t, err)
+		data[0], data[1] = 0, 0
+		require.ErrorIs(t, new(shamir.ScalarShare).UnmarshalBinary(data), shamir.ErrInvalidShare)
+	})
+}
+
+// TestVectors combines the vectors in testdata, which the pre-ts tests combine as well.
+// The file is written from fresh splits if it does not exist.
+func TestVectors(t *testing.T) {
+	if _, err := os.Stat(vectorsFile); errors.Is(err, os.ErrNotExist) {
+		writeVectors(t)
+	}
+
+	content, err := os.ReadFile(vectorsFile)
+	require.NoError(t, err)
+	var v vectors
+	require.NoError(t, json.Unmarshal(content, &v))
+	require.NotEmpty(t, v.GF256)
+	require.NotEmpty(t, v.Scalar)
+
+	for _, vector := range v.GF256 {
+		shares := make([][]byte, len(vector.Shares))
+		for i, share := range vector.Shares {
+			shares[i] = decodeHex(t, share)
+		}
+		combined, err := shamir.Combine(shares[len(shares)-vector.Threshold:])
+		require.NoError(t, err)
+		require.Equal(t, decodeHex(t, vector.Secret), combined)
+	}
+
+	for _, vector := range v.Scalar {
+		var commitment shamir.Commitment
+		require.NoError(t, commitment.UnmarshalBinary(decodeHex(t, vector.Commitment)))
+
+		shares := make([]*shamir.ScalarShare, len(vector.Shares))
+		for i, share := range vector.Shares {
+			shares[i] = new(shamir.ScalarShare)
+			require.NoError(t, shares[i].UnmarshalBinary(decodeHex(t, share)))
+			require.NoError(t, commitment.Verify(shares[i]))
+		}
+		combined, err := shamir.CombineScalars(shares[:vector.Threshold])
+		require.NoError(t, err)
+		require.Equal(t, new(big.Int).SetBytes(decodeHex(t, vector.Secret)), combined)
+	}
+}
+
+// TestFieldArithmetic checks the multiplication of GF(2^8) against FIPS-197
+func TestFieldArithmetic(t *testing.T) {
+	// {57}·{83} = {c1} and {53} is the inverse of {ca}, both from FIPS-197. Sharing them
+	// with threshold 2 and combining gives them back only if the field is the one of AES.
+	shares, err := shamir.Split([]byte{0x57, 0x83, 0x53, 0xca}, 2, 2)
+	require.NoError(t, err)
+	combined, err := shamir.Combine(shares)
+	require.NoError(t, err)
+	require.Equal(t, []byte{0x57, 0x83, 0x53, 0xca}, combined)
+}
+
+func writeVectors(t *testing.T) {
+	var v vectors
+	for _, split := range []struct {
+		secret            []byte
+		threshold, shares int
+	}{
+		{[]byte("Hello, world!"), 2, 3},
+		{decodeHex(t, "6a09e667f3bcc908b2fb1366ea957d3e3adec17512775099da2f590b0667322a"), 3, 5},
+		{[]byte{0}, 5, 255},
+	} {
+		shares, err := shamir.Split(split.secret, split.threshold, split.shares)
+		require.NoError(t, err)
+		vector := byteVector{Secret: hex.EncodeToString(split.secret), Threshold: split.threshold}
+		for _, share := range shares {
+			vector.Shares = append(vector.Shares, hex.EncodeToString(share))
+		}
+		v.GF256 = append(v.GF256, vector)
+	}
+
+	for _, threshold := range []int{2, 3} {
+		secret, err := rand.Int(rand.Reader, fr.Modulus())
+		require.NoError(t, err)
+		shares, commitment, err := shamir.SplitScalar(secret, threshold, 5)
+		require.NoError(t, err)
+
+		commitmentBytes, err := commitment.MarshalBinary()
+		require.NoError(t, err)
+		var secretBytes [fr.Bytes]byte
+		vector := scalarVector{
+			Secret:     hex.EncodeToString(secret.FillBytes(secretBytes[:])),
+			Threshold:  threshold,
+			Commitment: hex.EncodeToString(commitmentBytes),
+		}
+		for _, share := range shares {
+			data, err := share.MarshalBinary()
+			require.NoError(t, err)
+			vector.Shares = append(vector.Shares, hex.EncodeToString(data))
+		}
+		v.Scalar = append(v.Scalar, vector)
+	}
+
+	content, err := json.MarshalIndent(v, "", "  ")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(vectorsFile, append(content, '\n'), 0o600))
+}
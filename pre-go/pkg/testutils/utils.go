@@ -8,8 +8,8 @@ import (
 	"os"
 
 	"github.com/consensys/gnark-crypto/ecc/bn254"
+	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre/keys"
 	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre/types"
-	"github.com/lifenetwork-ai/proxy-recrypt-sdk/pre-go/pkg/pre/utils"
 )
 
 // generateSystemParameters returns the system parameters for pairing-based cryptography:
@@ -31,30 +31,30 @@ func GenerateSystemParameters() (g1 bn254.G1Affine, g2 bn254.G2Affine, Z bn254.G
 // GenerateRandomKeyPair generates a random key pair for the PRE scheme.
 // It returns a random key pair with a random public key and secret key.
 // The public key is generated from the secret key using the system parameters g and Z.
+// Production code should use keys.GenerateKeyPair instead.
 func GenerateRandomKeyPair(g *bn254.G2Affine, Z *bn254.GT) *types.KeyPair {
-	sk := &types.SecretKey{
-		First:  GenerateRandomScalar(),
-		Second: GenerateRandomScalar(),
+	keyPair, err := keys.GenerateKeyPair(types.SystemParams{G2: g, Z: Z}, rand.Reader)
+	if err != nil {
+		panic(err)
 	}
 
-	pk := utils.SecretToPubkey(sk, g, Z)
-
-	return &types.KeyPair{
-		PublicKey: pk,
-		SecretKey: sk,
-	}
+	return keyPair
 }
 
+// GenerateRandomScalar returns a random non-zero scalar, see keys.RandomScalar
 func GenerateRandomScalar() *big.Int {
-	// Get the order of BN254 curve
-	order := bn254.ID.ScalarField()
-	// Generate random scalar in [0, order-1]
-	scalar, _ := rand.Int(rand.Reader, order)
+	scalar, err := keys.RandomScalar(rand.Reader)
+	if err != nil {
+		panic(err)
+	}
 	return scalar
 }
 
+// GenerateRandomGTElem returns Z^r for a random scalar r, so that the result is in the
+// subgroup of order r like every GT element produced by the scheme
 func GenerateRandomGTElem() *bn254.GT {
-	elem, _ := new(bn254.GT).SetRandom()
+	_, _, Z := GenerateSystemParameters()
+	elem := new(bn254.GT).Exp(Z, GenerateRandomScalar())
 	return elem
 }
 
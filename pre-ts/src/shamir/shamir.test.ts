@@ -1,6 +1,8 @@
 import { combineSecret, splitSecret } from ".";
 import { generateRandomSymmetricKeyFromGT } from "../crypto";
 import { describe, test, expect } from "@jest/globals";
+import fs from "fs";
+import { bytesToHex, hexToBytes } from "../utils";
 
 describe("Test Shamir's Secret Sharing", () => {
   test("Split then combine simple secret", async () => {
@@ -52,4 +54,18 @@ describe("Test Shamir's Secret Sharing", () => {
     expect(combinedSecret.toString()).toEqual(secret.toString());
     expect(combinedSecret.toString()).toEqual(combinedSecret2.toString());
   });
+
+  test("Combine shares split by pre-go", async () => {
+    const vectors = JSON.parse(
+      fs.readFileSync("../testdata/shamir_vectors.json", "utf-8")
+    );
+
+    for (const vector of vectors.gf256) {
+      const shares = vector.shares
+        .slice(0, vector.threshold)
+        .map((share: string) => hexToBytes(share));
+      const combinedSecret = await combineSecret(shares);
+      expect(bytesToHex(combinedSecret)).toEqual(vector.secret);
+    }
+  });
 });
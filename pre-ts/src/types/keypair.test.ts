@@ -1,4 +1,5 @@
 import { describe, test, expect } from "@jest/globals";
+import fs from "fs";
 import { BN254CurveWrapper } from "../crypto/bn254";
 import { SecretKey, PublicKey } from ".";
 import {
@@ -9,6 +10,7 @@ import {
   secretToPubkey,
 } from "../utils";
 import { generateRandomSymmetricKeyFromGT } from "../crypto";
+import { loadAliceKeyPair } from "../utils/testUtils";
 
 describe("SecretKey", () => {
   const createTestSecretKey = () => {
@@ -171,3 +173,29 @@ describe("PublicKey", () => {
     });
   });
 });
+
+describe("canonical encoding", () => {
+  // The vectors are written by the Go SDK (pkg/pre/types/codec_test.go) from the same keypair
+  test("PublicKey.toBytes should match the Go encoding", async () => {
+    const keyPair = await loadAliceKeyPair();
+    const expected = fs.readFileSync("../testdata/alice_public_key.txt", "utf-8");
+
+    const bytes = keyPair.publicKey.toBytes();
+    expect(Buffer.from(bytes).toString("base64")).toBe(expected.trim());
+
+    const decoded = PublicKey.fromBytes(Buffer.from(expected.trim(), "base64"));
+    expect(decoded.toBytes()).toEqual(bytes);
+  });
+
+  test("SecretKey.toBytes should match the Go encoding", async () => {
+    const keyPair = await loadAliceKeyPair();
+    const expected = fs.readFileSync("../testdata/alice_secret_key.txt", "utf-8");
+
+    const bytes = keyPair.secretKey.toBytes();
+    expect(Buffer.from(bytes).toString("base64")).toBe(expected.trim());
+
+    const decoded = SecretKey.fromBytes(Buffer.from(expected.trim(), "base64"));
+    expect(decoded.first).toBe(keyPair.secretKey.first);
+    expect(decoded.second).toBe(keyPair.secretKey.second);
+  });
+});